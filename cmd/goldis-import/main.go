@@ -0,0 +1,55 @@
+// goldis-import converts a redis RDB file to a goldis snapshot file, goldis loads it at startup
+// when it's named after the dbfilename parameter in dir
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/rdb"
+)
+
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [-db n] [-o dump.gdb] dump.rdb\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	db := fs.Int("db", 0, "database of the RDB file to import, -1 imports every database")
+	out := fs.String("o", "dump.gdb", "path of the goldis snapshot file to write")
+	_ = fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := convert(fs.Arg(0), *out, *db); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func convert(in string, out string, db int) error {
+	start := time.Now()
+	entries := make([]datastore.Entry, 0)
+	stats, err := rdb.Load(in, db, func(entry datastore.Entry) {
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		return err
+	}
+	if err := persistence.SaveSnapshot(out, entries); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d keys from %s to %s in %v\n", stats.Keys, in, out, time.Since(start))
+	if stats.Expired > 0 || stats.OtherDBs > 0 {
+		fmt.Printf("Dropped %d expired keys and %d keys of the other databases\n", stats.Expired, stats.OtherDBs)
+	}
+	for name, keys := range stats.Skipped {
+		fmt.Printf("Skipped %d keys of type %s, goldis only has strings and sorted sets\n", keys, name)
+	}
+	return nil
+}
@@ -1,25 +1,316 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/internal/config"
+	"github.com/miladbarzideh/goldis/internal/metrics"
 	"github.com/miladbarzideh/goldis/internal/network"
-)
-
-const (
-	ip   = "0.0.0.0"
-	port = 6380
+	"github.com/miladbarzideh/goldis/utils"
 )
 
 func main() {
-	socket, err := network.NewSocket(net.ParseIP(ip), port)
+	cfg, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	utils.SetLogLevel(cfg.LogLevel)
+	utils.SetNumThreads(cfg.Threads)
+	if cfg.File != "" {
+		utils.Noticef("Configuration loaded from %s", cfg.File)
+	}
+
+	bindIPs, v6only := parseBind(cfg.Bind)
+	sockets, err := listen(bindIPs, v6only, cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer socket.Close()
+	tlsListeners := make([]*network.TLSListener, 0)
+	if cfg.TLSPort != 0 {
+		tlsListeners, err = listenTLS(bindIPs, v6only, cfg.TLSPort, tlsSettings(cfg))
+		if err != nil {
+			log.Fatal(err)
+		}
+		go reloadCertificatesOnHangup(tlsListeners)
+	}
+
+	connManager, err := network.NewConnectionHandler(cfg, sockets...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.ACLFile != "" {
+		if err := connManager.ACL().Load(cfg.ACLFile); err != nil {
+			log.Fatal(err)
+		}
+		utils.Noticef("ACL users loaded from %s", cfg.ACLFile)
+	}
+	if err := connManager.Load(); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.ImportRDB != "" {
+		if err := connManager.ImportRDB(cfg.ImportRDB, cfg.ImportRDBDB); err != nil {
+			log.Fatal(err)
+		}
+	}
+	applyConfig(cfg, connManager, tlsListeners)
+	if cfg.MetricsAddr != "" {
+		if err := serveMetrics(cfg.MetricsAddr, connManager); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, listener := range tlsListeners {
+		connManager.AddTLSListener(listener)
+	}
+	go shutdownOnSignal(connManager)
+	if err := connManager.StartServer(); err != nil {
+		utils.Warningf("Shutdown failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+// serveMetrics serves the Prometheus metrics over HTTP until the server shuts down
+func serveMetrics(addr string, connManager *network.ConnectionHandler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           metrics.Handler(connManager.MetricsSnapshot),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			utils.Warningf("Metrics listener: %v", err)
+		}
+	}()
+	connManager.OnShutdown(func(actions.ShutdownMode) error {
+		return server.Close()
+	})
+	utils.Noticef("Serving the metrics on http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// shutdownOnSignal stops the server gracefully on SIGINT or SIGTERM, a second signal exits
+// right away when the shutdown is stuck
+func shutdownOnSignal(connManager *network.ConnectionHandler) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	utils.Noticef("Received %v, scheduling shutdown...", sig)
+	connManager.RequestShutdown(actions.ShutdownDefault)
+	sig = <-signals
+	utils.Warningf("Received %v again, exiting now without waiting for the shutdown", sig)
+	os.Exit(1)
+}
+
+// applyConfig configures the server and keeps it in sync with CONFIG SET
+func applyConfig(cfg *config.Config, connManager *network.ConnectionHandler, tlsListeners []*network.TLSListener) {
+	connManager.SetIdleTimeout(cfg.IdleTimeout)
+	connManager.SetMaxClients(cfg.MaxClients)
+	connManager.SetMaxClientsPerIP(cfg.MaxClientsPerIP)
+	checkFileLimit(cfg.MaxClients)
+	connManager.DataStore().SetMaxWorks(cfg.ExpireWorkBudget)
+	connManager.DataStore().SetLargeContainerSize(cfg.LazyFreeThreshold)
+	connManager.SetNotifyKeyspaceEvents(cfg.NotifyKeyspaceEvents)
+	connManager.SlowLog().SetThreshold(cfg.SlowLogSlowerThan)
+	connManager.SlowLog().SetMaxLen(cfg.SlowLogMaxLen)
+	connManager.SetSaveRules(cfg.SaveRules)
+	connManager.SetAppendFsync(cfg.AppendFsync)
+	connManager.SetAOFRewriteRule(cfg.AutoAOFRewritePercentage, cfg.AutoAOFRewriteMinSize)
+	if cfg.RequirePass != "" {
+		connManager.ACL().SetDefaultPassword(cfg.RequirePass)
+	}
+
+	cfg.Watch("requirepass", func(cfg *config.Config) error {
+		connManager.ACL().SetDefaultPassword(cfg.RequirePass)
+		return nil
+	})
+	cfg.Watch("timeout", func(cfg *config.Config) error {
+		connManager.SetIdleTimeout(cfg.IdleTimeout)
+		return nil
+	})
+	cfg.Watch("maxclients", func(cfg *config.Config) error {
+		connManager.SetMaxClients(cfg.MaxClients)
+		checkFileLimit(cfg.MaxClients)
+		return nil
+	})
+	cfg.Watch("maxclients-per-ip", func(cfg *config.Config) error {
+		connManager.SetMaxClientsPerIP(cfg.MaxClientsPerIP)
+		return nil
+	})
+	cfg.Watch("expire-work-budget", func(cfg *config.Config) error {
+		connManager.DataStore().SetMaxWorks(cfg.ExpireWorkBudget)
+		return nil
+	})
+	cfg.Watch("lazyfree-threshold", func(cfg *config.Config) error {
+		connManager.DataStore().SetLargeContainerSize(cfg.LazyFreeThreshold)
+		return nil
+	})
+	cfg.Watch("notify-keyspace-events", func(cfg *config.Config) error {
+		connManager.SetNotifyKeyspaceEvents(cfg.NotifyKeyspaceEvents)
+		return nil
+	})
+	cfg.Watch("slowlog-log-slower-than", func(cfg *config.Config) error {
+		connManager.SlowLog().SetThreshold(cfg.SlowLogSlowerThan)
+		return nil
+	})
+	cfg.Watch("slowlog-max-len", func(cfg *config.Config) error {
+		connManager.SlowLog().SetMaxLen(cfg.SlowLogMaxLen)
+		return nil
+	})
+	cfg.Watch("save", func(cfg *config.Config) error {
+		connManager.SetSaveRules(cfg.SaveRules)
+		return nil
+	})
+	cfg.Watch("appendfsync", func(cfg *config.Config) error {
+		connManager.SetAppendFsync(cfg.AppendFsync)
+		return nil
+	})
+	for _, name := range []string{"auto-aof-rewrite-percentage", "auto-aof-rewrite-min-size"} {
+		cfg.Watch(name, func(cfg *config.Config) error {
+			connManager.SetAOFRewriteRule(cfg.AutoAOFRewritePercentage, cfg.AutoAOFRewriteMinSize)
+			return nil
+		})
+	}
+	cfg.Watch("loglevel", func(cfg *config.Config) error {
+		utils.SetLogLevel(cfg.LogLevel)
+		return nil
+	})
+	for _, name := range []string{"tls-cert-file", "tls-key-file", "tls-ca-cert-file", "tls-auth-clients"} {
+		cfg.Watch(name, func(cfg *config.Config) error {
+			for _, listener := range tlsListeners {
+				if err := listener.Update(tlsSettings(cfg)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// checkFileLimit warns when the process can't open a file descriptor for every client
+func checkFileLimit(maxClients int) {
+	// the listeners, the poller and the background files need some descriptors too
+	const reserved = 32
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return
+	}
+	if limit.Cur < uint64(maxClients+reserved) {
+		utils.Warningf("The open files limit is %d, fewer than the %d clients allowed by maxclients can connect",
+			limit.Cur, maxClients)
+	}
+}
+
+func tlsSettings(cfg *config.Config) network.TLSSettings {
+	return network.TLSSettings{
+		CertFile:    cfg.TLSCertFile,
+		KeyFile:     cfg.TLSKeyFile,
+		CAFile:      cfg.TLSCAFile,
+		AuthClients: cfg.TLSAuthClients,
+	}
+}
 
-	connManager := network.NewConnectionHandler(socket)
-	connManager.StartServer()
+// parseBind parses the validated bind addresses, IPv6 listeners are v6only when an IPv4 address is listed too
+func parseBind(bind string) ([]net.IP, bool) {
+	addrs := strings.Fields(bind)
+	ips := make([]net.IP, 0, len(addrs))
+	v6only := false
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		// an IPv4 listener on the same port conflicts with a dual-stack one
+		if ip.To4() != nil {
+			v6only = true
+		}
+		ips = append(ips, ip)
+	}
+	return ips, v6only
+}
+
+func listen(ips []net.IP, v6only bool, cfg *config.Config) ([]*network.Socket, error) {
+	sockets := make([]*network.Socket, 0)
+	closeAll := func() {
+		for _, socket := range sockets {
+			_ = socket.Close()
+		}
+	}
+
+	if cfg.Port != 0 {
+		for _, ip := range ips {
+			socket, err := network.NewSocket(ip, cfg.Port, v6only)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			utils.Noticef("Listening on %s", net.JoinHostPort(ip.String(), strconv.Itoa(cfg.Port)))
+			sockets = append(sockets, socket)
+		}
+	}
+
+	if cfg.UnixSocket != "" {
+		socket, err := network.NewUnixSocket(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		utils.Noticef("Listening on %s", cfg.UnixSocket)
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+func listenTLS(ips []net.IP, v6only bool, port int, settings network.TLSSettings) ([]*network.TLSListener, error) {
+	listeners := make([]*network.TLSListener, 0, len(ips))
+	for _, ip := range ips {
+		netw := "tcp"
+		if ip.To4() != nil {
+			netw = "tcp4"
+		} else if v6only {
+			netw = "tcp6"
+		}
+		addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		listener, err := network.NewTLSListener(netw, addr, settings)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, err
+		}
+		utils.Noticef("Listening for TLS on %s", addr)
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// reloadCertificatesOnHangup reloads the TLS certificates on SIGHUP
+func reloadCertificatesOnHangup(listeners []*network.TLSListener) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		for _, listener := range listeners {
+			if err := listener.Reload(); err != nil {
+				utils.Warningf("TLS certificates reload failed on %s: %v", listener.Addr(), err)
+				continue
+			}
+			utils.Noticef("TLS certificates reloaded on %s", listener.Addr())
+		}
+	}
 }
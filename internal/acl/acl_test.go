@@ -0,0 +1,97 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func knownCommand(name string) bool {
+	switch name {
+	case "get", "set", "config", "keys":
+		return true
+	}
+	return false
+}
+
+func TestRegistry_DefaultUser(t *testing.T) {
+	r := NewRegistry(knownCommand)
+	if user := r.Resolve(""); user == nil || user.Name != DefaultUser {
+		t.Errorf("Expected the default user, got %v", user)
+	}
+	r.SetDefaultPassword("secret")
+	if user := r.Resolve(""); user != nil {
+		t.Errorf("Expected no user once requirepass is set, got %s", user.Name)
+	}
+	if _, err := r.Authenticate(DefaultUser, "wrong"); err != ErrWrongPass {
+		t.Errorf("Expected ErrWrongPass, got %v", err)
+	}
+	if _, err := r.Authenticate(DefaultUser, "secret"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := r.DelUser(DefaultUser); err != ErrDeleteDefaultUser {
+		t.Errorf("Expected ErrDeleteDefaultUser, got %v", err)
+	}
+}
+
+func TestRegistry_SetUser(t *testing.T) {
+	r := NewRegistry(knownCommand)
+	if err := r.SetUser("app", "on", ">pass", "~app:*", "+@all", "-config"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := r.SetUser("reports", "on", ">pass", "allkeys", "+@read"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	app := r.Get("app")
+	if !app.CanRun("set", []string{CategoryWrite}) || app.CanRun("config", []string{CategoryAdmin}) {
+		t.Errorf("Expected app to run set but not config, rules: %s", app.Commands())
+	}
+	if !app.CanAccessKey("app:users") || app.CanAccessKey("other") {
+		t.Errorf("Expected app to access app:* keys only, patterns: %s", app.Keys())
+	}
+	reports := r.Get("reports")
+	if !reports.CanRun("get", []string{CategoryRead}) || reports.CanRun("set", []string{CategoryWrite}) {
+		t.Errorf("Expected reports to be read-only, rules: %s", reports.Commands())
+	}
+
+	// either every rule is applied or none
+	if err := r.SetUser("app", "off", "+unknown"); err == nil {
+		t.Errorf("Expected an error for an unknown command")
+	}
+	if !r.Get("app").Enabled() {
+		t.Errorf("Expected app to stay enabled after a failed SETUSER")
+	}
+	if err := r.SetUser("app", "allkeys", "~more:*"); err == nil {
+		t.Errorf("Expected an error for a pattern after allkeys")
+	}
+}
+
+func TestRegistry_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	r := NewRegistry(knownCommand)
+	_ = r.SetUser("app", "on", ">pass", "~app:*", "+get", "+set")
+	if err := r.Save(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	loaded := NewRegistry(knownCommand)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(loaded.List(), r.List()) {
+		t.Errorf("Expected %v, got %v", r.List(), loaded.List())
+	}
+	if _, err := loaded.Authenticate("app", "pass"); err != nil {
+		t.Errorf("Expected the password to survive the file, got %v", err)
+	}
+
+	_ = os.WriteFile(path, []byte("user app on +nope\n"), 0600)
+	if err := loaded.Load(path); err == nil {
+		t.Errorf("Expected an error for an invalid file")
+	}
+	if loaded.Get("app") == nil {
+		t.Errorf("Expected the users to be kept when the file is invalid")
+	}
+}
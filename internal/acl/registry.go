@@ -0,0 +1,198 @@
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultUser is the user of the clients that haven't authenticated
+const DefaultUser = "default"
+
+var (
+	ErrWrongPass         = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	ErrDeleteDefaultUser = errors.New("the 'default' user cannot be removed")
+)
+
+// Registry holds the ACL users, the default user exists from the start and can't be deleted
+type Registry struct {
+	users map[string]*User
+	// commandExists validates the command names of the rules
+	commandExists func(name string) bool
+}
+
+func NewRegistry(commandExists func(name string) bool) *Registry {
+	r := &Registry{commandExists: commandExists}
+	r.users = map[string]*User{DefaultUser: r.defaultUser()}
+	return r
+}
+
+// defaultUser can run every command on every key without a password
+func (r *Registry) defaultUser() *User {
+	user := newUser(DefaultUser)
+	for _, rule := range []string{"on", "nopass", "allkeys", "allcommands"} {
+		_ = user.apply(rule, r.commandExists)
+	}
+	return user
+}
+
+// Get returns the user or nil when it doesn't exist
+func (r *Registry) Get(name string) *User {
+	return r.users[name]
+}
+
+// Resolve returns the user a client acts as, the clients that haven't authenticated
+// act as the default user when it doesn't need a password. Nil means not authenticated
+func (r *Registry) Resolve(name string) *User {
+	if name == "" {
+		user := r.users[DefaultUser]
+		if user.enabled && user.nopass {
+			return user
+		}
+		return nil
+	}
+	user := r.users[name]
+	if user == nil || !user.enabled {
+		return nil
+	}
+	return user
+}
+
+// Authenticate checks the credentials of a user
+func (r *Registry) Authenticate(name string, password string) (*User, error) {
+	user := r.users[name]
+	if user == nil || !user.enabled || !user.CheckPassword(password) {
+		return nil, ErrWrongPass
+	}
+	return user, nil
+}
+
+// SetUser creates or changes a user, either every rule is applied or none of them
+func (r *Registry) SetUser(name string, rules ...string) error {
+	user, ok := r.users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.apply(rule, r.commandExists); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %w", rule, err)
+		}
+	}
+	r.users[name] = user
+	return nil
+}
+
+// DelUser deletes the users and returns how many existed
+func (r *Registry) DelUser(names ...string) (int, error) {
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, ErrDeleteDefaultUser
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := r.users[name]; ok {
+			delete(r.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// SetDefaultPassword is requirepass, an empty password lets everyone act as the default user
+func (r *Registry) SetDefaultPassword(password string) {
+	if password == "" {
+		_ = r.SetUser(DefaultUser, "nopass")
+		return
+	}
+	_ = r.SetUser(DefaultUser, "resetpass", ">"+password)
+}
+
+// Names returns the sorted user names
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.users))
+	for name := range r.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List describes every user, sorted by name
+func (r *Registry) List() []string {
+	lines := make([]string, 0, len(r.users))
+	for _, name := range r.Names() {
+		lines = append(lines, r.users[name].Describe())
+	}
+	return lines
+}
+
+// Load replaces the users with the ones of an ACL file made of "user <name> <rules...>" lines,
+// the users are kept unchanged when the file has an error
+func (r *Registry) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	loaded := &Registry{users: make(map[string]*User), commandExists: r.commandExists}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: should start with user keyword followed by the username", path, line)
+		}
+		if _, ok := loaded.users[fields[1]]; ok {
+			return fmt.Errorf("%s:%d: duplicate user '%s'", path, line, fields[1])
+		}
+		if err := loaded.SetUser(fields[1], fields[2:]...); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := loaded.users[DefaultUser]; !ok {
+		loaded.users[DefaultUser] = r.defaultUser()
+	}
+	r.users = loaded.users
+	return nil
+}
+
+// Save writes the users to an ACL file, the file is replaced atomically
+func (r *Registry) Save(path string) error {
+	content := strings.Join(r.List(), "\n") + "\n"
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,284 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// Command categories, a command belongs to one or more of them
+const (
+	CategoryAll         = "all"
+	CategoryKeyspace    = "keyspace"
+	CategoryRead        = "read"
+	CategoryWrite       = "write"
+	CategoryString      = "string"
+	CategorySortedSet   = "sortedset"
+	CategoryFast        = "fast"
+	CategorySlow        = "slow"
+	CategoryAdmin       = "admin"
+	CategoryDangerous   = "dangerous"
+	CategoryConnection  = "connection"
+	CategoryPubSub      = "pubsub"
+	CategoryTransaction = "transaction"
+)
+
+var categories = []string{
+	CategoryAll, CategoryKeyspace, CategoryRead, CategoryWrite, CategoryString, CategorySortedSet,
+	CategoryFast, CategorySlow, CategoryAdmin, CategoryDangerous, CategoryConnection, CategoryPubSub,
+	CategoryTransaction,
+}
+
+// User holds the credentials and the permissions of an ACL user
+type User struct {
+	Name    string
+	enabled bool
+	// nopass accepts any password
+	nopass bool
+	// passwords are the SHA-256 hex digests of the valid passwords
+	passwords []string
+	// commandRules are +command, -command, +@category and -@category rules,
+	// the last rule matching a command decides whether it's allowed
+	commandRules []string
+	keyPatterns  []string
+}
+
+func newUser(name string) *User {
+	return &User{Name: name}
+}
+
+// Enabled reports whether the user can authenticate
+func (u *User) Enabled() bool {
+	return u.enabled
+}
+
+// NoPass reports whether any password is accepted
+func (u *User) NoPass() bool {
+	return u.nopass
+}
+
+// CheckPassword reports whether the password is valid for the user
+func (u *User) CheckPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := hashPassword(password)
+	for _, p := range u.passwords {
+		if p == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRun reports whether the user is allowed to run the command belonging to the categories
+func (u *User) CanRun(command string, categories []string) bool {
+	allowed := false
+	for _, rule := range u.commandRules {
+		target := rule[1:]
+		matched := target == command || target == "@"+CategoryAll
+		for _, category := range categories {
+			matched = matched || target == "@"+category
+		}
+		if matched {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+// CanAccessKey reports whether the key matches one of the user's key patterns
+func (u *User) CanAccessKey(key string) bool {
+	for _, pattern := range u.keyPatterns {
+		if utils.GlobMatch(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flags returns the on/off and nopass flags
+func (u *User) Flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Passwords returns the password hashes
+func (u *User) Passwords() []string {
+	return append([]string(nil), u.passwords...)
+}
+
+// Commands returns the command rules, like "+@all -config"
+func (u *User) Commands() string {
+	if len(u.commandRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.commandRules, " ")
+}
+
+// Keys returns the key patterns, like "~app:* ~cache:*"
+func (u *User) Keys() string {
+	patterns := make([]string, len(u.keyPatterns))
+	for i, pattern := range u.keyPatterns {
+		patterns[i] = "~" + pattern
+	}
+	return strings.Join(patterns, " ")
+}
+
+// Describe returns the rules recreating the user, it's the format of ACL LIST and of the ACL file
+func (u *User) Describe() string {
+	parts := append([]string{"user", u.Name}, u.Flags()...)
+	for _, hash := range u.passwords {
+		parts = append(parts, "#"+hash)
+	}
+	if keys := u.Keys(); keys != "" {
+		parts = append(parts, keys)
+	}
+	return strings.Join(append(parts, u.Commands()), " ")
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.commandRules = append([]string(nil), u.commandRules...)
+	c.keyPatterns = append([]string(nil), u.keyPatterns...)
+	return &c
+}
+
+// apply changes the user according to one ACL SETUSER rule
+func (u *User) apply(rule string, commandExists func(name string) bool) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.keyPatterns = []string{"*"}
+		return nil
+	case "resetkeys":
+		u.keyPatterns = nil
+		return nil
+	case "allcommands":
+		return u.apply("+@all", commandExists)
+	case "nocommands":
+		return u.apply("-@all", commandExists)
+	case "reset":
+		*u = User{Name: u.Name}
+		return nil
+	}
+	if rule == "" {
+		return errors.New("empty rule")
+	}
+
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(rule[1:]))
+	case '<':
+		return u.removePassword(hashPassword(rule[1:]))
+	case '#':
+		hash := strings.ToLower(rule[1:])
+		if !isHash(hash) {
+			return errors.New("the password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPassword(hash)
+	case '!':
+		return u.removePassword(strings.ToLower(rule[1:]))
+	case '~':
+		pattern := rule[1:]
+		if contains(u.keyPatterns, "*") && pattern != "*" {
+			return errors.New("adding a pattern after the * pattern (or the 'allkeys' flag) is not valid")
+		}
+		if pattern == "*" {
+			u.keyPatterns = []string{"*"}
+		} else if !contains(u.keyPatterns, pattern) {
+			u.keyPatterns = append(u.keyPatterns, pattern)
+		}
+	case '+', '-':
+		return u.applyCommandRule(strings.ToLower(rule), commandExists)
+	default:
+		return errors.New("syntax error")
+	}
+	return nil
+}
+
+func (u *User) applyCommandRule(rule string, commandExists func(name string) bool) error {
+	target := rule[1:]
+	if strings.HasPrefix(target, "@") {
+		if !contains(categories, target[1:]) {
+			return errors.New("unknown command category '" + target[1:] + "'")
+		}
+	} else if !commandExists(target) {
+		return errors.New("unknown command '" + target + "'")
+	}
+	if target == "@"+CategoryAll {
+		// +@all and -@all override every previous rule
+		u.commandRules = []string{rule}
+		return nil
+	}
+	rules := u.commandRules[:0]
+	for _, r := range u.commandRules {
+		if r[1:] != target {
+			rules = append(rules, r)
+		}
+	}
+	u.commandRules = append(rules, rule)
+	return nil
+}
+
+func (u *User) addPassword(hash string) {
+	u.nopass = false
+	if !contains(u.passwords, hash) {
+		u.passwords = append(u.passwords, hash)
+	}
+}
+
+func (u *User) removePassword(hash string) error {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such password")
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func isHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/acl"
+	"github.com/miladbarzideh/goldis/internal/config"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type ACLCommand struct {
+	users  *acl.Registry
+	config *config.Config
+}
+
+func NewACLCommand(users *acl.Registry, config *config.Config) *ACLCommand {
+	return &ACLCommand{users: users, config: config}
+}
+
+// Execute command pattern: acl setuser username [rule ...] | acl getuser username | acl deluser username [username ...] |
+// acl list | acl users | acl whoami | acl load | acl save
+func (c *ACLCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	sub := strings.ToLower(args[0])
+	wrongArgs := resp.NewError("ERR wrong number of arguments for 'acl|" + sub + "' command")
+	switch sub {
+	case "setuser":
+		if len(args) < 2 {
+			return wrongArgs
+		}
+		if err := c.users.SetUser(args[1], args[2:]...); err != nil {
+			return resp.NewError("ERR " + err.Error())
+		}
+		return resp.OK()
+	case "getuser":
+		if len(args) != 2 {
+			return wrongArgs
+		}
+		return c.getUser(args[1])
+	case "deluser":
+		if len(args) < 2 {
+			return wrongArgs
+		}
+		deleted, err := c.users.DelUser(args[1:]...)
+		if err != nil {
+			return resp.NewError("ERR " + err.Error())
+		}
+		return resp.NewInteger(int64(deleted))
+	case "list", "users", "whoami", "load", "save":
+		if len(args) != 1 {
+			return wrongArgs
+		}
+		return c.noArgs(client, sub)
+	}
+	return resp.NewError("ERR unknown subcommand '" + args[0] + "'. Try ACL SETUSER, GETUSER, DELUSER, LIST, USERS, WHOAMI, LOAD or SAVE")
+}
+
+// noArgs runs the subcommands taking no argument
+func (c *ACLCommand) noArgs(client Client, sub string) resp.Value {
+	switch sub {
+	case "list":
+		return resp.NewBulkArray(c.users.List())
+	case "users":
+		return resp.NewBulkArray(c.users.Names())
+	case "whoami":
+		return resp.NewBulkString(clientUser(client))
+	}
+
+	if c.config.ACLFile == "" {
+		return resp.NewError("ERR This instance is not configured to use an ACL file, set aclfile in the configuration")
+	}
+	if sub == "load" {
+		if err := c.users.Load(c.config.ACLFile); err != nil {
+			return resp.NewError("ERR " + err.Error())
+		}
+		return resp.OK()
+	}
+	if err := c.users.Save(c.config.ACLFile); err != nil {
+		return resp.NewError("ERR There was an error trying to save the ACLs: " + err.Error())
+	}
+	return resp.OK()
+}
+
+func (c *ACLCommand) getUser(name string) resp.Value {
+	user := c.users.Get(name)
+	if user == nil {
+		return resp.NilBulkString()
+	}
+	return resp.NewMap(
+		resp.NewBulkString("flags"), resp.NewBulkSet(user.Flags()),
+		resp.NewBulkString("passwords"), resp.NewBulkArray(user.Passwords()),
+		resp.NewBulkString("commands"), resp.NewBulkString(user.Commands()),
+		resp.NewBulkString("keys"), resp.NewBulkString(user.Keys()),
+	)
+}
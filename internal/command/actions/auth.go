@@ -0,0 +1,53 @@
+package actions
+
+import (
+	"github.com/miladbarzideh/goldis/internal/acl"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+const NoAuthErrorMsg = "NOAUTH Authentication required."
+
+type AuthCommand struct {
+	users *acl.Registry
+}
+
+func NewAuthCommand(users *acl.Registry) *AuthCommand {
+	return &AuthCommand{users: users}
+}
+
+// Execute command pattern: auth [username] password
+func (c *AuthCommand) Execute(client Client, args []string) resp.Value {
+	switch len(args) {
+	case 1:
+		if c.users.Get(acl.DefaultUser).NoPass() {
+			return resp.NewError("ERR AUTH <password> called without any password configured for the default user. " +
+				"Are you sure your configuration is correct?")
+		}
+		return authenticate(c.users, client, acl.DefaultUser, args[0])
+	case 2:
+		return authenticate(c.users, client, args[0], args[1])
+	}
+	return syntaxError()
+}
+
+// authenticate checks the credentials and switches the client to the user when they are valid
+func authenticate(users *acl.Registry, client Client, username string, password string) resp.Value {
+	user, err := users.Authenticate(username, password)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	client.SetUser(user.Name)
+	return resp.OK()
+}
+
+type QuitCommand struct{}
+
+func NewQuitCommand() *QuitCommand {
+	return &QuitCommand{}
+}
+
+// Execute command pattern: quit
+func (c *QuitCommand) Execute(client Client, args []string) resp.Value {
+	client.CloseAfterReply()
+	return resp.OK()
+}
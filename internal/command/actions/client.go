@@ -0,0 +1,175 @@
+package actions
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/acl"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type ClientCommand struct {
+	server Server
+}
+
+func NewClientCommand(server Server) *ClientCommand {
+	return &ClientCommand{server: server}
+}
+
+// Execute command pattern: client list [id id ...] | client info | client id | client setname name | client getname |
+// client kill addr | client kill [id id] [addr addr] [user username] [skipme yes|no] |
+// client pause timeout [write|all] | client unpause
+func (c *ClientCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	sub := strings.ToLower(args[0])
+	switch {
+	case sub == "list":
+		return c.list(args[1:])
+	case sub == "info" && len(args) == 1:
+		return resp.NewBulkString(client.Info() + "\n")
+	case sub == "id" && len(args) == 1:
+		return resp.NewInteger(client.ID())
+	case sub == "setname" && len(args) == 2:
+		if !validClientName(args[1]) {
+			return resp.NewError("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+		client.SetName(args[1])
+		return resp.OK()
+	case sub == "getname" && len(args) == 1:
+		if client.Name() == "" {
+			return resp.NilBulkString()
+		}
+		return resp.NewBulkString(client.Name())
+	case sub == "kill" && len(args) == 2:
+		// the old form kills a single client by address
+		for _, other := range c.server.Clients() {
+			if other.RemoteAddr() == args[1] {
+				c.server.KillClient(other)
+				return resp.OK()
+			}
+		}
+		return resp.NewError("ERR No such client")
+	case sub == "kill" && len(args) > 2:
+		return c.kill(client, args[1:])
+	case sub == "pause" && (len(args) == 2 || len(args) == 3):
+		return c.pause(args[1:])
+	case sub == "unpause" && len(args) == 1:
+		c.server.UnpauseClients()
+		return resp.OK()
+	case sub == "list" || sub == "info" || sub == "id" || sub == "setname" || sub == "getname" ||
+		sub == "kill" || sub == "pause" || sub == "unpause":
+		return resp.NewError("ERR wrong number of arguments for 'client|" + sub + "' command")
+	}
+	return resp.NewError("ERR unknown subcommand '" + args[0] + "'. " +
+		"Try CLIENT LIST, INFO, ID, SETNAME, GETNAME, KILL, PAUSE or UNPAUSE")
+}
+
+func (c *ClientCommand) list(args []string) resp.Value {
+	ids := make(map[int64]bool)
+	if len(args) > 0 {
+		if strings.ToLower(args[0]) != "id" || len(args) < 2 {
+			return syntaxError()
+		}
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || id <= 0 {
+				return resp.NewError("ERR Invalid client ID")
+			}
+			ids[id] = true
+		}
+	}
+	var sb strings.Builder
+	for _, client := range c.server.Clients() {
+		if len(ids) == 0 || ids[client.ID()] {
+			sb.WriteString(client.Info())
+			sb.WriteByte('\n')
+		}
+	}
+	return resp.NewBulkString(sb.String())
+}
+
+// kill closes the clients matching every filter, the caller is skipped unless skipme is no
+func (c *ClientCommand) kill(caller Client, args []string) resp.Value {
+	if len(args)%2 != 0 {
+		return syntaxError()
+	}
+	var id int64
+	var addr, user string
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToLower(args[i]) {
+		case "id":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed <= 0 {
+				return resp.NewError("ERR client-id should be greater than 0")
+			}
+			id = parsed
+		case "addr":
+			addr = value
+		case "user":
+			user = value
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return syntaxError()
+			}
+		default:
+			return syntaxError()
+		}
+	}
+
+	killed := 0
+	for _, client := range c.server.Clients() {
+		if (id != 0 && client.ID() != id) || (addr != "" && client.RemoteAddr() != addr) ||
+			(user != "" && clientUser(client) != user) || (skipMe && client.ID() == caller.ID()) {
+			continue
+		}
+		c.server.KillClient(client)
+		killed++
+	}
+	return resp.NewInteger(int64(killed))
+}
+
+func (c *ClientCommand) pause(args []string) resp.Value {
+	timeout, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || timeout < 0 {
+		return resp.NewError("ERR timeout is not an integer or out of range")
+	}
+	writesOnly := false
+	if len(args) == 2 {
+		switch strings.ToLower(args[1]) {
+		case "write":
+			writesOnly = true
+		case "all":
+		default:
+			return syntaxError()
+		}
+	}
+	c.server.PauseClients(time.Duration(timeout)*time.Millisecond, writesOnly)
+	return resp.OK()
+}
+
+func clientUser(client Client) string {
+	if client.User() == "" {
+		return acl.DefaultUser
+	}
+	return client.User()
+}
+
+// validClientName rejects the names breaking the CLIENT LIST format
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,7 +1,94 @@
 package actions
 
-const SyntaxErrorMsg = "(error) ERR syntax error"
+import (
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+const SyntaxErrorMsg = "ERR syntax error"
 
 type Command interface {
-	Execute(args []string) string
+	Execute(client Client, args []string) resp.Value
+}
+
+// Client is the per-connection state that commands can read or update
+type Client interface {
+	Protocol() int
+	SetProtocol(version int)
+	// User is the ACL user the client authenticated as, empty before AUTH
+	User() string
+	SetUser(name string)
+	// CloseAfterReply closes the connection once the reply is sent, the next requests are ignored
+	CloseAfterReply()
+	ID() int64
+	RemoteAddr() string
+	Name() string
+	SetName(name string)
+	// Info describes the client in the CLIENT LIST format
+	Info() string
+	pubsub.Subscriber
+	// Subscribed reports whether the client is subscribed to a channel or a pattern
+	Subscribed() bool
+	// Transaction is the MULTI state of the client
+	Transaction() *Transaction
+	// Monitoring reports whether the client receives the executed commands since MONITOR
+	Monitoring() bool
+	SetMonitoring()
+}
+
+// Server is the server-wide state that commands can control
+type Server interface {
+	// Shutdown stops the server once the current requests are served
+	Shutdown(mode ShutdownMode)
+	// Clients returns the connected clients ordered by id
+	Clients() []Client
+	// KillClient closes the connection of a client once the current request is served
+	KillClient(client Client)
+	// PauseClients holds back the commands of every client, or only the write commands, for a while
+	PauseClients(d time.Duration, writesOnly bool)
+	UnpauseClients()
+	// Stats returns the server-wide counters
+	Stats() ServerStats
+	// Save writes the snapshot file, BackgroundSave writes it without blocking the clients
+	Save() error
+	BackgroundSave() error
+	// LastSave is the time of the last successful save
+	LastSave() time.Time
+	// BackgroundRewriteAOF compacts the append only file without blocking the clients
+	BackgroundRewriteAOF() error
+}
+
+// ServerStats are the counters of the server reported by INFO
+type ServerStats struct {
+	StartedAt        time.Time
+	ConnectedClients int
+	// TotalConnections counts the accepted connections, RejectedConnections the ones over a client limit
+	TotalConnections    int64
+	RejectedConnections int64
+	// HeapBytes and SysBytes are from the latest sample of the memory stats, it's read every second
+	HeapBytes uint64
+	SysBytes  uint64
+}
+
+func syntaxError() resp.Value {
+	return resp.NewError(SyntaxErrorMsg)
+}
+
+// zmembersReply flattens the members to a name, score, name, score, ... array
+func zmembersReply(members []datastore.ZMember) resp.Value {
+	elems := make([]resp.Value, 0, len(members)*2)
+	for _, member := range members {
+		elems = append(elems, resp.NewBulkString(member.Name), resp.NewDouble(member.Score))
+	}
+	return resp.NewArray(elems...)
+}
+
+func boolReply(b bool) resp.Value {
+	if b {
+		return resp.NewInteger(1)
+	}
+	return resp.NewInteger(0)
 }
@@ -0,0 +1,56 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/config"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type ConfigCommand struct {
+	config *config.Config
+}
+
+func NewConfigCommand(config *config.Config) *ConfigCommand {
+	return &ConfigCommand{config: config}
+}
+
+// Execute command pattern: config get pattern [pattern ...] | config set name value [name value ...] | config rewrite
+func (c *ConfigCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	switch strings.ToLower(args[0]) {
+	case "get":
+		if len(args) < 2 {
+			return syntaxError()
+		}
+		pairs := c.config.Match(args[1:]...)
+		kvs := make([]resp.Value, 0, len(pairs)*2)
+		for _, pair := range pairs {
+			kvs = append(kvs, resp.NewBulkString(pair[0]), resp.NewBulkString(pair[1]))
+		}
+		return resp.NewMap(kvs...)
+	case "set":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return syntaxError()
+		}
+		pairs := make([][2]string, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			pairs = append(pairs, [2]string{args[i], args[i+1]})
+		}
+		if err := c.config.Update(pairs); err != nil {
+			return resp.NewError("ERR CONFIG SET failed - " + err.Error())
+		}
+		return resp.OK()
+	case "rewrite":
+		if len(args) != 1 {
+			return syntaxError()
+		}
+		if err := c.config.Rewrite(); err != nil {
+			return resp.NewError("ERR Rewriting config file: " + err.Error())
+		}
+		return resp.OK()
+	}
+	return resp.NewError("ERR unknown subcommand '" + args[0] + "'. Try CONFIG GET, CONFIG SET or CONFIG REWRITE")
+}
@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type DelCommand struct {
@@ -12,9 +13,9 @@ func NewDelCommand(dataStore *datastore.DataStore) *DelCommand {
 	return &DelCommand{dataStore: dataStore}
 }
 
-func (c *DelCommand) Execute(args []string) string {
+func (c *DelCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 1 {
-		return c.dataStore.Delete(args[0])
+		return boolReply(c.dataStore.Delete(args[0]))
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
@@ -0,0 +1,78 @@
+package actions
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type DumpCommand struct {
+	dataStore *datastore.DataStore
+}
+
+func NewDumpCommand(dataStore *datastore.DataStore) *DumpCommand {
+	return &DumpCommand{dataStore: dataStore}
+}
+
+// Execute command pattern: dump key
+// The reply is the serialized value of the key, RESTORE recreates it
+func (c *DumpCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 1 {
+		return syntaxError()
+	}
+	entry, ok := c.dataStore.Entry(args[0])
+	if !ok {
+		return resp.NilBulkString()
+	}
+	return resp.NewBulkString(string(persistence.DumpPayload(entry)))
+}
+
+type RestoreCommand struct {
+	dataStore *datastore.DataStore
+}
+
+func NewRestoreCommand(dataStore *datastore.DataStore) *RestoreCommand {
+	return &RestoreCommand{dataStore: dataStore}
+}
+
+// Execute command pattern: restore key ttl payload [replace] [absttl]
+// The ttl is in milliseconds, 0 for no ttl, or the unix time in milliseconds the key expires at with ABSTTL
+func (c *RestoreCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 3 {
+		return syntaxError()
+	}
+	key := args[0]
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || ttl < 0 {
+		return resp.NewError("ERR Invalid TTL value, must be >= 0")
+	}
+	replace, absolute := false, false
+	for _, option := range args[3:] {
+		switch strings.ToLower(option) {
+		case "replace":
+			replace = true
+		case "absttl":
+			absolute = true
+		default:
+			return syntaxError()
+		}
+	}
+	if !replace && c.dataStore.Exists(key) {
+		return resp.NewError("BUSYKEY Target key name already exists.")
+	}
+	entry, err := persistence.ParsePayload(key, []byte(args[2]))
+	if err != nil {
+		return resp.NewError("ERR " + err.Error())
+	}
+	if ttl > 0 && !absolute {
+		ttl += time.Now().UnixMilli()
+	}
+	entry.ExpireAt = ttl
+	// a key restored with an expired ttl is deleted
+	c.dataStore.Restore(entry)
+	return resp.OK()
+}
@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type ExpireCommand struct {
@@ -14,13 +15,13 @@ func NewExpireCommand(dataStore *datastore.DataStore) *ExpireCommand {
 	return &ExpireCommand{dataStore: dataStore}
 }
 
-func (c *ExpireCommand) Execute(args []string) string {
+func (c *ExpireCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 2 {
 		ttl, err := strconv.Atoi(args[1])
 		if err != nil {
-			return SyntaxErrorMsg
+			return syntaxError()
 		}
-		return c.dataStore.Expire(args[0], int64(ttl))
+		return boolReply(c.dataStore.Expire(args[0], int64(ttl)))
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
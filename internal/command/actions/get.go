@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type GetCommand struct {
@@ -12,9 +13,16 @@ func NewGetCommand(dataStore *datastore.DataStore) *GetCommand {
 	return &GetCommand{dataStore: dataStore}
 }
 
-func (c *GetCommand) Execute(args []string) string {
+func (c *GetCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 1 {
-		return c.dataStore.Get(args[0])
+		value, err := c.dataStore.Get(args[0])
+		if err == datastore.ErrNotFound {
+			return resp.NilBulkString()
+		}
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		return resp.NewBulkString(value)
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
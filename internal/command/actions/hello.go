@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/acl"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+const (
+	ServerName    = "goldis"
+	ServerVersion = "0.2.0"
+)
+
+type HelloCommand struct {
+	users *acl.Registry
+}
+
+func NewHelloCommand(users *acl.Registry) *HelloCommand {
+	return &HelloCommand{users: users}
+}
+
+// Execute command pattern: hello [protover [auth username password] [setname clientname]]
+// It switches the connection to the requested protocol and replies with the server properties
+func (c *HelloCommand) Execute(client Client, args []string) resp.Value {
+	version := 0
+	if len(args) > 0 {
+		var err error
+		version, err = strconv.Atoi(args[0])
+		if err != nil {
+			return resp.NewError("ERR Protocol version is not an integer or out of range")
+		}
+		if version != resp.Version2 && version != resp.Version3 {
+			return resp.NewError("NOPROTO unsupported protocol version")
+		}
+	}
+	var username, password, name string
+	for i := 1; i < len(args); i++ {
+		switch option := strings.ToLower(args[i]); {
+		case option == "auth" && i+2 < len(args):
+			username, password = args[i+1], args[i+2]
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			name = args[i+1]
+			if !validClientName(name) {
+				return resp.NewError("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return syntaxError()
+		}
+	}
+
+	if username != "" {
+		if reply := authenticate(c.users, client, username, password); reply.IsError() {
+			return reply
+		}
+	} else if c.users.Resolve(client.User()) == nil {
+		return resp.NewError("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	if version != 0 {
+		client.SetProtocol(version)
+	}
+	if name != "" {
+		client.SetName(name)
+	}
+	return resp.NewMap(
+		resp.NewBulkString("server"), resp.NewBulkString(ServerName),
+		resp.NewBulkString("version"), resp.NewBulkString(ServerVersion),
+		resp.NewBulkString("proto"), resp.NewInteger(int64(client.Protocol())),
+		resp.NewBulkString("id"), resp.NewInteger(client.ID()),
+		resp.NewBulkString("mode"), resp.NewBulkString("standalone"),
+		resp.NewBulkString("role"), resp.NewBulkString("master"),
+		resp.NewBulkString("modules"), resp.NewArray(),
+	)
+}
@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/config"
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/internal/stats"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// infoSections are the sections of INFO in their order
+var infoSections = []string{"server", "clients", "memory", "stats", "keyspace"}
+
+type InfoCommand struct {
+	cfg       *config.Config
+	server    Server
+	dataStore *datastore.DataStore
+	hub       *pubsub.Hub
+	commands  *stats.Commands
+}
+
+func NewInfoCommand(cfg *config.Config, server Server, dataStore *datastore.DataStore, hub *pubsub.Hub,
+	commands *stats.Commands) *InfoCommand {
+	return &InfoCommand{cfg: cfg, server: server, dataStore: dataStore, hub: hub, commands: commands}
+}
+
+// Execute command pattern: info [section ...]
+// Every section is reported without argument or with all, default and everything
+func (c *InfoCommand) Execute(client Client, args []string) resp.Value {
+	selected := make(map[string]bool)
+	for _, arg := range args {
+		section := strings.ToLower(arg)
+		if section == "all" || section == "default" || section == "everything" {
+			args = nil
+			break
+		}
+		selected[section] = true
+	}
+
+	var sb strings.Builder
+	for _, section := range infoSections {
+		if len(args) > 0 && !selected[section] {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString("# " + strings.ToUpper(section[:1]) + section[1:] + "\r\n")
+		for _, field := range c.section(section) {
+			sb.WriteString(field[0] + ":" + field[1] + "\r\n")
+		}
+	}
+	return resp.NewBulkString(sb.String())
+}
+
+func (c *InfoCommand) section(name string) [][2]string {
+	now := time.Now()
+	serverStats := c.server.Stats()
+	switch name {
+	case "server":
+		uptime := int64(now.Sub(serverStats.StartedAt).Seconds())
+		return [][2]string{
+			{"goldis_version", ServerVersion},
+			{"go_version", runtime.Version()},
+			{"os", runtime.GOOS + " " + runtime.GOARCH},
+			{"process_id", fmt.Sprint(os.Getpid())},
+			{"tcp_port", fmt.Sprint(c.cfg.Port)},
+			{"server_time_usec", fmt.Sprint(now.UnixMicro())},
+			{"uptime_in_seconds", fmt.Sprint(uptime)},
+			{"uptime_in_days", fmt.Sprint(uptime / (24 * 3600))},
+			{"config_file", c.cfg.File},
+		}
+	case "clients":
+		return [][2]string{
+			{"connected_clients", fmt.Sprint(serverStats.ConnectedClients)},
+			{"maxclients", fmt.Sprint(c.cfg.MaxClients)},
+		}
+	case "memory":
+		return [][2]string{
+			{"used_memory", fmt.Sprint(serverStats.HeapBytes)},
+			{"used_memory_human", humanBytes(serverStats.HeapBytes)},
+			{"used_memory_sys", fmt.Sprint(serverStats.SysBytes)},
+			{"used_memory_sys_human", humanBytes(serverStats.SysBytes)},
+			{"lazyfree_pending_objects", fmt.Sprint(utils.GetThreadPoolInstance().Pending())},
+		}
+	case "stats":
+		keyspace := c.dataStore.Stats()
+		return [][2]string{
+			{"total_connections_received", fmt.Sprint(serverStats.TotalConnections)},
+			{"total_commands_processed", fmt.Sprint(c.commands.Total())},
+			{"instantaneous_ops_per_sec", fmt.Sprint(c.commands.OpsPerSec(now))},
+			{"rejected_connections", fmt.Sprint(serverStats.RejectedConnections)},
+			{"expired_keys", fmt.Sprint(keyspace.Expired)},
+			{"keyspace_hits", fmt.Sprint(keyspace.Hits)},
+			{"keyspace_misses", fmt.Sprint(keyspace.Misses)},
+			{"pubsub_channels", fmt.Sprint(len(c.hub.ActiveChannels("")))},
+			{"pubsub_patterns", fmt.Sprint(c.hub.NumPat())},
+			{"latest_keyspace_copy_usec", fmt.Sprint(keyspace.LatestCopy.Microseconds())},
+		}
+	case "keyspace":
+		keyspace := c.dataStore.Stats()
+		if keyspace.Keys() == 0 {
+			return nil
+		}
+		return [][2]string{
+			{"db0", fmt.Sprintf("keys=%d,expires=%d,strings=%d,zsets=%d",
+				keyspace.Keys(), keyspace.Expires, keyspace.Strings, keyspace.ZSets)},
+		}
+	}
+	return nil
+}
+
+// humanBytes formats a size like 1.50M
+func humanBytes(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.2f%s", size, units[unit])
+}
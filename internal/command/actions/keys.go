@@ -1,6 +1,9 @@
 package actions
 
-import "github.com/miladbarzideh/goldis/internal/datastore"
+import (
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
 
 type KeysCommand struct {
 	dataStore *datastore.DataStore
@@ -10,6 +13,6 @@ func NewKeysCommand(dataStore *datastore.DataStore) *KeysCommand {
 	return &KeysCommand{dataStore: dataStore}
 }
 
-func (c *KeysCommand) Execute(args []string) string {
-	return c.dataStore.Keys()
+func (c *KeysCommand) Execute(client Client, args []string) resp.Value {
+	return resp.NewBulkSet(c.dataStore.Keys())
 }
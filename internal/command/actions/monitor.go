@@ -0,0 +1,27 @@
+package actions
+
+import (
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type MonitorCommand struct {
+	// monitor adds the client to the ones receiving the executed commands
+	monitor func(client Client)
+}
+
+func NewMonitorCommand(monitor func(client Client)) *MonitorCommand {
+	return &MonitorCommand{monitor: monitor}
+}
+
+// Execute command pattern: monitor
+// The client then receives every command executed by the server until it disconnects
+func (c *MonitorCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	if !client.Monitoring() {
+		client.SetMonitoring()
+		c.monitor(client)
+	}
+	return resp.OK()
+}
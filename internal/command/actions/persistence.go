@@ -0,0 +1,80 @@
+package actions
+
+import (
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type SaveCommand struct {
+	server Server
+}
+
+func NewSaveCommand(server Server) *SaveCommand {
+	return &SaveCommand{server: server}
+}
+
+// Execute command pattern: save
+// The snapshot is written before replying, the other clients wait
+func (c *SaveCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	if err := c.server.Save(); err != nil {
+		return resp.NewError("ERR " + err.Error())
+	}
+	return resp.OK()
+}
+
+type BackgroundSaveCommand struct {
+	server Server
+}
+
+func NewBackgroundSaveCommand(server Server) *BackgroundSaveCommand {
+	return &BackgroundSaveCommand{server: server}
+}
+
+// Execute command pattern: bgsave
+func (c *BackgroundSaveCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	if err := c.server.BackgroundSave(); err != nil {
+		return resp.NewError("ERR " + err.Error())
+	}
+	return resp.NewSimpleString("Background saving started")
+}
+
+type LastSaveCommand struct {
+	server Server
+}
+
+func NewLastSaveCommand(server Server) *LastSaveCommand {
+	return &LastSaveCommand{server: server}
+}
+
+// Execute command pattern: lastsave
+// The reply is the unix time of the last successful save
+func (c *LastSaveCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	return resp.NewInteger(c.server.LastSave().Unix())
+}
+
+type RewriteAOFCommand struct {
+	server Server
+}
+
+func NewRewriteAOFCommand(server Server) *RewriteAOFCommand {
+	return &RewriteAOFCommand{server: server}
+}
+
+// Execute command pattern: bgrewriteaof
+func (c *RewriteAOFCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	if err := c.server.BackgroundRewriteAOF(); err != nil {
+		return resp.NewError("ERR " + err.Error())
+	}
+	return resp.NewSimpleString("Background append only file rewriting started")
+}
@@ -0,0 +1,157 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type SubscribeCommand struct {
+	hub     *pubsub.Hub
+	pattern bool
+}
+
+// NewSubscribeCommand creates SUBSCRIBE, or PSUBSCRIBE when pattern is set
+func NewSubscribeCommand(hub *pubsub.Hub, pattern bool) *SubscribeCommand {
+	return &SubscribeCommand{hub: hub, pattern: pattern}
+}
+
+// Execute command pattern: subscribe channel [channel ...] | psubscribe pattern [pattern ...]
+// Every subscription is confirmed by a push
+func (c *SubscribeCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	kind := "subscribe"
+	if c.pattern {
+		kind = "psubscribe"
+	}
+	for _, name := range args {
+		var count int
+		if c.pattern {
+			count = c.hub.PSubscribe(client, name)
+		} else {
+			count = c.hub.Subscribe(client, name)
+		}
+		client.Push(resp.NewPush(resp.NewBulkString(kind), resp.NewBulkString(name), resp.NewInteger(int64(count))))
+	}
+	return resp.NoReply()
+}
+
+type UnsubscribeCommand struct {
+	hub     *pubsub.Hub
+	pattern bool
+}
+
+// NewUnsubscribeCommand creates UNSUBSCRIBE, or PUNSUBSCRIBE when pattern is set
+func NewUnsubscribeCommand(hub *pubsub.Hub, pattern bool) *UnsubscribeCommand {
+	return &UnsubscribeCommand{hub: hub, pattern: pattern}
+}
+
+// Execute command pattern: unsubscribe [channel ...] | punsubscribe [pattern ...]
+// Without argument the client is unsubscribed from every channel, or every pattern
+func (c *UnsubscribeCommand) Execute(client Client, args []string) resp.Value {
+	kind := "unsubscribe"
+	names := args
+	if c.pattern {
+		kind = "punsubscribe"
+	}
+	if len(names) == 0 {
+		if c.pattern {
+			names = c.hub.Patterns(client)
+		} else {
+			names = c.hub.Channels(client)
+		}
+	}
+	if len(names) == 0 {
+		client.Push(resp.NewPush(resp.NewBulkString(kind), resp.NilBulkString(), resp.NewInteger(int64(c.hub.Count(client)))))
+		return resp.NoReply()
+	}
+	for _, name := range names {
+		var count int
+		if c.pattern {
+			count = c.hub.PUnsubscribe(client, name)
+		} else {
+			count = c.hub.Unsubscribe(client, name)
+		}
+		client.Push(resp.NewPush(resp.NewBulkString(kind), resp.NewBulkString(name), resp.NewInteger(int64(count))))
+	}
+	return resp.NoReply()
+}
+
+type PublishCommand struct {
+	hub *pubsub.Hub
+}
+
+func NewPublishCommand(hub *pubsub.Hub) *PublishCommand {
+	return &PublishCommand{hub: hub}
+}
+
+// Execute command pattern: publish channel message
+// It replies with the number of clients that received the message
+func (c *PublishCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) == 2 {
+		return resp.NewInteger(int64(c.hub.Publish(args[0], args[1])))
+	}
+	return syntaxError()
+}
+
+type PubSubCommand struct {
+	hub *pubsub.Hub
+}
+
+func NewPubSubCommand(hub *pubsub.Hub) *PubSubCommand {
+	return &PubSubCommand{hub: hub}
+}
+
+// Execute command pattern: pubsub channels [pattern] | pubsub numsub [channel ...] | pubsub numpat
+func (c *PubSubCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	switch sub := strings.ToLower(args[0]); {
+	case sub == "channels" && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = args[1]
+		}
+		return resp.NewBulkArray(c.hub.ActiveChannels(pattern))
+	case sub == "numsub":
+		kvs := make([]resp.Value, 0, 2*(len(args)-1))
+		for _, channel := range args[1:] {
+			kvs = append(kvs, resp.NewBulkString(channel), resp.NewInteger(int64(c.hub.NumSub(channel))))
+		}
+		return resp.NewMap(kvs...)
+	case sub == "numpat" && len(args) == 1:
+		return resp.NewInteger(int64(c.hub.NumPat()))
+	case sub == "channels" || sub == "numpat":
+		return resp.NewError("ERR wrong number of arguments for 'pubsub|" + sub + "' command")
+	}
+	return resp.NewError("ERR unknown subcommand '" + args[0] + "'. Try PUBSUB CHANNELS, NUMSUB or NUMPAT")
+}
+
+type PingCommand struct{}
+
+func NewPingCommand() *PingCommand {
+	return &PingCommand{}
+}
+
+// Execute command pattern: ping [message]
+func (c *PingCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) > 1 {
+		return syntaxError()
+	}
+	if client.Subscribed() && client.Protocol() < resp.Version3 {
+		// a RESP2 subscriber can only read pushes
+		message := ""
+		if len(args) == 1 {
+			message = args[0]
+		}
+		return resp.NewArray(resp.NewBulkString("pong"), resp.NewBulkString(message))
+	}
+	if len(args) == 1 {
+		return resp.NewBulkString(args[0])
+	}
+	return resp.NewSimpleString("PONG")
+}
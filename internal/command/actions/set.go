@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type SetCommand struct {
@@ -12,9 +13,10 @@ func NewSetCommand(dataStore *datastore.DataStore) *SetCommand {
 	return &SetCommand{dataStore: dataStore}
 }
 
-func (c *SetCommand) Execute(args []string) string {
+func (c *SetCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 2 {
-		return c.dataStore.Set(args[0], args[1])
+		c.dataStore.Set(args[0], args[1])
+		return resp.OK()
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
@@ -0,0 +1,46 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+// ShutdownMode tells the shutdown hooks whether the dataset should be saved
+type ShutdownMode int
+
+const (
+	// ShutdownDefault saves the dataset when saving is configured
+	ShutdownDefault ShutdownMode = iota
+	ShutdownSave
+	ShutdownNoSave
+)
+
+type ShutdownCommand struct {
+	server Server
+}
+
+func NewShutdownCommand(server Server) *ShutdownCommand {
+	return &ShutdownCommand{server: server}
+}
+
+// Execute command pattern: shutdown [save|nosave]
+// Nothing is replied, the connection is closed when the server stops
+func (c *ShutdownCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) > 1 {
+		return syntaxError()
+	}
+	mode := ShutdownDefault
+	if len(args) == 1 {
+		switch strings.ToLower(args[0]) {
+		case "save":
+			mode = ShutdownSave
+		case "nosave":
+			mode = ShutdownNoSave
+		default:
+			return syntaxError()
+		}
+	}
+	c.server.Shutdown(mode)
+	return resp.NoReply()
+}
@@ -0,0 +1,59 @@
+package actions
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/internal/slowlog"
+)
+
+const defaultSlowLogCount = 10
+
+type SlowLogCommand struct {
+	log *slowlog.Log
+}
+
+func NewSlowLogCommand(log *slowlog.Log) *SlowLogCommand {
+	return &SlowLogCommand{log: log}
+}
+
+// Execute command pattern: slowlog get [count] | slowlog len | slowlog reset
+// An entry is [id, unix time, duration in microseconds, arguments, client address, client name]
+func (c *SlowLogCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	switch sub := strings.ToLower(args[0]); {
+	case sub == "get" && len(args) <= 2:
+		count := defaultSlowLogCount
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < -1 {
+				return resp.NewError("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		entries := c.log.Get(count)
+		replies := make([]resp.Value, len(entries))
+		for i, entry := range entries {
+			replies[i] = resp.NewArray(
+				resp.NewInteger(entry.ID),
+				resp.NewInteger(entry.Time.Unix()),
+				resp.NewInteger(entry.Duration.Microseconds()),
+				resp.NewBulkArray(entry.Args),
+				resp.NewBulkString(entry.ClientAddr),
+				resp.NewBulkString(entry.ClientName),
+			)
+		}
+		return resp.NewArray(replies...)
+	case sub == "len" && len(args) == 1:
+		return resp.NewInteger(int64(c.log.Len()))
+	case sub == "reset" && len(args) == 1:
+		c.log.Reset()
+		return resp.OK()
+	case sub == "get" || sub == "len" || sub == "reset":
+		return resp.NewError("ERR wrong number of arguments for 'slowlog|" + sub + "' command")
+	}
+	return resp.NewError("ERR unknown subcommand '" + args[0] + "'. Try SLOWLOG GET, LEN or RESET")
+}
@@ -0,0 +1,173 @@
+package actions
+
+import (
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+const execAbortMsg = "EXECABORT Transaction discarded because of previous errors."
+
+// Transaction holds the requests queued after MULTI and the keys watched by the client
+type Transaction struct {
+	// Active is set by MULTI, the next requests are queued until EXEC or DISCARD
+	Active bool
+	Queued [][]string
+	// Aborted is set when a request couldn't be queued, EXEC then discards the transaction
+	Aborted bool
+	// watched are the versions of the watched keys when WATCH was called
+	watched map[string]uint64
+}
+
+// Queue adds a request to the transaction
+func (t *Transaction) Queue(request []string) {
+	t.Queued = append(t.Queued, request)
+}
+
+// Unwatch forgets the watched keys, it must be called when the client disconnects
+func (t *Transaction) Unwatch(dataStore *datastore.DataStore) {
+	for key := range t.watched {
+		dataStore.Unwatch(key)
+	}
+	t.watched = nil
+}
+
+// reset ends the transaction and forgets the watched keys
+func (t *Transaction) reset(dataStore *datastore.DataStore) {
+	t.Unwatch(dataStore)
+	*t = Transaction{}
+}
+
+// touched reports whether a watched key changed since WATCH
+func (t *Transaction) touched(dataStore *datastore.DataStore) bool {
+	for key, version := range t.watched {
+		if dataStore.Version(key) != version {
+			return true
+		}
+	}
+	return false
+}
+
+type MultiCommand struct{}
+
+func NewMultiCommand() *MultiCommand {
+	return &MultiCommand{}
+}
+
+// Execute command pattern: multi
+func (c *MultiCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	tx := client.Transaction()
+	if tx.Active {
+		return resp.NewError("ERR MULTI calls can not be nested")
+	}
+	tx.Active = true
+	return resp.OK()
+}
+
+type ExecCommand struct {
+	dataStore *datastore.DataStore
+	// run executes a queued request like a request received from the client
+	run func(client Client, request []string) resp.Value
+}
+
+func NewExecCommand(dataStore *datastore.DataStore, run func(client Client, request []string) resp.Value) *ExecCommand {
+	return &ExecCommand{dataStore: dataStore, run: run}
+}
+
+// Execute command pattern: exec
+// The queued requests run back-to-back, nothing else runs in between on the event loop.
+// The reply is nil when a watched key changed
+func (c *ExecCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	tx := client.Transaction()
+	if !tx.Active {
+		return resp.NewError("ERR EXEC without MULTI")
+	}
+	queued, aborted, touched := tx.Queued, tx.Aborted, tx.touched(c.dataStore)
+	tx.reset(c.dataStore)
+	if aborted {
+		return resp.NewError(execAbortMsg)
+	}
+	if touched {
+		return resp.NilArray()
+	}
+	replies := make([]resp.Value, 0, len(queued))
+	for _, request := range queued {
+		// SUBSCRIBE sends its replies by itself
+		if reply := c.run(client, request); !reply.IsNoReply() {
+			replies = append(replies, reply)
+		}
+	}
+	return resp.NewArray(replies...)
+}
+
+type DiscardCommand struct {
+	dataStore *datastore.DataStore
+}
+
+func NewDiscardCommand(dataStore *datastore.DataStore) *DiscardCommand {
+	return &DiscardCommand{dataStore: dataStore}
+}
+
+// Execute command pattern: discard
+func (c *DiscardCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	tx := client.Transaction()
+	if !tx.Active {
+		return resp.NewError("ERR DISCARD without MULTI")
+	}
+	tx.reset(c.dataStore)
+	return resp.OK()
+}
+
+type WatchCommand struct {
+	dataStore *datastore.DataStore
+}
+
+func NewWatchCommand(dataStore *datastore.DataStore) *WatchCommand {
+	return &WatchCommand{dataStore: dataStore}
+}
+
+// Execute command pattern: watch key [key ...]
+// EXEC aborts when one of the keys changes before it runs
+func (c *WatchCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) < 1 {
+		return syntaxError()
+	}
+	tx := client.Transaction()
+	if tx.Active {
+		return resp.NewError("ERR WATCH inside MULTI is not allowed")
+	}
+	if tx.watched == nil {
+		tx.watched = make(map[string]uint64, len(args))
+	}
+	for _, key := range args {
+		if _, ok := tx.watched[key]; !ok {
+			tx.watched[key] = c.dataStore.Watch(key)
+		}
+	}
+	return resp.OK()
+}
+
+type UnwatchCommand struct {
+	dataStore *datastore.DataStore
+}
+
+func NewUnwatchCommand(dataStore *datastore.DataStore) *UnwatchCommand {
+	return &UnwatchCommand{dataStore: dataStore}
+}
+
+// Execute command pattern: unwatch
+func (c *UnwatchCommand) Execute(client Client, args []string) resp.Value {
+	if len(args) != 0 {
+		return syntaxError()
+	}
+	client.Transaction().Unwatch(c.dataStore)
+	return resp.OK()
+}
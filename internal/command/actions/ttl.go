@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type TTLCommand struct {
@@ -12,9 +13,9 @@ func NewTTLCommand(dataStore *datastore.DataStore) *TTLCommand {
 	return &TTLCommand{dataStore: dataStore}
 }
 
-func (c *TTLCommand) Execute(args []string) string {
+func (c *TTLCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 1 {
-		return c.dataStore.Ttl(args[0])
+		return resp.NewInteger(c.dataStore.Ttl(args[0]))
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type ZAddCommand struct {
@@ -14,13 +15,17 @@ func NewZAddCommand(dataStore *datastore.DataStore) *ZAddCommand {
 	return &ZAddCommand{dataStore: dataStore}
 }
 
-func (c *ZAddCommand) Execute(args []string) string {
+func (c *ZAddCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 3 {
 		score, err := strconv.ParseFloat(args[1], 64)
 		if err != nil {
-			return SyntaxErrorMsg
+			return syntaxError()
 		}
-		return c.dataStore.ZAdd(args[0], score, args[2])
+		added, err := c.dataStore.ZAdd(args[0], score, args[2])
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		return boolReply(added)
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
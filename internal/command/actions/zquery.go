@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type ZQueryCommand struct {
@@ -14,21 +15,22 @@ func NewZQueryCommand(dataStore *datastore.DataStore) *ZQueryCommand {
 	return &ZQueryCommand{dataStore: dataStore}
 }
 
-func (c *ZQueryCommand) Execute(args []string) string {
+func (c *ZQueryCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 5 {
 		score, err := strconv.ParseFloat(args[1], 64)
 		if err != nil {
-			return SyntaxErrorMsg
+			return syntaxError()
 		}
 		offset, err := strconv.Atoi(args[3])
 		if err != nil {
-			return SyntaxErrorMsg
+			return syntaxError()
 		}
 		limit, err := strconv.Atoi(args[4])
 		if err != nil {
-			return SyntaxErrorMsg
+			return syntaxError()
 		}
-		return c.dataStore.ZQuery(args[0], score, args[2], int32(uint32(offset)), uint32(limit))
+		members, _ := c.dataStore.ZQuery(args[0], score, args[2], int32(uint32(offset)), uint32(limit))
+		return zmembersReply(members)
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type ZRemCommand struct {
@@ -12,9 +13,9 @@ func NewZRemCommand(dataStore *datastore.DataStore) *ZRemCommand {
 	return &ZRemCommand{dataStore: dataStore}
 }
 
-func (c *ZRemCommand) Execute(args []string) string {
+func (c *ZRemCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 2 {
-		return c.dataStore.ZRemove(args[0], args[1])
+		return boolReply(c.dataStore.ZRemove(args[0], args[1]))
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
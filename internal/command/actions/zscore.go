@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type ZScoreCommand struct {
@@ -12,9 +13,13 @@ func NewZScoreCommand(dataStore *datastore.DataStore) *ZScoreCommand {
 	return &ZScoreCommand{dataStore: dataStore}
 }
 
-func (c *ZScoreCommand) Execute(args []string) string {
+func (c *ZScoreCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 2 {
-		return c.dataStore.ZScore(args[0], args[1])
+		score, ok := c.dataStore.ZScore(args[0], args[1])
+		if !ok {
+			return resp.NilBulkString()
+		}
+		return resp.NewDouble(score)
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
@@ -2,6 +2,7 @@ package actions
 
 import (
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
 type ZShowCommand struct {
@@ -12,9 +13,10 @@ func NewZShowCommand(dataStore *datastore.DataStore) *ZShowCommand {
 	return &ZShowCommand{dataStore: dataStore}
 }
 
-func (c *ZShowCommand) Execute(args []string) string {
+func (c *ZShowCommand) Execute(client Client, args []string) resp.Value {
 	if len(args) == 1 {
-		return c.dataStore.ZShow(args[0])
+		members, _ := c.dataStore.ZShow(args[0])
+		return zmembersReply(members)
 	}
-	return SyntaxErrorMsg
+	return syntaxError()
 }
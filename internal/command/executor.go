@@ -1,69 +1,373 @@
 package command
 
 import (
-	"log"
-	"regexp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/miladbarzideh/goldis/internal/acl"
 	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/internal/config"
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/internal/slowlog"
+	"github.com/miladbarzideh/goldis/internal/stats"
+	"github.com/miladbarzideh/goldis/utils"
 )
 
 const (
-	getCommand    = "get"
-	setCommand    = "set"
-	delCommand    = "del"
-	keysCommand   = "keys"
-	zaddCommand   = "zadd"
-	zremCommand   = "zrem"
-	zscoreCommand = "zscore"
-	zqueryCommand = "zquery"
-	zshowCommand  = "zshow"
-	expireCommand = "pexpire"
-	ttlCommand    = "pttl"
+	getCommand          = "get"
+	setCommand          = "set"
+	delCommand          = "del"
+	keysCommand         = "keys"
+	zaddCommand         = "zadd"
+	zremCommand         = "zrem"
+	zscoreCommand       = "zscore"
+	zqueryCommand       = "zquery"
+	zshowCommand        = "zshow"
+	expireCommand       = "pexpire"
+	ttlCommand          = "pttl"
+	helloCommand        = "hello"
+	configCommand       = "config"
+	shutdownCommand     = "shutdown"
+	authCommand         = "auth"
+	quitCommand         = "quit"
+	aclCommand          = "acl"
+	clientCommand       = "client"
+	pingCommand         = "ping"
+	subscribeCommand    = "subscribe"
+	unsubscribeCommand  = "unsubscribe"
+	psubscribeCommand   = "psubscribe"
+	punsubscribeCommand = "punsubscribe"
+	publishCommand      = "publish"
+	pubsubCommand       = "pubsub"
+	multiCommand        = "multi"
+	execCommand         = "exec"
+	discardCommand      = "discard"
+	watchCommand        = "watch"
+	unwatchCommand      = "unwatch"
+	monitorCommand      = "monitor"
+	slowlogCommand      = "slowlog"
+	infoCommand         = "info"
+	saveCommand         = "save"
+	bgsaveCommand       = "bgsave"
+	lastsaveCommand     = "lastsave"
+	bgrewriteaofCommand = "bgrewriteaof"
+	dumpCommand         = "dump"
+	restoreCommand      = "restore"
 )
 
+// noAuthCommands can run before the client is authenticated
+var noAuthCommands = map[string]bool{authCommand: true, helloCommand: true, quitCommand: true}
+
+// subscriberCommands are the only commands a RESP2 client can run while subscribed
+var subscriberCommands = map[string]bool{
+	subscribeCommand: true, unsubscribeCommand: true, psubscribeCommand: true, punsubscribeCommand: true,
+	pingCommand: true, quitCommand: true,
+}
+
+// transactionCommands run immediately after MULTI, the other commands are queued
+var transactionCommands = map[string]bool{
+	multiCommand: true, execCommand: true, discardCommand: true, watchCommand: true, quitCommand: true,
+}
+
+// redactedCommands carry passwords, their arguments aren't shown to the monitors nor kept in the slow log
+var redactedCommands = map[string]bool{authCommand: true, helloCommand: true}
+
+// AppendLog logs the write commands that succeeded
+type AppendLog interface {
+	Append(commands ...[]string) error
+	// WriteError returns the error of the last write, nil once a write succeeds
+	WriteError() error
+}
+
 type Executor struct {
 	dataSource *datastore.DataStore
 	commands   map[string]actions.Command
+	specs      map[string]Spec
+	users      *acl.Registry
+	// monitors receive every executed command
+	monitors map[actions.Client]bool
+	slowLog  *slowlog.Log
+	stats    *stats.Commands
+	// appendLog receives the write commands that succeeded, nil when nothing logs them
+	appendLog AppendLog
+	// execLog buffers the write commands run by EXEC, nil outside of EXEC
+	execLog [][]string
 }
 
-func NewExecutor(dataStore *datastore.DataStore) *Executor {
+func NewExecutor(dataStore *datastore.DataStore, cfg *config.Config, server actions.Server, hub *pubsub.Hub) *Executor {
 	handler := &Executor{
 		dataSource: dataStore,
 		commands:   make(map[string]actions.Command),
+		specs:      make(map[string]Spec),
+		monitors:   make(map[actions.Client]bool),
+		slowLog:    slowlog.New(),
+		stats:      stats.NewCommands(),
 	}
-	handler.RegisterCommand(setCommand, actions.NewSetCommand(dataStore))
-	handler.RegisterCommand(getCommand, actions.NewGetCommand(dataStore))
-	handler.RegisterCommand(delCommand, actions.NewDelCommand(dataStore))
-	handler.RegisterCommand(keysCommand, actions.NewKeysCommand(dataStore))
-	handler.RegisterCommand(zaddCommand, actions.NewZAddCommand(dataStore))
-	handler.RegisterCommand(zremCommand, actions.NewZRemCommand(dataStore))
-	handler.RegisterCommand(zscoreCommand, actions.NewZScoreCommand(dataStore))
-	handler.RegisterCommand(zqueryCommand, actions.NewZQueryCommand(dataStore))
-	handler.RegisterCommand(zshowCommand, actions.NewZShowCommand(dataStore))
-	handler.RegisterCommand(expireCommand, actions.NewExpireCommand(dataStore))
-	handler.RegisterCommand(ttlCommand, actions.NewTTLCommand(dataStore))
+	handler.users = acl.NewRegistry(handler.hasCommand)
+	read, write := acl.CategoryRead, acl.CategoryWrite
+	str, zset, keyspace := acl.CategoryString, acl.CategorySortedSet, acl.CategoryKeyspace
+	fast, slow := acl.CategoryFast, acl.CategorySlow
+	handler.RegisterCommand(setCommand, actions.NewSetCommand(dataStore), keyCommand(write, str, slow))
+	handler.RegisterCommand(getCommand, actions.NewGetCommand(dataStore), keyCommand(read, str, fast))
+	handler.RegisterCommand(delCommand, actions.NewDelCommand(dataStore), keyCommand(write, keyspace, slow))
+	handler.RegisterCommand(keysCommand, actions.NewKeysCommand(dataStore),
+		Spec{Categories: []string{read, keyspace, slow, acl.CategoryDangerous}})
+	handler.RegisterCommand(zaddCommand, actions.NewZAddCommand(dataStore), keyCommand(write, zset, fast))
+	handler.RegisterCommand(zremCommand, actions.NewZRemCommand(dataStore), keyCommand(write, zset, fast))
+	handler.RegisterCommand(zscoreCommand, actions.NewZScoreCommand(dataStore), keyCommand(read, zset, fast))
+	handler.RegisterCommand(zqueryCommand, actions.NewZQueryCommand(dataStore), keyCommand(read, zset, slow))
+	handler.RegisterCommand(zshowCommand, actions.NewZShowCommand(dataStore), keyCommand(read, zset, slow))
+	handler.RegisterCommand(expireCommand, actions.NewExpireCommand(dataStore), keyCommand(write, keyspace, fast))
+	handler.RegisterCommand(ttlCommand, actions.NewTTLCommand(dataStore), keyCommand(read, keyspace, fast))
+	handler.RegisterCommand(helloCommand, actions.NewHelloCommand(handler.users), connectionCommand())
+	handler.RegisterCommand(configCommand, actions.NewConfigCommand(cfg), adminCommand())
+	handler.RegisterCommand(shutdownCommand, actions.NewShutdownCommand(server), adminCommand())
+	handler.RegisterCommand(authCommand, actions.NewAuthCommand(handler.users), connectionCommand())
+	handler.RegisterCommand(quitCommand, actions.NewQuitCommand(), connectionCommand())
+	handler.RegisterCommand(aclCommand, actions.NewACLCommand(handler.users, cfg), adminCommand())
+	handler.RegisterCommand(clientCommand, actions.NewClientCommand(server), clientCommandSpec())
+	handler.RegisterCommand(pingCommand, actions.NewPingCommand(), connectionCommand())
+	handler.RegisterCommand(subscribeCommand, actions.NewSubscribeCommand(hub, false), pubsubCommandSpec())
+	handler.RegisterCommand(unsubscribeCommand, actions.NewUnsubscribeCommand(hub, false), pubsubCommandSpec())
+	handler.RegisterCommand(psubscribeCommand, actions.NewSubscribeCommand(hub, true), pubsubCommandSpec())
+	handler.RegisterCommand(punsubscribeCommand, actions.NewUnsubscribeCommand(hub, true), pubsubCommandSpec())
+	handler.RegisterCommand(publishCommand, actions.NewPublishCommand(hub), pubsubCommandSpec())
+	handler.RegisterCommand(pubsubCommand, actions.NewPubSubCommand(hub), pubsubCommandSpec())
+	handler.RegisterCommand(multiCommand, actions.NewMultiCommand(), transactionCommand())
+	handler.RegisterCommand(execCommand, actions.NewExecCommand(dataStore, handler.run),
+		Spec{Categories: []string{acl.CategoryTransaction, slow}})
+	handler.RegisterCommand(discardCommand, actions.NewDiscardCommand(dataStore), transactionCommand())
+	handler.RegisterCommand(watchCommand, actions.NewWatchCommand(dataStore),
+		Spec{Categories: []string{acl.CategoryTransaction, fast}, FirstKey: 1, LastKey: -1, KeyStep: 1})
+	handler.RegisterCommand(unwatchCommand, actions.NewUnwatchCommand(dataStore), transactionCommand())
+	handler.RegisterCommand(monitorCommand, actions.NewMonitorCommand(handler.addMonitor), adminCommand())
+	handler.RegisterCommand(slowlogCommand, actions.NewSlowLogCommand(handler.slowLog), adminCommand())
+	handler.RegisterCommand(infoCommand, actions.NewInfoCommand(cfg, server, dataStore, hub, handler.stats),
+		Spec{Categories: []string{slow, acl.CategoryDangerous}})
+	handler.RegisterCommand(saveCommand, actions.NewSaveCommand(server), adminCommand())
+	handler.RegisterCommand(bgsaveCommand, actions.NewBackgroundSaveCommand(server), adminCommand())
+	handler.RegisterCommand(lastsaveCommand, actions.NewLastSaveCommand(server),
+		Spec{Categories: []string{acl.CategoryAdmin, fast, acl.CategoryDangerous}})
+	handler.RegisterCommand(bgrewriteaofCommand, actions.NewRewriteAOFCommand(server), adminCommand())
+	handler.RegisterCommand(dumpCommand, actions.NewDumpCommand(dataStore), keyCommand(read, keyspace, slow))
+	handler.RegisterCommand(restoreCommand, actions.NewRestoreCommand(dataStore),
+		keyCommand(write, keyspace, slow, acl.CategoryDangerous))
 	return handler
 }
 
-func (h *Executor) RegisterCommand(key string, command actions.Command) {
+func (h *Executor) RegisterCommand(key string, command actions.Command, spec Spec) {
 	h.commands[key] = command
+	h.specs[key] = spec
+}
+
+// ACL returns the users allowed to run the commands
+func (h *Executor) ACL() *acl.Registry {
+	return h.users
+}
+
+// SlowLog returns the log of the commands slower than its threshold
+func (h *Executor) SlowLog() *slowlog.Log {
+	return h.slowLog
+}
+
+// CommandStats returns the counters of the executed commands
+func (h *Executor) CommandStats() *stats.Commands {
+	return h.stats
+}
+
+// SetAppendLog sets the log of the write commands that succeeded, the writes of a transaction
+// are logged at once between MULTI and EXEC. The write commands are refused while the log can't be written
+func (h *Executor) SetAppendLog(appendLog AppendLog) {
+	h.appendLog = appendLog
+}
+
+// Pausable reports whether CLIENT PAUSE holds the request back, the connection commands
+// and the ones marked NoPause always run so that a client can still unpause.
+// The requests queued by MULTI are held back by EXEC
+func (h *Executor) Pausable(client actions.Client, commandParts []string, writesOnly bool) bool {
+	name := strings.ToLower(commandParts[0])
+	tx := client.Transaction()
+	if tx.Active && name == execCommand {
+		for _, request := range tx.Queued {
+			if h.pausable(request, writesOnly) {
+				return true
+			}
+		}
+		return false
+	}
+	if tx.Active && !transactionCommands[name] {
+		return false
+	}
+	return h.pausable(commandParts, writesOnly)
+}
+
+func (h *Executor) pausable(commandParts []string, writesOnly bool) bool {
+	spec, ok := h.specs[strings.ToLower(commandParts[0])]
+	if !ok {
+		return false
+	}
+	spec = spec.resolve(commandParts)
+	if spec.NoPause || spec.hasCategory(acl.CategoryConnection) {
+		return false
+	}
+	return !writesOnly || spec.hasCategory(acl.CategoryWrite)
+}
+
+func (h *Executor) addMonitor(client actions.Client) {
+	h.monitors[client] = true
+}
+
+// RemoveMonitor stops sending the executed commands to a disconnected client
+func (h *Executor) RemoveMonitor(client actions.Client) {
+	delete(h.monitors, client)
+}
+
+// feedMonitors sends a command to the monitors like: 1700000000.123456 [0 127.0.0.1:50000] "set" "key" "value"
+func (h *Executor) feedMonitors(client actions.Client, commandKey string, commandParts []string) {
+	if len(h.monitors) == 0 {
+		return
+	}
+	now := time.Now()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d.%06d [0 %s]", now.Unix(), now.Nanosecond()/1000, client.RemoteAddr())
+	for i, part := range commandParts {
+		if i > 0 && redactedCommands[commandKey] {
+			sb.WriteString(" \"(redacted)\"")
+			continue
+		}
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Quote(part))
+	}
+	line := resp.NewSimpleString(sb.String())
+	for monitor := range h.monitors {
+		monitor.Push(line)
+	}
+}
+
+func (h *Executor) hasCommand(name string) bool {
+	_, ok := h.commands[name]
+	return ok
+}
+
+// Execute runs a parsed request, the first argument is the command name (case-insensitive).
+// The ACL user of the client must be allowed to run the command on its keys.
+// After MULTI the request is queued, a rejected request makes EXEC abort.
+// The requests slower than the slow log threshold are recorded, EXEC as a whole
+func (h *Executor) Execute(client actions.Client, commandParts []string) resp.Value {
+	if len(commandParts) < 1 {
+		return resp.NewError(actions.SyntaxErrorMsg)
+	}
+	start := time.Now()
+	reply := h.run(client, commandParts)
+	if name := strings.ToLower(commandParts[0]); !redactedCommands[name] {
+		h.slowLog.Record(commandParts, time.Since(start), client.RemoteAddr(), client.Name())
+	}
+	return reply
+}
+
+// run executes a request without recording it in the slow log, EXEC runs the queued requests with it
+func (h *Executor) run(client actions.Client, commandParts []string) resp.Value {
+	reply := h.execute(client, commandParts)
+	tx := client.Transaction()
+	if tx.Active && reply.IsError() && !transactionCommands[strings.ToLower(commandParts[0])] {
+		tx.Aborted = true
+	}
+	return reply
+}
+
+func (h *Executor) execute(client actions.Client, commandParts []string) resp.Value {
+	commandKey, args := strings.ToLower(commandParts[0]), commandParts[1:]
+	utils.Debugf("Command %s will be executed", commandKey)
+	command, ok := h.commands[commandKey]
+	if !ok {
+		return resp.NewError(fmt.Sprintf("ERR unknown command '%s'", commandParts[0]))
+	}
+	if !noAuthCommands[commandKey] {
+		if reply := h.checkPermissions(client, commandKey, commandParts); reply.IsError() {
+			return reply
+		}
+	}
+	if reply := h.checkAppendLog(commandKey, commandParts); reply.IsError() {
+		return reply
+	}
+	if tx := client.Transaction(); tx.Active && !transactionCommands[commandKey] {
+		tx.Queue(commandParts)
+		return resp.NewSimpleString("QUEUED")
+	}
+	if client.Subscribed() && client.Protocol() < resp.Version3 && !subscriberCommands[commandKey] {
+		return resp.NewError(fmt.Sprintf("ERR Can't execute '%s': "+
+			"only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", commandKey))
+	}
+	if client.Monitoring() && commandKey != quitCommand {
+		return resp.NewError("ERR only QUIT is allowed in MONITOR mode")
+	}
+	h.feedMonitors(client, commandKey, commandParts)
+	if commandKey == execCommand && h.appendLog != nil {
+		h.execLog = make([][]string, 0)
+	}
+	start := time.Now()
+	reply := command.Execute(client, args)
+	h.stats.Record(commandKey, start, time.Since(start))
+	if err := h.logWrite(commandKey, commandParts, reply); err != nil {
+		// the command ran but a restart would lose it
+		return appendLogError(err)
+	}
+	return reply
 }
 
-func (h *Executor) Execute(input string) string {
-	commandParts := extractCommandParts(input)
-	if commandParts == nil || len(commandParts) < 1 {
-		return actions.SyntaxErrorMsg
+// logWrite sends a successful write command to the append log, the writes run by EXEC
+// are sent together once it returns so that a replay applies all of them or none
+func (h *Executor) logWrite(commandKey string, commandParts []string, reply resp.Value) error {
+	switch {
+	case h.appendLog == nil:
+	case commandKey == execCommand && h.execLog != nil:
+		block := h.execLog
+		h.execLog = nil
+		if len(block) > 0 {
+			block = append(append([][]string{{"MULTI"}}, block...), []string{"EXEC"})
+			return h.appendLog.Append(block...)
+		}
+	case reply.IsError() || !h.specs[commandKey].resolve(commandParts).hasCategory(acl.CategoryWrite):
+	case h.execLog != nil:
+		h.execLog = append(h.execLog, commandParts)
+	default:
+		return h.appendLog.Append(commandParts)
 	}
-	commandKey, args := commandParts[0], commandParts[1:]
-	log.Printf("Command %s will be executed", commandKey)
-	if command, ok := h.commands[commandKey]; ok {
-		return command.Execute(args)
+	return nil
+}
+
+// checkAppendLog refuses the write commands while the append log can't be written
+func (h *Executor) checkAppendLog(commandKey string, commandParts []string) resp.Value {
+	if h.appendLog == nil || !h.specs[commandKey].resolve(commandParts).hasCategory(acl.CategoryWrite) {
+		return resp.OK()
+	}
+	if err := h.appendLog.WriteError(); err != nil {
+		return appendLogError(err)
 	}
-	return actions.SyntaxErrorMsg
+	return resp.OK()
+}
+
+func appendLogError(err error) resp.Value {
+	return resp.NewError("MISCONF Errors writing to the AOF file: " + err.Error())
 }
 
-func extractCommandParts(input string) []string {
-	regex := regexp.MustCompile(`[^\s]+`)
-	return regex.FindAllString(input, -1)
+func (h *Executor) checkPermissions(client actions.Client, commandKey string, commandParts []string) resp.Value {
+	user := h.users.Resolve(client.User())
+	if user == nil {
+		return resp.NewError(actions.NoAuthErrorMsg)
+	}
+	spec := h.specs[commandKey].resolve(commandParts)
+	if !user.CanRun(commandKey, spec.Categories) {
+		return resp.NewError(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user.Name, commandKey))
+	}
+	for _, key := range spec.Keys(commandParts) {
+		if !user.CanAccessKey(key) {
+			return resp.NewError("NOPERM No permissions to access a key")
+		}
+	}
+	return resp.OK()
 }
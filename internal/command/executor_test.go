@@ -0,0 +1,343 @@
+package command
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/internal/config"
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+// fakeClient is a RESP2 client, it acts as the default user until it authenticates
+type fakeClient struct {
+	user     string
+	tx       actions.Transaction
+	monitor  bool
+	messages []resp.Value
+}
+
+func (c *fakeClient) Protocol() int                     { return resp.Version2 }
+func (c *fakeClient) SetProtocol(int)                   {}
+func (c *fakeClient) User() string                      { return c.user }
+func (c *fakeClient) SetUser(user string)               { c.user = user }
+func (c *fakeClient) CloseAfterReply()                  {}
+func (c *fakeClient) ID() int64                         { return 1 }
+func (c *fakeClient) RemoteAddr() string                { return "127.0.0.1:1000" }
+func (c *fakeClient) Name() string                      { return "" }
+func (c *fakeClient) SetName(string)                    {}
+func (c *fakeClient) Info() string                      { return "" }
+func (c *fakeClient) Push(message resp.Value)           { c.messages = append(c.messages, message) }
+func (c *fakeClient) SetSubscriptions(int, int)         {}
+func (c *fakeClient) Subscribed() bool                  { return false }
+func (c *fakeClient) Transaction() *actions.Transaction { return &c.tx }
+func (c *fakeClient) Monitoring() bool                  { return c.monitor }
+func (c *fakeClient) SetMonitoring()                    { c.monitor = true }
+
+func newTestExecutor() (*Executor, *datastore.DataStore) {
+	dataStore := datastore.NewDataStore()
+	return NewExecutor(dataStore, config.Default(), nil, pubsub.NewHub()), dataStore
+}
+
+func TestExecutor_RequirePass(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	executor.ACL().SetDefaultPassword("secret")
+	client := &fakeClient{}
+
+	if reply := executor.Execute(client, []string{"SET", "k", "v"}); reply.Str != actions.NoAuthErrorMsg {
+		t.Errorf("Expected NOAUTH, got %v", reply)
+	}
+	if _, err := dataStore.Get("k"); err != datastore.ErrNotFound {
+		t.Errorf("Expected the command of an unauthenticated client not to run")
+	}
+	if reply := executor.Execute(client, []string{"AUTH", "wrong"}); !strings.HasPrefix(reply.Str, "WRONGPASS") {
+		t.Errorf("Expected WRONGPASS, got %v", reply)
+	}
+	if reply := executor.Execute(client, []string{"AUTH", "secret"}); reply.Str != "OK" || client.user != "default" {
+		t.Errorf("Expected OK as the default user, got %v as '%s'", reply, client.user)
+	}
+	if reply := executor.Execute(client, []string{"SET", "k", "v"}); reply.Str != "OK" {
+		t.Errorf("Expected OK once authenticated, got %v", reply)
+	}
+}
+
+func TestExecutor_AuthUser(t *testing.T) {
+	executor, _ := newTestExecutor()
+	client := &fakeClient{}
+	if reply := executor.Execute(client, []string{"AUTH", "secret"}); !strings.HasPrefix(reply.Str, "ERR AUTH <password> called without any password") {
+		t.Errorf("Expected an error without a password configured, got %v", reply)
+	}
+	if err := executor.ACL().SetUser("app", "on", ">pass", "allkeys", "+get"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if reply := executor.Execute(client, []string{"AUTH", "app", "wrong"}); !strings.HasPrefix(reply.Str, "WRONGPASS") || client.user != "" {
+		t.Errorf("Expected WRONGPASS, got %v as '%s'", reply, client.user)
+	}
+	if reply := executor.Execute(client, []string{"AUTH", "app", "pass"}); reply.Str != "OK" || client.user != "app" {
+		t.Errorf("Expected OK as app, got %v as '%s'", reply, client.user)
+	}
+	if reply := executor.Execute(client, []string{"SET", "k", "v"}); !strings.HasPrefix(reply.Str, "NOPERM") {
+		t.Errorf("Expected NOPERM for a command app can't run, got %v", reply)
+	}
+}
+
+func TestExecutor_HelloAuth(t *testing.T) {
+	executor, _ := newTestExecutor()
+	executor.ACL().SetDefaultPassword("secret")
+	client := &fakeClient{}
+
+	if reply := executor.Execute(client, []string{"HELLO", "3"}); !strings.HasPrefix(reply.Str, "NOAUTH") {
+		t.Errorf("Expected NOAUTH, got %v", reply)
+	}
+	if reply := executor.Execute(client, []string{"HELLO", "3", "AUTH", "default", "wrong"}); !strings.HasPrefix(reply.Str, "WRONGPASS") {
+		t.Errorf("Expected WRONGPASS, got %v", reply)
+	}
+	reply := executor.Execute(client, []string{"HELLO", "3", "AUTH", "default", "secret"})
+	if reply.Kind != resp.Map || client.user != "default" {
+		t.Errorf("Expected the server properties as the default user, got %v as '%s'", reply, client.user)
+	}
+	if reply := executor.Execute(client, []string{"GET", "k"}); !reply.Nil {
+		t.Errorf("Expected a nil reply once authenticated, got %v", reply)
+	}
+}
+
+func TestExecutor_ClientCategories(t *testing.T) {
+	executor, _ := newTestExecutor()
+	if err := executor.ACL().SetUser("app", "on", ">pass", "allkeys", "+@all", "-@admin"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := &fakeClient{user: "app"}
+
+	if reply := executor.Execute(client, []string{"CLIENT", "ID"}); reply.Kind != resp.Integer {
+		t.Errorf("Expected CLIENT ID to be a connection command, got %v", reply)
+	}
+	if reply := executor.Execute(client, []string{"CLIENT", "SETNAME", "app"}); reply.Str != "OK" {
+		t.Errorf("Expected CLIENT SETNAME to be a connection command, got %v", reply)
+	}
+	for _, sub := range []string{"KILL", "PAUSE", "LIST"} {
+		if reply := executor.Execute(client, []string{"CLIENT", sub, "x"}); !strings.HasPrefix(reply.Str, "NOPERM") {
+			t.Errorf("Expected NOPERM for CLIENT %s, got %v", sub, reply)
+		}
+	}
+}
+
+func TestExecutor_Pausable(t *testing.T) {
+	executor, _ := newTestExecutor()
+	client := &fakeClient{}
+	for _, request := range [][]string{{"CLIENT", "unpause"}, {"CLIENT", "GETNAME"}, {"PING"}, {"GET", "k"}} {
+		if executor.Pausable(client, request, true) {
+			t.Errorf("Expected %v to run while the writes are paused", request)
+		}
+	}
+	for _, request := range [][]string{{"GET", "k"}, {"INFO"}} {
+		if !executor.Pausable(client, request, false) {
+			t.Errorf("Expected %v to be held back while the clients are paused", request)
+		}
+	}
+	if !executor.Pausable(client, []string{"SET", "k", "v"}, true) {
+		t.Errorf("Expected SET to be held back while the writes are paused")
+	}
+	for _, request := range [][]string{{"CLIENT", "UNPAUSE"}, {"CLIENT", "ID"}} {
+		if executor.Pausable(client, request, false) {
+			t.Errorf("Expected %v to run while the clients are paused", request)
+		}
+	}
+}
+
+func TestExecutor_Transaction(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	client := &fakeClient{}
+
+	executor.Execute(client, []string{"MULTI"})
+	if reply := executor.Execute(client, []string{"SET", "k", "v"}); reply.Str != "QUEUED" {
+		t.Errorf("Expected QUEUED, got %v", reply)
+	}
+	if _, err := dataStore.Get("k"); err != datastore.ErrNotFound {
+		t.Errorf("Expected the queued command not to run before EXEC")
+	}
+	reply := executor.Execute(client, []string{"EXEC"})
+	if reply.Kind != resp.Array || len(reply.Elems) != 1 || reply.Elems[0].Str != "OK" {
+		t.Errorf("Expected [OK], got %v", reply)
+	}
+	if value, _ := dataStore.Get("k"); value != "v" {
+		t.Errorf("Expected v, got '%s'", value)
+	}
+}
+
+func TestExecutor_TransactionAborted(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	client := &fakeClient{}
+
+	executor.Execute(client, []string{"MULTI"})
+	executor.Execute(client, []string{"SET", "k", "v"})
+	executor.Execute(client, []string{"UNKNOWN"})
+	if reply := executor.Execute(client, []string{"EXEC"}); !reply.IsError() {
+		t.Errorf("Expected EXECABORT, got %v", reply)
+	}
+	if _, err := dataStore.Get("k"); err != datastore.ErrNotFound {
+		t.Errorf("Expected the transaction to be discarded")
+	}
+}
+
+func TestExecutor_Watch(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	client := &fakeClient{}
+
+	executor.Execute(client, []string{"WATCH", "k"})
+	executor.Execute(client, []string{"MULTI"})
+	executor.Execute(client, []string{"SET", "k", "mine"})
+	dataStore.Set("k", "other")
+	if reply := executor.Execute(client, []string{"EXEC"}); reply.Kind != resp.Array || !reply.Nil {
+		t.Errorf("Expected a nil array, got %v", reply)
+	}
+	if value, _ := dataStore.Get("k"); value != "other" {
+		t.Errorf("Expected other, got '%s'", value)
+	}
+	if dataStore.Version("k") != 0 {
+		t.Errorf("Expected EXEC to unwatch the key")
+	}
+}
+
+func TestExecutor_WatchPersist(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	client, other := &fakeClient{}, &fakeClient{}
+	dataStore.Set("k", "v")
+	dataStore.Expire("k", 60000)
+
+	executor.Execute(client, []string{"WATCH", "k"})
+	executor.Execute(client, []string{"MULTI"})
+	executor.Execute(client, []string{"SET", "k", "mine"})
+	executor.Execute(other, []string{"PEXPIRE", "k", "-1"})
+	if reply := executor.Execute(client, []string{"EXEC"}); reply.Kind != resp.Array || !reply.Nil {
+		t.Errorf("Expected a nil array after the ttl was removed, got %v", reply)
+	}
+	if value, _ := dataStore.Get("k"); value != "v" || dataStore.Ttl("k") != -1 {
+		t.Errorf("Expected v without ttl, got '%s' with %d", value, dataStore.Ttl("k"))
+	}
+}
+
+func TestExecutor_Monitor(t *testing.T) {
+	executor, _ := newTestExecutor()
+	monitor, client := &fakeClient{}, &fakeClient{}
+
+	executor.Execute(monitor, []string{"MONITOR"})
+	executor.Execute(client, []string{"SET", "k", "a b"})
+	executor.Execute(client, []string{"AUTH", "secret"})
+
+	if len(monitor.messages) != 2 {
+		t.Fatalf("Expected 2 monitored commands, got %v", monitor.messages)
+	}
+	if line := monitor.messages[0].Str; !strings.HasSuffix(line, ` [0 127.0.0.1:1000] "SET" "k" "a b"`) {
+		t.Errorf("Expected the set command, got '%s'", line)
+	}
+	if line := monitor.messages[1].Str; !strings.HasSuffix(line, ` "AUTH" "(redacted)"`) {
+		t.Errorf("Expected the password to be redacted, got '%s'", line)
+	}
+	if reply := executor.Execute(monitor, []string{"GET", "k"}); !reply.IsError() {
+		t.Errorf("Expected an error in MONITOR mode, got %v", reply)
+	}
+}
+
+// fakeAppendLog keeps the logged blocks, the appends fail while err is set
+type fakeAppendLog struct {
+	logged []string
+	err    error
+}
+
+func (l *fakeAppendLog) Append(commands ...[]string) error {
+	if l.err != nil {
+		return l.err
+	}
+	block := make([]string, 0, len(commands))
+	for _, commandParts := range commands {
+		block = append(block, strings.Join(commandParts, " "))
+	}
+	l.logged = append(l.logged, strings.Join(block, "|"))
+	return nil
+}
+
+func (l *fakeAppendLog) WriteError() error {
+	return l.err
+}
+
+func TestExecutor_AppendLog(t *testing.T) {
+	executor, _ := newTestExecutor()
+	client := &fakeClient{}
+	appendLog := &fakeAppendLog{}
+	executor.SetAppendLog(appendLog)
+
+	executor.Execute(client, []string{"SET", "k", "v"})
+	executor.Execute(client, []string{"GET", "k"})
+	executor.Execute(client, []string{"ZADD", "k", "x", "m"})
+	executor.Execute(client, []string{"MULTI"})
+	executor.Execute(client, []string{"DEL", "k"})
+	executor.Execute(client, []string{"GET", "k"})
+	executor.Execute(client, []string{"SET", "k", "w"})
+	executor.Execute(client, []string{"EXEC"})
+	executor.Execute(client, []string{"MULTI"})
+	executor.Execute(client, []string{"GET", "k"})
+	executor.Execute(client, []string{"EXEC"})
+
+	if strings.Join(appendLog.logged, ",") != "SET k v,MULTI|DEL k|SET k w|EXEC" {
+		t.Errorf("Expected the successful write commands, got %v", appendLog.logged)
+	}
+}
+
+func TestExecutor_AppendLogFailure(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	client := &fakeClient{}
+	appendLog := &fakeAppendLog{}
+	executor.SetAppendLog(appendLog)
+	dataStore.Set("k", "v")
+
+	// the failed write is reported to the client instead of OK
+	appendLog.err = errors.New("no space left on device")
+	if reply := executor.Execute(client, []string{"DEL", "k"}); !strings.HasPrefix(reply.Str, "MISCONF") {
+		t.Errorf("Expected MISCONF, got %v", reply)
+	}
+	dataStore.Set("k", "v")
+	if reply := executor.Execute(client, []string{"SET", "k", "w"}); !strings.HasPrefix(reply.Str, "MISCONF") {
+		t.Errorf("Expected the writes to be refused, got %v", reply)
+	}
+	if value, _ := dataStore.Get("k"); value != "v" {
+		t.Errorf("Expected the refused write not to run, got '%s'", value)
+	}
+	if reply := executor.Execute(client, []string{"GET", "k"}); reply.Str != "v" {
+		t.Errorf("Expected the reads to run, got %v", reply)
+	}
+
+	appendLog.err = nil
+	if reply := executor.Execute(client, []string{"SET", "k", "w"}); reply.Str != "OK" {
+		t.Errorf("Expected the writes to run once the log is writable, got %v", reply)
+	}
+}
+
+func TestExecutor_DumpRestore(t *testing.T) {
+	executor, dataStore := newTestExecutor()
+	client := &fakeClient{}
+	_, _ = dataStore.ZAdd("z", 1, "a")
+
+	payload := executor.Execute(client, []string{"DUMP", "z"})
+	if payload.Kind != resp.BulkString || payload.Nil {
+		t.Fatalf("Expected a payload, got %v", payload)
+	}
+	if reply := executor.Execute(client, []string{"RESTORE", "z", "0", payload.Str}); !strings.HasPrefix(reply.Str, "BUSYKEY") {
+		t.Errorf("Expected BUSYKEY, got %v", reply)
+	}
+	if reply := executor.Execute(client, []string{"RESTORE", "copy", "5000", payload.Str}); reply.Str != "OK" {
+		t.Errorf("Expected OK, got %v", reply)
+	}
+	if score, ok := dataStore.ZScore("copy", "a"); !ok || score != 1 {
+		t.Errorf("Expected the member to be restored, got %v, %v", score, ok)
+	}
+	if ttl := dataStore.Ttl("copy"); ttl <= 0 || ttl > 5000 {
+		t.Errorf("Expected a ttl of at most 5000ms, got %d", ttl)
+	}
+	if reply := executor.Execute(client, []string{"DUMP", "missing"}); !reply.Nil {
+		t.Errorf("Expected a nil reply, got %v", reply)
+	}
+}
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/miladbarzideh/goldis/internal/acl"
+)
+
+// Spec describes a command to the ACL checks
+type Spec struct {
+	Categories []string
+	// FirstKey, LastKey and KeyStep are the positions of the keys in the request, the command name is at 0.
+	// FirstKey 0 means the command takes no key and a negative LastKey counts from the end
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+	// NoPause lets the command run while the clients are paused, so that CLIENT UNPAUSE can
+	NoPause bool
+	// Subcommands are the specs of the subcommands by their lower case name,
+	// the requests without a known subcommand use the command's own spec
+	Subcommands map[string]Spec
+}
+
+// resolve returns the spec of the request's subcommand, or the spec itself
+func (s Spec) resolve(request []string) Spec {
+	if len(request) > 1 {
+		if sub, ok := s.Subcommands[strings.ToLower(request[1])]; ok {
+			return sub
+		}
+	}
+	return s
+}
+
+// Keys returns the keys of a request
+func (s Spec) Keys(request []string) []string {
+	if s.FirstKey <= 0 {
+		return nil
+	}
+	last := s.LastKey
+	if last < 0 {
+		last += len(request)
+	}
+	if last >= len(request) {
+		last = len(request) - 1
+	}
+	keys := make([]string, 0, 1)
+	for i := s.FirstKey; i <= last; i += s.KeyStep {
+		keys = append(keys, request[i])
+	}
+	return keys
+}
+
+func (s Spec) hasCategory(category string) bool {
+	for _, c := range s.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func keyCommand(categories ...string) Spec {
+	return Spec{Categories: categories, FirstKey: 1, LastKey: 1, KeyStep: 1}
+}
+
+func adminCommand() Spec {
+	return Spec{Categories: []string{acl.CategoryAdmin, acl.CategorySlow, acl.CategoryDangerous}}
+}
+
+func connectionCommand() Spec {
+	return Spec{Categories: []string{acl.CategoryConnection, acl.CategoryFast}}
+}
+
+func pubsubCommandSpec() Spec {
+	return Spec{Categories: []string{acl.CategoryPubSub, acl.CategorySlow}}
+}
+
+func transactionCommand() Spec {
+	return Spec{Categories: []string{acl.CategoryTransaction, acl.CategoryFast}}
+}
+
+// clientCommandSpec categorises CLIENT per subcommand, a client managing its own connection
+// isn't an admin. The admin subcommands run while the clients are paused
+func clientCommandSpec() Spec {
+	connection, admin := connectionCommand(), adminCommand()
+	admin.NoPause = true
+	spec := admin
+	spec.Subcommands = map[string]Spec{
+		"setname": connection, "getname": connection, "id": connection, "info": connection,
+		"list": admin, "kill": admin, "pause": admin, "unpause": admin,
+	}
+	return spec
+}
@@ -0,0 +1,25 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpec_Keys(t *testing.T) {
+	cases := []struct {
+		spec    Spec
+		request []string
+		keys    []string
+	}{
+		{Spec{}, []string{"keys"}, nil},
+		{Spec{FirstKey: 1, LastKey: 1, KeyStep: 1}, []string{"get", "a"}, []string{"a"}},
+		{Spec{FirstKey: 1, LastKey: 1, KeyStep: 1}, []string{"get"}, []string{}},
+		{Spec{FirstKey: 1, LastKey: -1, KeyStep: 1}, []string{"del", "a", "b"}, []string{"a", "b"}},
+		{Spec{FirstKey: 1, LastKey: -1, KeyStep: 2}, []string{"mset", "a", "1", "b", "2"}, []string{"a", "b"}},
+	}
+	for _, c := range cases {
+		if keys := c.spec.Keys(c.request); !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("Expected %v for %v, got %v", c.keys, c.request, keys)
+		}
+	}
+}
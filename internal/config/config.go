@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/slowlog"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// Config holds the server settings, they come from the defaults,
+// then the config file (redis.conf style) and then the command-line flags
+type Config struct {
+	// File is the path of the loaded config file, empty when there's none
+	File string
+
+	Bind           string
+	Port           int
+	UnixSocket     string
+	UnixSocketPerm os.FileMode
+
+	TLSPort        int
+	TLSCertFile    string
+	TLSKeyFile     string
+	TLSCAFile      string
+	TLSAuthClients string
+
+	MaxClients        int
+	MaxClientsPerIP   int
+	IdleTimeout       time.Duration
+	ExpireWorkBudget  int
+	LazyFreeThreshold int
+	Threads           int
+	LogLevel          utils.LogLevel
+
+	// RequirePass is the password of the default user, authentication is disabled when empty
+	RequirePass string
+	// ACLFile is the file the ACL users are loaded from at startup
+	ACLFile string
+	// NotifyKeyspaceEvents selects the keyspace notifications, they are disabled by default
+	NotifyKeyspaceEvents pubsub.NotifyFlags
+	// SlowLogSlowerThan is the min duration of the commands kept by SLOWLOG, negative disables it
+	SlowLogSlowerThan time.Duration
+	SlowLogMaxLen     int
+	// MetricsAddr is the address of the HTTP listener serving the Prometheus metrics, empty disables it
+	MetricsAddr string
+	// Dir is the directory of the snapshot file DBFilename
+	Dir        string
+	DBFilename string
+	// SaveRules trigger the background saves, they are disabled when empty
+	SaveRules []persistence.SaveRule
+	// AppendOnly logs the write commands to AppendFilename in Dir, the file is replayed at startup
+	AppendOnly     bool
+	AppendFilename string
+	AppendFsync    persistence.FsyncPolicy
+	// the append only file is rewritten when it grew by AutoAOFRewritePercentage and is over AutoAOFRewriteMinSize
+	AutoAOFRewritePercentage int
+	AutoAOFRewriteMinSize    int64
+	// ImportRDB is a redis RDB file imported at startup when no keys were loaded, the keys of the database
+	// ImportRDBDB or of every database when it's -1
+	ImportRDB   string
+	ImportRDBDB int
+
+	// watchers apply the parameters changed by CONFIG SET to the running server
+	watchers map[string][]func(cfg *Config) error
+}
+
+// Default returns the settings used when nothing is configured
+func Default() *Config {
+	return &Config{
+		Bind:              "0.0.0.0",
+		Port:              6380,
+		UnixSocketPerm:    0700,
+		TLSAuthClients:    "yes",
+		MaxClients:        10000,
+		IdleTimeout:       60 * time.Second,
+		ExpireWorkBudget:  datastore.DefaultMaxWorks,
+		LazyFreeThreshold: datastore.DefaultLargeContainerSize,
+		Threads:           utils.DefaultNumThreads,
+		LogLevel:          utils.LogNotice,
+		SlowLogSlowerThan: slowlog.DefaultThreshold,
+		SlowLogMaxLen:     slowlog.DefaultMaxLen,
+		Dir:               ".",
+		DBFilename:        "dump.gdb",
+		AppendFilename:    "appendonly.aof",
+		AppendFsync:       persistence.FsyncEverySec,
+		// the same defaults as redis
+		AutoAOFRewritePercentage: 100,
+		AutoAOFRewriteMinSize:    64 << 20,
+	}
+}
+
+// Load parses the command-line arguments, a -config flag names the config file,
+// every other flag has the name of a config file parameter and overrides it
+func Load(name string, args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", "", "path of the config file")
+	overrides := make([][2]string, 0)
+	for _, p := range params {
+		p := p
+		usage := fmt.Sprintf("%s (default %q)", p.usage, p.get(cfg))
+		fs.Func(p.name, usage, func(value string) error {
+			overrides = append(overrides, [2]string{p.name, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	errs := make([]error, 0)
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cfg.File = *file
+		errs = append(errs, cfg.parse(f, *file)...)
+	}
+	for _, override := range overrides {
+		if err := cfg.Set(override[0], override[1]); err != nil {
+			errs = append(errs, fmt.Errorf("flag -%s: %w", override[0], err))
+		}
+	}
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// parse reads the "name value" lines of a config file, # starts a comment
+func (cfg *Config) parse(r io.Reader, source string) []error {
+	errs := make([]error, 0)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields, err := splitArgs(text)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", source, line, err))
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if err := cfg.Set(name, strings.Join(fields[1:], " ")); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", source, line, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Set changes a parameter from its textual value
+func (cfg *Config) Set(name string, value string) error {
+	p := lookup(name)
+	if p == nil {
+		return fmt.Errorf("unknown parameter '%s'", name)
+	}
+	if err := p.set(cfg, value); err != nil {
+		return fmt.Errorf("invalid value '%s' for '%s': %w", value, name, err)
+	}
+	return nil
+}
+
+// Get returns the textual value of a parameter
+func (cfg *Config) Get(name string) (string, bool) {
+	p := lookup(name)
+	if p == nil {
+		return "", false
+	}
+	return p.get(cfg), true
+}
+
+// validate checks the rules involving several parameters
+func (cfg *Config) validate() []error {
+	errs := make([]error, 0)
+	if cfg.Port == 0 && cfg.TLSPort == 0 && cfg.UnixSocket == "" {
+		errs = append(errs, errors.New("no listener configured, set a port, a tls-port or a unixsocket"))
+	}
+	if cfg.TLSPort != 0 && (cfg.TLSCertFile == "" || cfg.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls-cert-file and tls-key-file are required by tls-port"))
+	}
+	if cfg.TLSPort != 0 && cfg.TLSPort == cfg.Port {
+		errs = append(errs, errors.New("tls-port and port must be different"))
+	}
+	if cfg.ACLFile != "" && cfg.RequirePass != "" {
+		errs = append(errs, errors.New("requirepass can't be used with aclfile, set the password of the default user in the ACL file"))
+	}
+	return errs
+}
+
+// splitArgs splits a config line in words, a word can be quoted with double quotes
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	var current strings.Builder
+	inQuotes, inWord := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			inWord = true
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unbalanced quotes")
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "goldis.conf")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load("goldis", nil)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Port != 6380 {
+		t.Errorf("Expected port to be 6380, got %d", cfg.Port)
+	}
+	if cfg.IdleTimeout != 60*time.Second {
+		t.Errorf("Expected timeout to be 60s, got %v", cfg.IdleTimeout)
+	}
+}
+
+func TestLoad_FileAndFlags(t *testing.T) {
+	path := writeConfigFile(t, `
+# comment
+bind 127.0.0.1 ::1
+port 7000
+timeout 10
+loglevel "warning"
+`)
+
+	cfg, err := Load("goldis", []string{"-config", path, "-port", "7001", "-threads", "2"})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Bind != "127.0.0.1 ::1" {
+		t.Errorf("Expected bind to be '127.0.0.1 ::1', got '%s'", cfg.Bind)
+	}
+	if cfg.Port != 7001 {
+		t.Errorf("Expected the flag to override port to 7001, got %d", cfg.Port)
+	}
+	if cfg.IdleTimeout != 10*time.Second {
+		t.Errorf("Expected timeout to be 10s, got %v", cfg.IdleTimeout)
+	}
+	if cfg.LogLevel != utils.LogWarning {
+		t.Errorf("Expected loglevel to be warning, got %v", cfg.LogLevel)
+	}
+	if cfg.Threads != 2 {
+		t.Errorf("Expected threads to be 2, got %d", cfg.Threads)
+	}
+}
+
+func TestLoad_ValidationErrors(t *testing.T) {
+	path := writeConfigFile(t, "port 70000\nunknown-param 1\ntimeout -1\n")
+
+	_, err := Load("goldis", []string{"-config", path, "-tls-port", "6381"})
+
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, expected := range []string{":1:", ":2:", ":3:", "tls-cert-file"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %v", expected, err)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`unixsocket "/tmp/my socket" x`)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(args) != 3 || args[1] != "/tmp/my socket" {
+		t.Errorf("Expected [unixsocket, /tmp/my socket, x], got %v", args)
+	}
+}
+
+func TestUpdate_RestoresOnFailure(t *testing.T) {
+	cfg := Default()
+	applied := 0
+	cfg.Watch("timeout", func(cfg *Config) error {
+		applied++
+		return nil
+	})
+
+	err := cfg.Update([][2]string{{"timeout", "5"}, {"expire-work-budget", "x"}})
+
+	if err == nil {
+		t.Fatal("Expected an error for the invalid value")
+	}
+	if cfg.IdleTimeout != 60*time.Second {
+		t.Errorf("Expected timeout to be restored to 60s, got %v", cfg.IdleTimeout)
+	}
+	if applied != 0 {
+		t.Errorf("Expected no watcher to run, got %d", applied)
+	}
+}
+
+func TestUpdate_Immutable(t *testing.T) {
+	cfg := Default()
+
+	err := cfg.Update([][2]string{{"port", "7000"}})
+
+	if err == nil {
+		t.Fatal("Expected an error for an immutable parameter")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cfg := Default()
+
+	pairs := cfg.Match("tls-*", "PORT")
+
+	if len(pairs) != 6 {
+		t.Errorf("Expected 6 parameters, got %v", pairs)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	path := writeConfigFile(t, "# my comment\nport 7000\ntimeout 10\ntimeout 20\nunknown x\n")
+	cfg := Default()
+	cfg.File = path
+	cfg.Port = 7000
+	cfg.IdleTimeout = 30 * time.Second
+	cfg.UnixSocket = "/tmp/my socket"
+
+	if err := cfg.Rewrite(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	expected := "# my comment\nport 7000\ntimeout 30\nunknown x\n" + rewriteHeader + "\nunixsocket \"/tmp/my socket\"\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+}
+
+func TestLoad_Persistence(t *testing.T) {
+	path := writeConfigFile(t, "save 3600 1 300 100\nappendonly yes\nappendfsync always\nauto-aof-rewrite-min-size 16mb\n")
+
+	cfg, err := Load("goldis", []string{"-config", path})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(cfg.SaveRules) != 2 || cfg.SaveRules[1].Changes != 100 {
+		t.Errorf("Expected 2 save rules, got %v", cfg.SaveRules)
+	}
+	if !cfg.AppendOnly || cfg.AppendFsync != persistence.FsyncAlways {
+		t.Errorf("Expected appendonly with appendfsync always, got %v %v", cfg.AppendOnly, cfg.AppendFsync)
+	}
+	if cfg.AutoAOFRewriteMinSize != 16<<20 {
+		t.Errorf("Expected 16mb, got %d", cfg.AutoAOFRewriteMinSize)
+	}
+	if value, _ := cfg.Get("save"); value != "3600 1 300 100" {
+		t.Errorf("Expected '3600 1 300 100', got '%s'", value)
+	}
+	for _, pair := range [][2]string{{"appendfsync", "sometimes"}, {"auto-aof-rewrite-min-size", "12tb"}, {"save", "60"}} {
+		if err := cfg.Set(pair[0], pair[1]); err == nil {
+			t.Errorf("Expected an error for %s %s", pair[0], pair[1])
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// param describes a config parameter, its textual form is what the config file and the flags use
+type param struct {
+	name  string
+	usage string
+	// immutable parameters can't be changed by CONFIG SET
+	immutable bool
+	get       func(cfg *Config) string
+	set       func(cfg *Config, value string) error
+}
+
+var params = []param{
+	{
+		name:      "bind",
+		immutable: true,
+		usage:     "space separated addresses to listen on, :: is dual-stack when no IPv4 address is listed",
+		get:       func(cfg *Config) string { return cfg.Bind },
+		set: func(cfg *Config, value string) error {
+			addrs := strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' })
+			if len(addrs) == 0 {
+				return errors.New("at least one address is required")
+			}
+			for _, addr := range addrs {
+				if net.ParseIP(addr) == nil {
+					return errors.New("not an IP address: " + addr)
+				}
+			}
+			cfg.Bind = strings.Join(addrs, " ")
+			return nil
+		},
+	},
+	{
+		name:      "port",
+		immutable: true,
+		usage:     "TCP port, 0 disables the TCP listeners",
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.Port) },
+		set:       intSetter(0, 65535, func(cfg *Config, v int) { cfg.Port = v }),
+	},
+	{
+		name:      "unixsocket",
+		immutable: true,
+		usage:     "path of the Unix domain socket to listen on",
+		get:       func(cfg *Config) string { return cfg.UnixSocket },
+		set:       func(cfg *Config, value string) error { cfg.UnixSocket = value; return nil },
+	},
+	{
+		name:      "unixsocketperm",
+		immutable: true,
+		usage:     "octal permissions of the Unix domain socket file",
+		get:       func(cfg *Config) string { return strconv.FormatUint(uint64(cfg.UnixSocketPerm), 8) },
+		set: func(cfg *Config, value string) error {
+			perm, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || perm > 0777 {
+				return errors.New("expected an octal permission like 700")
+			}
+			cfg.UnixSocketPerm = os.FileMode(perm)
+			return nil
+		},
+	},
+	{
+		name:      "tls-port",
+		immutable: true,
+		usage:     "TLS port, 0 disables the TLS listeners",
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.TLSPort) },
+		set:       intSetter(0, 65535, func(cfg *Config, v int) { cfg.TLSPort = v }),
+	},
+	{
+		name:  "tls-cert-file",
+		usage: "server certificate file (PEM)",
+		get:   func(cfg *Config) string { return cfg.TLSCertFile },
+		set:   func(cfg *Config, value string) error { cfg.TLSCertFile = value; return nil },
+	},
+	{
+		name:  "tls-key-file",
+		usage: "server private key file (PEM)",
+		get:   func(cfg *Config) string { return cfg.TLSKeyFile },
+		set:   func(cfg *Config, value string) error { cfg.TLSKeyFile = value; return nil },
+	},
+	{
+		name:  "tls-ca-cert-file",
+		usage: "CA certificates file (PEM) to verify the client certificates",
+		get:   func(cfg *Config) string { return cfg.TLSCAFile },
+		set:   func(cfg *Config, value string) error { cfg.TLSCAFile = value; return nil },
+	},
+	{
+		name:  "tls-auth-clients",
+		usage: "client certificate verification: yes, no or optional",
+		get:   func(cfg *Config) string { return cfg.TLSAuthClients },
+		set: func(cfg *Config, value string) error {
+			value = strings.ToLower(value)
+			if value != "yes" && value != "no" && value != "optional" {
+				return errors.New("expected yes, no or optional")
+			}
+			cfg.TLSAuthClients = value
+			return nil
+		},
+	},
+	{
+		name:  "maxclients",
+		usage: "max number of connected clients, the extra ones get an error and are disconnected",
+		get:   func(cfg *Config) string { return strconv.Itoa(cfg.MaxClients) },
+		set:   intSetter(1, 1000000, func(cfg *Config, v int) { cfg.MaxClients = v }),
+	},
+	{
+		name:  "maxclients-per-ip",
+		usage: "max number of clients connected from the same IP address, 0 disables the limit",
+		get:   func(cfg *Config) string { return strconv.Itoa(cfg.MaxClientsPerIP) },
+		set:   intSetter(0, 1000000, func(cfg *Config, v int) { cfg.MaxClientsPerIP = v }),
+	},
+	{
+		name:  "timeout",
+		usage: "seconds of inactivity before a client is disconnected, 0 disables it",
+		get:   func(cfg *Config) string { return strconv.Itoa(int(cfg.IdleTimeout / time.Second)) },
+		set: intSetter(0, 365*24*3600, func(cfg *Config, v int) {
+			cfg.IdleTimeout = time.Duration(v) * time.Second
+		}),
+	},
+	{
+		name:  "expire-work-budget",
+		usage: "max number of expired keys removed per event loop iteration",
+		get:   func(cfg *Config) string { return strconv.Itoa(cfg.ExpireWorkBudget) },
+		set:   intSetter(1, 1000000, func(cfg *Config, v int) { cfg.ExpireWorkBudget = v }),
+	},
+	{
+		name:  "lazyfree-threshold",
+		usage: "zsets with more members are freed in the background",
+		get:   func(cfg *Config) string { return strconv.Itoa(cfg.LazyFreeThreshold) },
+		set:   intSetter(0, 1<<31-1, func(cfg *Config, v int) { cfg.LazyFreeThreshold = v }),
+	},
+	{
+		name:      "threads",
+		immutable: true,
+		usage:     "number of threads freeing big values in the background",
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.Threads) },
+		set:       intSetter(1, 128, func(cfg *Config, v int) { cfg.Threads = v }),
+	},
+	{
+		name:  "loglevel",
+		usage: "log verbosity: debug, verbose, notice or warning",
+		get:   func(cfg *Config) string { return cfg.LogLevel.String() },
+		set: func(cfg *Config, value string) error {
+			level, err := utils.ParseLogLevel(value)
+			if err != nil {
+				return err
+			}
+			cfg.LogLevel = level
+			return nil
+		},
+	},
+	{
+		name:  "requirepass",
+		usage: "password of the default user, the clients must send it with AUTH before any other command",
+		get:   func(cfg *Config) string { return cfg.RequirePass },
+		set:   func(cfg *Config, value string) error { cfg.RequirePass = value; return nil },
+	},
+	{
+		name:      "aclfile",
+		immutable: true,
+		usage:     "file the ACL users are loaded from at startup and saved to by ACL SAVE",
+		get:       func(cfg *Config) string { return cfg.ACLFile },
+		set:       func(cfg *Config, value string) error { cfg.ACLFile = value; return nil },
+	},
+	{
+		name:  "notify-keyspace-events",
+		usage: "keyspace notifications: K and E for the __keyspace__ and __keyevent__ channels, g$zx or A for the events",
+		get:   func(cfg *Config) string { return cfg.NotifyKeyspaceEvents.String() },
+		set: func(cfg *Config, value string) error {
+			flags, err := pubsub.ParseNotifyFlags(value)
+			if err != nil {
+				return err
+			}
+			cfg.NotifyKeyspaceEvents = flags
+			return nil
+		},
+	},
+	{
+		name:  "slowlog-log-slower-than",
+		usage: "microseconds a command must take to be kept by SLOWLOG, 0 keeps every command and -1 disables it",
+		get:   func(cfg *Config) string { return strconv.FormatInt(int64(cfg.SlowLogSlowerThan/time.Microsecond), 10) },
+		set: intSetter(-1, 1<<31-1, func(cfg *Config, v int) {
+			cfg.SlowLogSlowerThan = time.Duration(v) * time.Microsecond
+		}),
+	},
+	{
+		name:  "slowlog-max-len",
+		usage: "number of slow commands kept by SLOWLOG, the oldest ones are dropped",
+		get:   func(cfg *Config) string { return strconv.Itoa(cfg.SlowLogMaxLen) },
+		set:   intSetter(0, 1000000, func(cfg *Config, v int) { cfg.SlowLogMaxLen = v }),
+	},
+	{
+		name:      "metrics-addr",
+		immutable: true,
+		usage:     "host:port of the HTTP listener serving the Prometheus metrics on /metrics, empty disables it",
+		get:       func(cfg *Config) string { return cfg.MetricsAddr },
+		set: func(cfg *Config, value string) error {
+			if value != "" {
+				if _, _, err := net.SplitHostPort(value); err != nil {
+					return errors.New("expected host:port like 127.0.0.1:9121")
+				}
+			}
+			cfg.MetricsAddr = value
+			return nil
+		},
+	},
+	{
+		name:      "dir",
+		immutable: true,
+		usage:     "directory of the snapshot file",
+		get:       func(cfg *Config) string { return cfg.Dir },
+		set: func(cfg *Config, value string) error {
+			if value == "" {
+				return errors.New("the directory can't be empty")
+			}
+			cfg.Dir = value
+			return nil
+		},
+	},
+	{
+		name:      "dbfilename",
+		immutable: true,
+		usage:     "name of the snapshot file, loaded at startup and written by SAVE and BGSAVE",
+		get:       func(cfg *Config) string { return cfg.DBFilename },
+		set: func(cfg *Config, value string) error {
+			if value == "" || strings.ContainsRune(value, os.PathSeparator) {
+				return errors.New("expected a file name without directory")
+			}
+			cfg.DBFilename = value
+			return nil
+		},
+	},
+	{
+		name:  "save",
+		usage: "pairs of seconds and changes triggering a background save, like \"3600 1 300 100\", empty disables them",
+		get:   func(cfg *Config) string { return persistence.FormatSaveRules(cfg.SaveRules) },
+		set: func(cfg *Config, value string) error {
+			rules, err := persistence.ParseSaveRules(value)
+			if err != nil {
+				return err
+			}
+			cfg.SaveRules = rules
+			return nil
+		},
+	},
+	{
+		name:      "appendonly",
+		immutable: true,
+		usage:     "yes logs the write commands to the append only file, it's replayed at startup instead of the snapshot",
+		get:       func(cfg *Config) string { return yesNo(cfg.AppendOnly) },
+		set:       boolSetter(func(cfg *Config, v bool) { cfg.AppendOnly = v }),
+	},
+	{
+		name:      "appendfilename",
+		immutable: true,
+		usage:     "name of the append only file in dir",
+		get:       func(cfg *Config) string { return cfg.AppendFilename },
+		set: func(cfg *Config, value string) error {
+			if value == "" || strings.ContainsRune(value, os.PathSeparator) {
+				return errors.New("expected a file name without directory")
+			}
+			cfg.AppendFilename = value
+			return nil
+		},
+	},
+	{
+		name:  "appendfsync",
+		usage: "when the append only file is synced: always (every write), everysec or no (left to the OS)",
+		get:   func(cfg *Config) string { return cfg.AppendFsync.String() },
+		set: func(cfg *Config, value string) error {
+			policy, err := persistence.ParseFsyncPolicy(value)
+			if err != nil {
+				return err
+			}
+			cfg.AppendFsync = policy
+			return nil
+		},
+	},
+	{
+		name:  "auto-aof-rewrite-percentage",
+		usage: "growth in percent since the last rewrite triggering a rewrite of the append only file, 0 disables it",
+		get:   func(cfg *Config) string { return strconv.Itoa(cfg.AutoAOFRewritePercentage) },
+		set:   intSetter(0, 1<<31-1, func(cfg *Config, v int) { cfg.AutoAOFRewritePercentage = v }),
+	},
+	{
+		name:  "auto-aof-rewrite-min-size",
+		usage: "min size of the append only file before it's rewritten, in bytes or with a kb, mb or gb unit",
+		get:   func(cfg *Config) string { return strconv.FormatInt(cfg.AutoAOFRewriteMinSize, 10) },
+		set: func(cfg *Config, value string) error {
+			size, err := parseSize(value)
+			if err != nil {
+				return err
+			}
+			cfg.AutoAOFRewriteMinSize = size
+			return nil
+		},
+	},
+	{
+		name:      "import-rdb",
+		immutable: true,
+		usage:     "redis RDB file imported at startup only when no keys were loaded, remove it once migrated",
+		get:       func(cfg *Config) string { return cfg.ImportRDB },
+		set:       func(cfg *Config, value string) error { cfg.ImportRDB = value; return nil },
+	},
+	{
+		name:      "import-rdb-db",
+		immutable: true,
+		usage:     "database of the RDB file imported by import-rdb, -1 imports every database",
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.ImportRDBDB) },
+		set:       intSetter(-1, 1<<16, func(cfg *Config, v int) { cfg.ImportRDBDB = v }),
+	},
+}
+
+func lookup(name string) *param {
+	name = strings.ToLower(name)
+	for i := range params {
+		if params[i].name == name {
+			return &params[i]
+		}
+	}
+	return nil
+}
+
+func intSetter(lo, hi int, assign func(cfg *Config, v int)) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("expected an integer")
+		}
+		if v < lo || v > hi {
+			return errors.New("out of range [" + strconv.Itoa(lo) + ", " + strconv.Itoa(hi) + "]")
+		}
+		assign(cfg, v)
+		return nil
+	}
+}
+
+func boolSetter(assign func(cfg *Config, v bool)) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		switch strings.ToLower(value) {
+		case "yes":
+			assign(cfg, true)
+		case "no":
+			assign(cfg, false)
+		default:
+			return errors.New("expected yes or no")
+		}
+		return nil
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// parseSize parses a number of bytes like 1048576, 1024kb or 1mb
+func parseSize(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}} {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower, unit = strings.TrimSuffix(lower, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/unit {
+		return 0, errors.New("expected a size like 64mb")
+	}
+	return n * unit, nil
+}
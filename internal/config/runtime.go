@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+var ErrNoConfigFile = errors.New("the server is running without a config file")
+
+const rewriteHeader = "# Generated by CONFIG REWRITE"
+
+// Watch registers a function applying the parameter to the running server when CONFIG SET changes it,
+// an error rejects the new value
+func (cfg *Config) Watch(name string, apply func(cfg *Config) error) {
+	if cfg.watchers == nil {
+		cfg.watchers = make(map[string][]func(cfg *Config) error)
+	}
+	cfg.watchers[name] = append(cfg.watchers[name], apply)
+}
+
+// Update is CONFIG SET, it changes every name-value pair and applies them to the running server.
+// Either all of them are changed or, when one fails, the previous values are restored
+func (cfg *Config) Update(pairs [][2]string) error {
+	for _, pair := range pairs {
+		p := lookup(pair[0])
+		if p == nil {
+			return fmt.Errorf("unknown parameter '%s'", pair[0])
+		}
+		if p.immutable {
+			return fmt.Errorf("can't set immutable config '%s'", p.name)
+		}
+	}
+
+	previous := make([][2]string, 0, len(pairs))
+	restore := func() {
+		for i := len(previous) - 1; i >= 0; i-- {
+			_ = lookup(previous[i][0]).set(cfg, previous[i][1])
+		}
+	}
+	for _, pair := range pairs {
+		p := lookup(pair[0])
+		previous = append(previous, [2]string{p.name, p.get(cfg)})
+		if err := cfg.Set(p.name, pair[1]); err != nil {
+			restore()
+			return err
+		}
+	}
+
+	applied := make([]string, 0, len(previous))
+	for _, prev := range previous {
+		name := prev[0]
+		if contains(applied, name) {
+			continue
+		}
+		if err := cfg.apply(name); err != nil {
+			restore()
+			for _, name := range append(applied, name) {
+				_ = cfg.apply(name)
+			}
+			return fmt.Errorf("failed to apply '%s': %w", name, err)
+		}
+		applied = append(applied, name)
+	}
+	return nil
+}
+
+func (cfg *Config) apply(name string) error {
+	for _, apply := range cfg.watchers[name] {
+		if err := apply(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match is CONFIG GET, it returns the name-value pairs of the parameters matching a glob pattern
+func (cfg *Config) Match(patterns ...string) [][2]string {
+	pairs := make([][2]string, 0)
+	for _, p := range params {
+		for _, pattern := range patterns {
+			if utils.GlobMatch(strings.ToLower(pattern), p.name) {
+				pairs = append(pairs, [2]string{p.name, p.get(cfg)})
+				break
+			}
+		}
+	}
+	return pairs
+}
+
+// Rewrite is CONFIG REWRITE, it writes the current values to the config file.
+// Comments and the order of the lines are kept, the parameters missing from the file
+// are appended when they differ from the defaults
+func (cfg *Config) Rewrite() error {
+	if cfg.File == "" {
+		return ErrNoConfigFile
+	}
+	content, err := os.ReadFile(cfg.File)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var out bytes.Buffer
+	written := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		text := strings.TrimSpace(line)
+		if text == rewriteHeader {
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			out.WriteString(line + "\n")
+			continue
+		}
+		fields, err := splitArgs(text)
+		p := (*param)(nil)
+		if err == nil {
+			p = lookup(fields[0])
+		}
+		if p == nil {
+			// keep what we don't understand
+			out.WriteString(line + "\n")
+			continue
+		}
+		if written[p.name] {
+			continue
+		}
+		written[p.name] = true
+		out.WriteString(formatParam(p.name, p.get(cfg)))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	defaults := Default()
+	headerWritten := false
+	for _, p := range params {
+		if written[p.name] || p.get(cfg) == p.get(defaults) {
+			continue
+		}
+		if !headerWritten {
+			out.WriteString(rewriteHeader + "\n")
+			headerWritten = true
+		}
+		out.WriteString(formatParam(p.name, p.get(cfg)))
+	}
+
+	return writeFileAtomic(cfg.File, out.Bytes())
+}
+
+// writeFileAtomic writes a temp file and renames it, a crash never leaves a truncated config file
+func writeFileAtomic(path string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func formatParam(name string, value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"#\\") {
+		value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	return name + " " + value + "\n"
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
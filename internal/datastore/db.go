@@ -1,49 +1,156 @@
 package datastore
 
 import (
-	"fmt"
-	"log"
-	"strings"
+	"errors"
 	"time"
 	"unsafe"
 
 	"github.com/miladbarzideh/goldis/utils"
 )
 
-const (
-	resOK   = "OK"
-	resKO   = "KO"
-	resNil  = "(nil)"
-	errType = "(error) ERR expect zset"
+var (
+	ErrNotFound  = errors.New("key not found")
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
 )
 
 const (
-	maxWorks           = 200
-	largeContainerSize = 10000
+	DefaultMaxWorks           = 200
+	DefaultLargeContainerSize = 10000
 )
 
 type DataStore struct {
 	db   *HMap
 	heap *MinHeap
+	// maxWorks is the max number of expired keys removed per event loop iteration
+	maxWorks int
+	// zsets bigger than largeContainerSize are freed by the thread pool
+	largeContainerSize int
+	// notify is told about every change of a key, like keyspace notifications
+	notify func(event string, key string)
+	// watched are the keys watched by the transactions
+	watched map[string]*watchedKey
+	stats   Stats
+	// dirty counts the changes of the keys
+	dirty int64
+}
+
+// Stats are the counters of the keyspace reported by INFO
+type Stats struct {
+	Strings int
+	ZSets   int
+	// Expires is the number of keys having a ttl
+	Expires int
+	// Hits and Misses count the reads of existing and missing keys
+	Hits   int64
+	Misses int64
+	// Expired counts the keys removed by their ttl
+	Expired int64
+	// LatestCopy is how long the latest copy of the whole keyspace took, the event loop is paused meanwhile
+	LatestCopy time.Duration
+}
+
+// Keys returns the number of keys
+func (s Stats) Keys() int {
+	return s.Strings + s.ZSets
+}
+
+// watchedKey counts the changes of a key while it's watched
+type watchedKey struct {
+	version  uint64
+	watchers int
 }
 
 func NewDataStore() *DataStore {
 	return &DataStore{
-		db:   NewHMap(MapEntryComparator),
-		heap: NewMinHeap(),
+		db:                 NewHMap(MapEntryComparator),
+		heap:               NewMinHeap(),
+		maxWorks:           DefaultMaxWorks,
+		largeContainerSize: DefaultLargeContainerSize,
+		watched:            make(map[string]*watchedKey),
 	}
 }
 
-func (ds *DataStore) Get(key string) string {
+// SetMaxWorks sets the expiry work budget of RemoveExpiredKeys
+func (ds *DataStore) SetMaxWorks(maxWorks int) {
+	ds.maxWorks = maxWorks
+}
+
+// SetLargeContainerSize sets the lazy-free threshold, bigger zsets are deleted asynchronously
+func (ds *DataStore) SetLargeContainerSize(size int) {
+	ds.largeContainerSize = size
+}
+
+// SetNotifier registers the function told about the changes, the events are
+// set, del, expire, persist, zadd, zrem, restore and expired (a key removed by its ttl)
+func (ds *DataStore) SetNotifier(notify func(event string, key string)) {
+	ds.notify = notify
+}
+
+// keyChanged counts the change, bumps the version of a watched key and notifies the change
+func (ds *DataStore) keyChanged(event string, key string) {
+	ds.dirty++
+	if w, ok := ds.watched[key]; ok {
+		w.version++
+	}
+	if ds.notify != nil {
+		ds.notify(event, key)
+	}
+}
+
+// Watch starts tracking the changes of the key and returns its current version,
+// the key may not exist yet
+func (ds *DataStore) Watch(key string) uint64 {
+	w, ok := ds.watched[key]
+	if !ok {
+		w = &watchedKey{}
+		ds.watched[key] = w
+	}
+	w.watchers++
+	return w.version
+}
+
+// Unwatch stops tracking the key once every watcher is gone
+func (ds *DataStore) Unwatch(key string) {
+	w, ok := ds.watched[key]
+	if !ok {
+		return
+	}
+	if w.watchers--; w.watchers <= 0 {
+		delete(ds.watched, key)
+	}
+}
+
+// Version returns the number of changes of a watched key since it's watched
+func (ds *DataStore) Version(key string) uint64 {
+	if w, ok := ds.watched[key]; ok {
+		return w.version
+	}
+	return 0
+}
+
+// Stats returns the counters of the keyspace
+func (ds *DataStore) Stats() Stats {
+	stats := ds.stats
+	stats.Expires = ds.heap.Size()
+	return stats
+}
+
+func (ds *DataStore) Get(key string) (string, error) {
 	entry := NewMapEntry(key, STR)
 	node := ds.db.Lookup(&entry.node)
 	if node == nil {
-		return resNil
+		ds.stats.Misses++
+		return "", ErrNotFound
 	}
-	return (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node))).value
+	ds.stats.Hits++
+	entry = (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
+	if entry.entryType != STR {
+		return "", ErrWrongType
+	}
+	return entry.value, nil
 }
 
-func (ds *DataStore) Set(key string, value string) string {
+func (ds *DataStore) Set(key string, value string) {
 	entry := NewMapEntry(key, STR)
 	node := ds.db.Lookup(&entry.node)
 	// update the value
@@ -52,27 +159,39 @@ func (ds *DataStore) Set(key string, value string) string {
 	} else {
 		entry.value = value
 		ds.db.Insert(&entry.node)
+		ds.stats.Strings++
 	}
-	return resOK
+	ds.keyChanged("set", key)
 }
 
-func (ds *DataStore) Delete(key string) string {
+// Delete removes the key and reports whether it existed
+func (ds *DataStore) Delete(key string) bool {
+	if !ds.pop(key) {
+		return false
+	}
+	ds.keyChanged("del", key)
+	return true
+}
+
+// pop removes the key without telling about the change and reports whether it existed
+func (ds *DataStore) pop(key string) bool {
 	entry := NewMapEntry(key, ZSET)
 	node := ds.db.Pop(&entry.node)
-	if node != nil {
-		// containerOf(node) = nil
-		entry := (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
-		ds.setEntryTtl(entry, -1)
-		entryDel(entry)
-		return resOK
+	if node == nil {
+		return false
 	}
-	return resKO
+	// containerOf(node) = nil
+	entry = (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
+	ds.setEntryTtl(entry, -1)
+	ds.countRemoved(entry)
+	ds.entryDel(entry)
+	return true
 }
 
-func entryDel(entry *MapEntry) {
+func (ds *DataStore) entryDel(entry *MapEntry) {
 	if entry.entryType == ZSET {
-		if entry.zset.hmap.Size() > largeContainerSize { //too big
-			log.Println("Perform async action to delete entry")
+		if entry.zset.hmap.Size() > ds.largeContainerSize { //too big
+			utils.Debugf("Perform async action to delete entry")
 			utils.GetThreadPoolInstance().ThreadPoolQueue(entryDelAsync(), entry)
 		} else {
 			entry.zset.Dispose()
@@ -87,109 +206,119 @@ func entryDelAsync() func(arg interface{}) {
 	}
 }
 
-func (ds *DataStore) Keys() string {
+func (ds *DataStore) Keys() []string {
 	nodes := ds.db.Keys()
-	log.Print("Hashtable key-value pairs:\n")
-	res := strings.Builder{}
-	for i, node := range nodes {
+	keys := make([]string, 0, len(nodes))
+	for _, node := range nodes {
 		entry := (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
-		value := entry.value
-		if entry.entryType == ZSET {
-			value = "ZSET"
-		}
-		kv := fmt.Sprintf("%v) %s => %s\n", i+1, entry.key, value)
-		log.Print(kv)
-		res.WriteString(kv)
+		keys = append(keys, entry.key)
 	}
-	return res.String()
+	return keys
 }
 
 // ZAdd command pattern: zadd zset score name
-func (ds *DataStore) ZAdd(key string, score float64, name string) string {
+// It reports whether the name is a new member of the zset
+func (ds *DataStore) ZAdd(key string, score float64, name string) (bool, error) {
 	entry := NewMapEntry(key, ZSET)
 	node := ds.db.Lookup(&entry.node)
 	// update the value
 	if node == nil {
 		entry.zset = NewZSet()
 		ds.db.Insert(&entry.node)
+		ds.stats.ZSets++
 	} else {
 		entry = (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
 		if entry.entryType != ZSET {
-			return errType
+			return false, ErrWrongType
 		}
 	}
 
-	entry.zset.Add(name, score)
-	return resOK
+	added := entry.zset.Add(name, score)
+	ds.keyChanged("zadd", key)
+	return added, nil
 }
 
 // ZRemove command pattern: zrem zset name
-func (ds *DataStore) ZRemove(key string, name string) string {
+// It reports whether the name was a member of the zset
+func (ds *DataStore) ZRemove(key string, name string) bool {
 	exist, entry := ds.expect(key)
 	if !exist {
-		return resKO
+		return false
 	}
 
-	entry.zset.Pop(name)
-	return resOK
+	if entry.zset.Pop(name) == nil {
+		return false
+	}
+	ds.keyChanged("zrem", key)
+	return true
 }
 
 // ZScore command pattern: zscore zset name
-func (ds *DataStore) ZScore(key string, name string) string {
-	exist, entry := ds.expect(key)
+func (ds *DataStore) ZScore(key string, name string) (float64, bool) {
+	exist, entry := ds.expectRead(key)
 	if !exist {
-		return resNil
+		return 0, false
 	}
 	node := entry.zset.Lookup(name)
 	if node == nil {
-		return resNil
+		return 0, false
 	}
-	return fmt.Sprintf("%v", node.score)
+	return node.score, true
 }
 
 // ZQuery command pattern: zquery zset score name offset limit
-func (ds *DataStore) ZQuery(key string, score float64, name string, offset int32, limit uint32) string {
-	exist, entry := ds.expect(key)
+func (ds *DataStore) ZQuery(key string, score float64, name string, offset int32, limit uint32) ([]ZMember, bool) {
+	exist, entry := ds.expectRead(key)
 	if !exist {
-		return resNil
+		return nil, false
 	}
 	znodes := entry.zset.Query(score, name, offset, limit)
-	result := strings.Builder{}
+	members := make([]ZMember, len(znodes))
 	for i, znode := range znodes {
-		result.WriteString(fmt.Sprintf("%v) %v => %v\n", i, znode.name, znode.score))
+		members[i] = ZMember{Name: znode.name, Score: znode.score}
 	}
-	return result.String()
+	return members, true
 }
 
-func (ds *DataStore) ZShow(key string) string {
-	exist, entry := ds.expect(key)
+func (ds *DataStore) ZShow(key string) ([]ZMember, bool) {
+	exist, entry := ds.expectRead(key)
 	if !exist {
-		return resNil
+		return nil, false
 	}
-	return entry.zset.Show()
+	return entry.zset.Show(), true
 }
 
-func (ds *DataStore) Expire(key string, ttl int64) string {
+// Expire sets a ttl in milliseconds on the key and reports whether the key exists,
+// a negative ttl removes the ttl of the key
+func (ds *DataStore) Expire(key string, ttl int64) bool {
 	entry := NewMapEntry(key, STR)
 	node := ds.db.Lookup(&entry.node)
 	if node == nil {
-		return resNil
+		return false
 	}
 	entry = (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
+	hadTtl := entry.heapIndex != -1
 	ds.setEntryTtl(entry, ttl)
-	return resOK
+	if ttl > 0 {
+		ds.keyChanged("expire", key)
+	} else if ttl < 0 && hadTtl {
+		ds.keyChanged("persist", key)
+	}
+	return true
 }
 
-func (ds *DataStore) Ttl(key string) string {
+// Ttl returns the remaining time to live in milliseconds,
+// -2 if the key does not exist and -1 if the key has no ttl
+func (ds *DataStore) Ttl(key string) int64 {
 	entry := NewMapEntry(key, STR)
 	node := ds.db.Lookup(&entry.node)
 	if node == nil {
-		return resNil
+		return -2
 	}
 	entry = (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
 	heapIndex := entry.heapIndex
 	if heapIndex == -1 {
-		return resNil
+		return -1
 	}
 	item := ds.heap.Get(entry.heapIndex)
 	now := time.Now().UnixMilli()
@@ -197,7 +326,7 @@ func (ds *DataStore) Ttl(key string) string {
 	if item.value > now {
 		expireAt = item.value - now
 	}
-	return fmt.Sprintf("(int) %v", expireAt)
+	return expireAt
 }
 
 func (ds *DataStore) setEntryTtl(entry *MapEntry, ttl int64) {
@@ -216,6 +345,15 @@ func (ds *DataStore) setEntryTtl(entry *MapEntry, ttl int64) {
 	}
 }
 
+// NextExpiration returns when the next key expires, false when no key has a ttl
+func (ds *DataStore) NextExpiration() (time.Time, bool) {
+	item := ds.heap.Get(0)
+	if item == nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(item.value), true
+}
+
 func (ds *DataStore) RemoveExpiredKeys() {
 	now := time.Now().UnixMilli()
 	works := 0
@@ -224,7 +362,10 @@ func (ds *DataStore) RemoveExpiredKeys() {
 		entry := (*MapEntry)(utils.ContainerOf(unsafe.Pointer(ref), unsafe.Offsetof(MapEntry{}.heapIndex)))
 		ds.heap.Remove(0)
 		ds.db.Pop(&entry.node)
-		if works > maxWorks {
+		ds.countRemoved(entry)
+		ds.stats.Expired++
+		ds.keyChanged("expired", entry.key)
+		if works > ds.maxWorks {
 			// don't stall the server if too many keys are expiring at once
 			break
 		}
@@ -232,6 +373,25 @@ func (ds *DataStore) RemoveExpiredKeys() {
 	}
 }
 
+// expectRead is expect counting the keyspace hits and misses
+func (ds *DataStore) expectRead(key string) (bool, *MapEntry) {
+	exist, entry := ds.expect(key)
+	if exist {
+		ds.stats.Hits++
+	} else {
+		ds.stats.Misses++
+	}
+	return exist, entry
+}
+
+func (ds *DataStore) countRemoved(entry *MapEntry) {
+	if entry.entryType == ZSET {
+		ds.stats.ZSets--
+	} else {
+		ds.stats.Strings--
+	}
+}
+
 func (ds *DataStore) expect(key string) (bool, *MapEntry) {
 	entry := NewMapEntry(key, ZSET)
 	node := ds.db.Lookup(&entry.node)
@@ -0,0 +1,131 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDataStore_Watch(t *testing.T) {
+	ds := NewDataStore()
+	version := ds.Watch("k")
+
+	ds.Set("other", "v")
+	if ds.Version("k") != version {
+		t.Errorf("Expected version %d, got %d", version, ds.Version("k"))
+	}
+	ds.Set("k", "v")
+	if ds.Version("k") == version {
+		t.Errorf("Expected the version to change after a set")
+	}
+	version = ds.Version("k")
+	ds.Expire("k", 1000)
+	ds.Expire("k", -1)
+	if ds.Version("k") != version+2 {
+		t.Errorf("Expected the version to change after an expire and a persist")
+	}
+	version = ds.Version("k")
+	ds.Delete("k")
+	if ds.Version("k") == version {
+		t.Errorf("Expected the version to change after a delete")
+	}
+
+	ds.Unwatch("k")
+	if _, ok := ds.watched["k"]; ok {
+		t.Errorf("Expected the key to be forgotten once unwatched")
+	}
+}
+
+func TestDataStore_Notifier(t *testing.T) {
+	ds := NewDataStore()
+	var events []string
+	ds.SetNotifier(func(event string, key string) {
+		events = append(events, event+" "+key)
+	})
+
+	ds.Set("s", "v")
+	_, _ = ds.ZAdd("z", 1, "a")
+	ds.ZRemove("z", "missing")
+	ds.ZRemove("z", "a")
+	ds.Expire("s", 1000)
+	ds.Expire("s", -1)
+	ds.Expire("s", -1)
+	ds.Delete("s")
+	ds.Delete("s")
+
+	expected := []string{"set s", "zadd z", "zrem z", "expire s", "persist s", "del s"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, events)
+		}
+	}
+}
+
+func TestDataStore_Stats(t *testing.T) {
+	ds := NewDataStore()
+	ds.Set("s1", "v")
+	ds.Set("s2", "v")
+	ds.Set("s2", "w")
+	_, _ = ds.ZAdd("z", 1, "a")
+	ds.Expire("s1", 1000)
+	_, _ = ds.Get("s1")
+	_, _ = ds.Get("missing")
+	ds.ZScore("z", "a")
+	ds.Delete("s2")
+
+	stats := ds.Stats()
+	if stats.Strings != 1 || stats.ZSets != 1 || stats.Keys() != 2 {
+		t.Errorf("Expected 1 string and 1 zset, got %+v", stats)
+	}
+	if stats.Expires != 1 {
+		t.Errorf("Expected 1 key with a ttl, got %d", stats.Expires)
+	}
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+	if stats.LatestCopy != 0 {
+		t.Errorf("Expected no copy of the keyspace, got %v", stats.LatestCopy)
+	}
+	if entries := ds.Entries(); len(entries) != 2 || ds.Stats().LatestCopy <= 0 {
+		t.Errorf("Expected the copy of 2 keys to be timed, got %d keys in %v", len(entries), ds.Stats().LatestCopy)
+	}
+}
+
+func TestDataStore_Restore(t *testing.T) {
+	ds := NewDataStore()
+	_, _ = ds.ZAdd("z", 9, "old")
+	var events []string
+	ds.SetNotifier(func(event string, key string) {
+		events = append(events, event+" "+key)
+	})
+	version, dirty := ds.Watch("z"), ds.Dirty()
+
+	expireAt := time.Now().Add(time.Minute).UnixMilli()
+	ds.Restore(Entry{Key: "z", Type: ZSET, ExpireAt: expireAt, Members: []ZMember{
+		{Name: "a", Score: 1}, {Name: "b", Score: 2}, {Name: "c", Score: 3},
+	}})
+
+	if len(events) != 1 || events[0] != "restore z" {
+		t.Errorf("Expected a single restore event, got %v", events)
+	}
+	if ds.Dirty() != dirty+1 || ds.Version("z") != version+1 {
+		t.Errorf("Expected a single change, got %d changes and %d versions", ds.Dirty()-dirty, ds.Version("z")-version)
+	}
+	if _, ok := ds.ZScore("z", "old"); ok {
+		t.Errorf("Expected the previous members to be replaced")
+	}
+	if score, ok := ds.ZScore("z", "c"); !ok || score != 3 {
+		t.Errorf("Expected the member c with the score 3, got %v, %v", score, ok)
+	}
+	if entry, _ := ds.Entry("z"); entry.ExpireAt != expireAt {
+		t.Errorf("Expected the key to expire at %d, got %d", expireAt, entry.ExpireAt)
+	}
+	if stats := ds.Stats(); stats.ZSets != 1 || stats.Expires != 1 {
+		t.Errorf("Expected 1 zset with a ttl, got %+v", stats)
+	}
+	if !ds.Exists("z") || ds.Exists("missing") {
+		t.Errorf("Expected only z to exist")
+	}
+}
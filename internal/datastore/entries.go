@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// Entry is a copy of a key and its value, it's how the keyspace is saved and restored
+type Entry struct {
+	Key  string
+	Type EntryType
+	// Value is the value of a string, Members the members of a zset ordered by score
+	Value   string
+	Members []ZMember
+	// ExpireAt is the unix time in milliseconds the key expires at, zero when it has no ttl
+	ExpireAt int64
+}
+
+// Entries copies every key of the keyspace, the strings are shared since they are immutable.
+// The copy walks every key and the members of every zset, its duration is kept as LatestCopy
+func (ds *DataStore) Entries() []Entry {
+	start := time.Now()
+	nodes := ds.db.Keys()
+	entries := make([]Entry, 0, len(nodes))
+	for _, node := range nodes {
+		entry := (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
+		entries = append(entries, ds.copyEntry(entry))
+	}
+	ds.stats.LatestCopy = time.Since(start)
+	return entries
+}
+
+// Entry copies a key, false when it doesn't exist
+func (ds *DataStore) Entry(key string) (Entry, bool) {
+	entry := NewMapEntry(key, STR)
+	node := ds.db.Lookup(&entry.node)
+	if node == nil {
+		return Entry{}, false
+	}
+	entry = (*MapEntry)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(MapEntry{}.node)))
+	return ds.copyEntry(entry), true
+}
+
+// Exists tells whether a key exists without copying its value
+func (ds *DataStore) Exists(key string) bool {
+	entry := NewMapEntry(key, STR)
+	return ds.db.Lookup(&entry.node) != nil
+}
+
+func (ds *DataStore) copyEntry(entry *MapEntry) Entry {
+	copied := Entry{Key: entry.key, Type: entry.entryType, Value: entry.value}
+	if entry.entryType == ZSET {
+		copied.Members = entry.zset.Members()
+	}
+	if entry.heapIndex != -1 {
+		copied.ExpireAt = ds.heap.Get(entry.heapIndex).value
+	}
+	return copied
+}
+
+// Restore replaces the key with the entry as a single restore change, an entry already expired is dropped
+func (ds *DataStore) Restore(entry Entry) {
+	existed := ds.pop(entry.Key)
+	if entry.ExpireAt != 0 && entry.ExpireAt <= time.Now().UnixMilli() {
+		if existed {
+			ds.keyChanged("del", entry.Key)
+		}
+		return
+	}
+	restored := NewMapEntry(entry.Key, entry.Type)
+	if entry.Type == ZSET {
+		restored.zset = NewZSet()
+		for _, member := range entry.Members {
+			restored.zset.Add(member.Name, member.Score)
+		}
+		ds.stats.ZSets++
+	} else {
+		restored.value = entry.Value
+		ds.stats.Strings++
+	}
+	ds.db.Insert(&restored.node)
+	if entry.ExpireAt != 0 {
+		ds.heap.Insert(HeapItem{value: entry.ExpireAt, ref: &restored.heapIndex})
+	}
+	ds.keyChanged("restore", entry.Key)
+}
+
+// ExpireAt sets the unix time in milliseconds the key expires at and reports whether the key exists
+func (ds *DataStore) ExpireAt(key string, at int64) bool {
+	ttl := at - time.Now().UnixMilli()
+	if ttl <= 0 {
+		// the key is removed by the next RemoveExpiredKeys
+		ttl = 1
+	}
+	return ds.Expire(key, ttl)
+}
+
+// Dirty returns the number of changes since the start, the saves compare it to know
+// whether the keyspace changed
+func (ds *DataStore) Dirty() int64 {
+	return ds.dirty
+}
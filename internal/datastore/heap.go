@@ -36,6 +36,10 @@ func (h *MinHeap) Remove(i int32) {
 	h.heapDown(i)
 }
 
+func (h *MinHeap) Size() int {
+	return len(h.heap)
+}
+
 func (h *MinHeap) Get(i int32) *HeapItem {
 	if i > int32(len(h.heap))-1 {
 		return nil
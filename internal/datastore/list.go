@@ -7,6 +7,7 @@ type LNode struct {
 
 type DList struct {
 	head *LNode
+	tail *LNode
 }
 
 func NewDList() *DList {
@@ -23,12 +24,18 @@ func (dl *DList) Detach(node *LNode, cmp func(node1, node2 *LNode) bool) {
 	}
 	if cmp(node, dl.head) {
 		dl.head = node.next
+		if dl.head != nil {
+			dl.head.previous = nil
+		}
 	} else {
 		node.previous.next = node.next
 		if node.next != nil {
 			node.next.previous = node.previous
 		}
 	}
+	if dl.tail != nil && cmp(node, dl.tail) {
+		dl.tail = node.previous
+	}
 	node.next = nil
 	node.previous = nil
 }
@@ -40,6 +47,7 @@ func (dl *DList) GetHead() *LNode {
 func (dl *DList) InsertBefore(newNode *LNode) {
 	if dl.IsEmpty() {
 		dl.head = newNode
+		dl.tail = newNode
 	} else {
 		newNode.next = dl.head
 		dl.head.previous = newNode
@@ -47,6 +55,18 @@ func (dl *DList) InsertBefore(newNode *LNode) {
 	}
 }
 
+// PushBack appends the node to the end of the list
+func (dl *DList) PushBack(newNode *LNode) {
+	if dl.IsEmpty() {
+		dl.head = newNode
+		dl.tail = newNode
+	} else {
+		newNode.previous = dl.tail
+		dl.tail.next = newNode
+		dl.tail = newNode
+	}
+}
+
 func (dl *DList) Iterator() func() *LNode {
 	curr := dl.head
 	return func() *LNode {
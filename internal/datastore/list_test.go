@@ -0,0 +1,57 @@
+package datastore
+
+import "testing"
+
+func nodeEq(node1, node2 *LNode) bool {
+	return node1 == node2
+}
+
+func TestDList_PushBack(t *testing.T) {
+	list := NewDList()
+	nodes := []*LNode{{}, {}, {}}
+	for _, node := range nodes {
+		list.PushBack(node)
+	}
+
+	next := list.Iterator()
+	for i, node := range nodes {
+		if got := next(); got != node {
+			t.Errorf("Expected node %d to be %p, got %p", i, node, got)
+		}
+	}
+	if next() != nil {
+		t.Error("Expected the iterator to be exhausted")
+	}
+}
+
+func TestDList_DetachTail(t *testing.T) {
+	list := NewDList()
+	first, second := &LNode{}, &LNode{}
+	list.PushBack(first)
+	list.PushBack(second)
+
+	list.Detach(second, nodeEq)
+	third := &LNode{}
+	list.PushBack(third)
+
+	if list.GetHead() != first {
+		t.Errorf("Expected head to be %p, got %p", first, list.GetHead())
+	}
+	if first.next != third {
+		t.Errorf("Expected head's next to be %p, got %p", third, first.next)
+	}
+}
+
+func TestDList_DetachHead(t *testing.T) {
+	list := NewDList()
+	first, second := &LNode{}, &LNode{}
+	list.PushBack(first)
+	list.PushBack(second)
+
+	list.Detach(first, nodeEq)
+	list.Detach(second, nodeEq)
+
+	if !list.IsEmpty() {
+		t.Error("Expected list to be empty")
+	}
+}
@@ -1,9 +1,6 @@
 package datastore
 
 import (
-	"fmt"
-	"log"
-	"strings"
 	"unsafe"
 
 	"github.com/miladbarzideh/goldis/utils"
@@ -14,6 +11,12 @@ type ZSet struct {
 	tree *AVLTree
 }
 
+// ZMember is a name-score pair of a zset
+type ZMember struct {
+	Name  string
+	Score float64
+}
+
 type ZNode struct {
 	hmap  HNode
 	tree  AVLNode
@@ -88,29 +91,39 @@ func (zset *ZSet) Pop(name string) *ZNode {
 	return node
 }
 
-func (zset *ZSet) Show() string {
+func (zset *ZSet) Show() []ZMember {
 	printHashtable(zset.hmap.Keys())
 	return printTreeNode(zset.tree.Traverse())
 }
 
+// Members returns the members ordered by score
+func (zset *ZSet) Members() []ZMember {
+	nodes := zset.tree.Traverse()
+	members := make([]ZMember, len(nodes))
+	for i, node := range nodes {
+		entry := (*ZNode)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(ZNode{}.tree)))
+		members[i] = ZMember{Name: entry.name, Score: entry.score}
+	}
+	return members
+}
+
 func printHashtable(nodes []*HNode) {
-	log.Print("Hashtable name-score pair:\n")
+	utils.Debugf("Hashtable name-score pair:")
 	for _, node := range nodes {
 		entry := (*ZNode)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(ZNode{}.hmap)))
-		log.Printf("%v => %v", entry.name, entry.score)
+		utils.Debugf("%v => %v", entry.name, entry.score)
 	}
 }
 
-func printTreeNode(nodes []*AVLNode) string {
-	log.Print("AVL Tree Inorder Traversal:\n")
-	res := strings.Builder{}
+func printTreeNode(nodes []*AVLNode) []ZMember {
+	utils.Debugf("AVL Tree Inorder Traversal:")
+	res := make([]ZMember, 0, len(nodes))
 	for i, node := range nodes {
 		entry := (*ZNode)(utils.ContainerOf(unsafe.Pointer(node), unsafe.Offsetof(ZNode{}.tree)))
-		sn := fmt.Sprintf("%v) %v => %v\n", i+1, entry.score, entry.name)
-		log.Print(sn)
-		res.WriteString(sn)
+		utils.Debugf("%v) %v => %v", i+1, entry.score, entry.name)
+		res = append(res, ZMember{Name: entry.name, Score: entry.score})
 	}
-	return res.String()
+	return res
 }
 
 func (zset *ZSet) Query(score float64, name string, offset int32, limit uint32) []*ZNode {
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/stats"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// Snapshot are the metrics of the server at a point in time
+type Snapshot struct {
+	Uptime              time.Duration
+	ConnectedClients    int
+	TotalConnections    int64
+	RejectedConnections int64
+	Keyspace            datastore.Stats
+	Commands            []stats.Command
+	HeapBytes           uint64
+	LazyFreePending     int
+}
+
+// Handler serves the snapshots in the Prometheus text format,
+// snapshot is called for every request from the HTTP goroutine
+func Handler(snapshot func() (Snapshot, error)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		s, err := snapshot()
+		if err != nil {
+			utils.Warningf("Metrics: %v", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := Write(w, s); err != nil {
+			utils.Verbosef("Metrics: %v", err)
+		}
+	})
+	return mux
+}
+
+// Write writes the snapshot in the Prometheus text format
+func Write(w io.Writer, s Snapshot) error {
+	bw := bufio.NewWriter(w)
+	gauge(bw, "goldis_uptime_seconds", "Seconds since the server started.", s.Uptime.Seconds())
+	gauge(bw, "goldis_connected_clients", "Number of connected clients.", float64(s.ConnectedClients))
+	counter(bw, "goldis_connections_received_total", "Number of accepted connections.", float64(s.TotalConnections))
+	counter(bw, "goldis_connections_rejected_total", "Number of connections rejected by a client limit.",
+		float64(s.RejectedConnections))
+
+	header(bw, "goldis_keys", "Number of keys per type.", "gauge")
+	fmt.Fprintf(bw, "goldis_keys{type=\"string\"} %d\n", s.Keyspace.Strings)
+	fmt.Fprintf(bw, "goldis_keys{type=\"zset\"} %d\n", s.Keyspace.ZSets)
+	gauge(bw, "goldis_expiring_keys", "Number of keys having a ttl.", float64(s.Keyspace.Expires))
+	counter(bw, "goldis_expired_keys_total", "Number of keys evicted by their ttl.", float64(s.Keyspace.Expired))
+	counter(bw, "goldis_keyspace_hits_total", "Number of reads of an existing key.", float64(s.Keyspace.Hits))
+	counter(bw, "goldis_keyspace_misses_total", "Number of reads of a missing key.", float64(s.Keyspace.Misses))
+
+	gauge(bw, "goldis_heap_bytes", "Bytes of allocated heap objects.", float64(s.HeapBytes))
+	gauge(bw, "goldis_lazyfree_pending_objects", "Number of values waiting to be freed in the background.",
+		float64(s.LazyFreePending))
+
+	header(bw, "goldis_commands_total", "Number of executed commands per command.", "counter")
+	for _, command := range s.Commands {
+		fmt.Fprintf(bw, "goldis_commands_total{cmd=%q} %d\n", command.Name, command.Calls)
+	}
+	header(bw, "goldis_command_duration_seconds", "Latency of the commands.", "histogram")
+	for _, command := range s.Commands {
+		cumulative := int64(0)
+		for i, bound := range stats.LatencyBuckets {
+			cumulative += command.Buckets[i]
+			fmt.Fprintf(bw, "goldis_command_duration_seconds_bucket{cmd=%q,le=%q} %d\n",
+				command.Name, formatFloat(bound.Seconds()), cumulative)
+		}
+		fmt.Fprintf(bw, "goldis_command_duration_seconds_bucket{cmd=%q,le=\"+Inf\"} %d\n", command.Name, command.Calls)
+		fmt.Fprintf(bw, "goldis_command_duration_seconds_sum{cmd=%q} %s\n", command.Name,
+			formatFloat(command.Duration.Seconds()))
+		fmt.Fprintf(bw, "goldis_command_duration_seconds_count{cmd=%q} %d\n", command.Name, command.Calls)
+	}
+	return bw.Flush()
+}
+
+func header(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func gauge(w io.Writer, name string, help string, value float64) {
+	header(w, name, help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func counter(w io.Writer, name string, help string, value float64) {
+	header(w, name, help, "counter")
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
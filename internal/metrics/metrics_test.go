@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/stats"
+)
+
+func TestWrite(t *testing.T) {
+	commands := stats.NewCommands()
+	commands.Record("get", time.Now(), 20*time.Microsecond)
+	commands.Record("get", time.Now(), 2*time.Second)
+	snapshot := Snapshot{
+		ConnectedClients: 3,
+		Keyspace:         datastore.Stats{Strings: 2, ZSets: 1},
+		Commands:         commands.PerCommand(),
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, snapshot); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{
+		"# TYPE goldis_connected_clients gauge\ngoldis_connected_clients 3\n",
+		"goldis_keys{type=\"string\"} 2\n",
+		"goldis_keys{type=\"zset\"} 1\n",
+		"goldis_commands_total{cmd=\"get\"} 2\n",
+		"goldis_command_duration_seconds_bucket{cmd=\"get\",le=\"1e-05\"} 0\n",
+		"goldis_command_duration_seconds_bucket{cmd=\"get\",le=\"5e-05\"} 1\n",
+		"goldis_command_duration_seconds_bucket{cmd=\"get\",le=\"1\"} 1\n",
+		"goldis_command_duration_seconds_bucket{cmd=\"get\",le=\"+Inf\"} 2\n",
+		"goldis_command_duration_seconds_sum{cmd=\"get\"} 2.00002\n",
+		"goldis_command_duration_seconds_count{cmd=\"get\"} 2\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", line, buf.String())
+		}
+	}
+}
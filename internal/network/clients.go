@@ -0,0 +1,92 @@
+package network
+
+import (
+	"sort"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+)
+
+// Clients returns the connected clients ordered by id
+func (cm *ConnectionHandler) Clients() []actions.Client {
+	connections := make([]*Connection, 0, len(cm.fdConn))
+	for _, connection := range cm.fdConn {
+		connections = append(connections, connection)
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].id < connections[j].id
+	})
+	clients := make([]actions.Client, len(connections))
+	for i, connection := range connections {
+		clients[i] = connection
+	}
+	return clients
+}
+
+// Stats returns the counters of the server
+func (cm *ConnectionHandler) Stats() actions.ServerStats {
+	return actions.ServerStats{
+		StartedAt:           cm.startedAt,
+		ConnectedClients:    len(cm.fdConn),
+		TotalConnections:    cm.totalConnections,
+		RejectedConnections: cm.rejectedConnections,
+		HeapBytes:           cm.memory.heap.Load(),
+		SysBytes:            cm.memory.sys.Load(),
+	}
+}
+
+// KillClient closes the connection at the end of the event loop iteration,
+// a client killing itself still gets the reply
+func (cm *ConnectionHandler) KillClient(client actions.Client) {
+	connection := client.(*Connection)
+	connection.closeAfterReply = true
+	cm.killed = append(cm.killed, connection)
+}
+
+func (cm *ConnectionHandler) closeKilled() {
+	for _, connection := range cm.killed {
+		if cm.fdConn[connection.Fd] == connection {
+			cm.destroyConnection(connection)
+		}
+	}
+	cm.killed = nil
+}
+
+// PauseClients holds back the requests of every client, or only the write commands, until d is over
+func (cm *ConnectionHandler) PauseClients(d time.Duration, writesOnly bool) {
+	// the most restrictive pause wins while they overlap
+	if cm.pauseEnd.IsZero() {
+		cm.pauseWritesOnly = writesOnly
+	} else {
+		cm.pauseWritesOnly = cm.pauseWritesOnly && writesOnly
+	}
+	if end := time.Now().Add(d); end.After(cm.pauseEnd) {
+		cm.pauseEnd = end
+	}
+}
+
+// UnpauseClients runs the requests held back by CLIENT PAUSE
+func (cm *ConnectionHandler) UnpauseClients() {
+	if cm.pauseEnd.IsZero() {
+		return
+	}
+	cm.pauseEnd = time.Time{}
+	cm.pauseWritesOnly = false
+	for _, client := range cm.Clients() {
+		connection := client.(*Connection)
+		if connection.postponed == nil || cm.fdConn[connection.Fd] != connection {
+			continue
+		}
+		cm.processInput(connection)
+		if _, ok := cm.fdConn[connection.Fd]; ok {
+			cm.updateInterest(connection)
+		}
+	}
+}
+
+func (cm *ConnectionHandler) paused(connection *Connection, args []string) bool {
+	if cm.pauseEnd.IsZero() {
+		return false
+	}
+	return cm.commandHandler.Pausable(connection, args, cm.pauseWritesOnly)
+}
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandler_ClientKill(t *testing.T) {
+	cm := newTestHandler(t)
+	first, firstPeer := connect(t, cm, "127.0.0.1:5001")
+	second, secondPeer := connect(t, cm, "127.0.0.1:5002")
+
+	send(t, cm, first, firstPeer, "CLIENT KILL ID 2\r\n")
+	expectReply(t, firstPeer, ":1\r\n")
+	cm.closeKilled()
+	if _, ok := cm.fdConn[second.Fd]; ok {
+		t.Errorf("Expected the second client to be closed")
+	}
+	expectClosed(t, secondPeer)
+
+	// the caller is skipped unless SKIPME is no, and it still gets the reply
+	send(t, cm, first, firstPeer, "CLIENT KILL ADDR 127.0.0.1:5001\r\n")
+	expectReply(t, firstPeer, ":0\r\n")
+	send(t, cm, first, firstPeer, "CLIENT KILL ADDR 127.0.0.1:5001 SKIPME no\r\n")
+	expectReply(t, firstPeer, ":1\r\n")
+	cm.closeKilled()
+	if len(cm.fdConn) != 0 {
+		t.Errorf("Expected every client to be closed, %d are connected", len(cm.fdConn))
+	}
+	expectClosed(t, firstPeer)
+}
+
+func TestHandler_ClientPauseWrites(t *testing.T) {
+	cm := newTestHandler(t)
+	admin, adminPeer := connect(t, cm, "127.0.0.1:5001")
+	writer, writerPeer := connect(t, cm, "127.0.0.1:5002")
+
+	send(t, cm, admin, adminPeer, "CLIENT PAUSE 10000 WRITE\r\n")
+	expectReply(t, adminPeer, "+OK\r\n")
+	// the requests after a paused write wait behind it
+	send(t, cm, writer, writerPeer, "SET k v\r\nGET k\r\n")
+	expectNoReply(t, writerPeer)
+	send(t, cm, admin, adminPeer, "GET k\r\n")
+	expectReply(t, adminPeer, "$-1\r\n")
+
+	send(t, cm, admin, adminPeer, "CLIENT UNPAUSE\r\n")
+	expectReply(t, adminPeer, "+OK\r\n")
+	expectReply(t, writerPeer, "+OK\r\n$1\r\nv\r\n")
+}
+
+func TestHandler_ClientPauseTimeout(t *testing.T) {
+	cm := newTestHandler(t)
+	admin, adminPeer := connect(t, cm, "127.0.0.1:5001")
+	client, clientPeer := connect(t, cm, "127.0.0.1:5002")
+
+	send(t, cm, admin, adminPeer, "CLIENT PAUSE 20\r\n")
+	expectReply(t, adminPeer, "+OK\r\n")
+	send(t, cm, client, clientPeer, "GET k\r\n")
+	expectNoReply(t, clientPeer)
+	// CLIENT itself isn't paused so that the pause can be lifted
+	send(t, cm, admin, adminPeer, "CLIENT ID\r\n")
+	expectReply(t, adminPeer, ":1\r\n")
+
+	if next := cm.nextTimer(); next > 20*time.Millisecond {
+		t.Errorf("Expected the event loop to wake up when the pause ends, it waits %v", next)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cm.processTimers()
+	expectReply(t, clientPeer, "$-1\r\n")
+}
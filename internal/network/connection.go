@@ -1,47 +1,289 @@
 package network
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"syscall"
 	"time"
 
+	"github.com/miladbarzideh/goldis/internal/command/actions"
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/utils"
 )
 
 const (
-	maxSize = 1024
+	readChunkSize = 16 * 1024
+	// reads of a client are paused while its pending replies are above this limit
+	maxOutputBufferSize = 16 * 1024 * 1024
+	// a subscriber is disconnected when the pushed messages it hasn't read are above this limit
+	maxPubSubOutputSize = 32 * 1024 * 1024
 )
 
+// maxQueryBufferSize is the max size of the unparsed requests of a client, the tests lower it
+var maxQueryBufferSize = 1024 * 1024 * 1024
+
+var errQueryBufferLimit = errors.New("query buffer limit reached")
+
 type Connection struct {
-	Fd        int
-	Addr      syscall.Sockaddr
+	Fd         int
+	Addr       syscall.Sockaddr
+	remoteAddr string
+	// ip is the address counted by the per IP limit, empty for the Unix domain socket clients
+	ip        string
 	idleStart time.Time
 	idleNode  datastore.LNode
+	protocol  int
+	// id and createdAt are set when the event loop adopts the connection
+	id        int64
+	createdAt time.Time
+	name      string
+	// lastCommand is the name of the last command run by the client
+	lastCommand string
+	// user is the ACL user set by AUTH
+	user            string
+	closeAfterReply bool
+	// postponed is a request held back by CLIENT PAUSE, it runs before the rest of the input buffer
+	postponed []string
+	// channels and patterns are the numbers of pubsub subscriptions
+	channels int
+	patterns int
+	// onPush is called when a message is pushed outside of the client's own requests
+	onPush func(connection *Connection)
+	tx     actions.Transaction
+	// monitor is set by MONITOR, the executed commands are pushed to the client
+	monitor bool
+	// interest is what the poller currently watches the fd for
+	interest int
+	// inBuf accumulates the received bytes, inPos is where the next unparsed request starts
+	inBuf []byte
+	inPos int
+	// outBuf holds the encoded replies not sent yet, outPos is where the unsent bytes start
+	outBuf []byte
+	outPos int
 }
 
-func (c Connection) Read() (string, error) {
-	buf := make([]byte, maxSize)
-	sizeMsg, _, err := syscall.Recvfrom(c.Fd, buf, 0)
-	if err != nil {
-		return "", err
+// RemoteAddr returns the client address as ip:port, [ip]:port or path:0 for Unix domain sockets
+func (c *Connection) RemoteAddr() string {
+	return c.remoteAddr
+}
+
+// Protocol returns the RESP version used to encode replies for this connection
+func (c *Connection) Protocol() int {
+	return c.protocol
+}
+
+func (c *Connection) SetProtocol(version int) {
+	c.protocol = version
+}
+
+func (c *Connection) User() string {
+	return c.user
+}
+
+func (c *Connection) SetUser(name string) {
+	c.user = name
+}
+
+func (c *Connection) CloseAfterReply() {
+	c.closeAfterReply = true
+}
+
+// ID is unique for the life of the server, it increases with every new connection
+func (c *Connection) ID() int64 {
+	return c.id
+}
+
+func (c *Connection) Name() string {
+	return c.name
+}
+
+func (c *Connection) SetName(name string) {
+	c.name = name
+}
+
+// Push queues an out-of-band message, the event loop flushes it at the end of the iteration
+func (c *Connection) Push(message resp.Value) {
+	c.Queue(message)
+	if c.onPush != nil {
+		c.onPush(c)
 	}
+}
 
-	input := string(buf[:sizeMsg])
+func (c *Connection) SetSubscriptions(channels int, patterns int) {
+	c.channels = channels
+	c.patterns = patterns
+}
+
+// Subscribed reports whether the client is subscribed to a channel or a pattern
+func (c *Connection) Subscribed() bool {
+	return c.channels+c.patterns > 0
+}
 
-	addrFrom := c.Addr.(*syscall.SockaddrInet4)
-	log.Printf("%d byte read from %d:%d on socket %d\n", sizeMsg, addrFrom.Addr, addrFrom.Port, c.Fd)
-	log.Printf("Received command: %s\n", input)
+// Transaction is the MULTI state of the connection
+func (c *Connection) Transaction() *actions.Transaction {
+	return &c.tx
+}
 
-	return input, nil
+func (c *Connection) Monitoring() bool {
+	return c.monitor
 }
 
-func (c Connection) Write(msg []byte) (int, error) {
-	err := syscall.Sendmsg(c.Fd, msg, nil, c.Addr, syscall.MSG_DONTWAIT)
+func (c *Connection) SetMonitoring() {
+	c.monitor = true
+}
+
+// Info describes the connection in the CLIENT LIST format
+func (c *Connection) Info() string {
+	now := time.Now()
+	user := c.user
+	if user == "" {
+		user = "default"
+	}
+	cmd := c.lastCommand
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	flags := ""
+	if c.Subscribed() {
+		flags += "P"
+	}
+	if c.tx.Active {
+		flags += "x"
+	}
+	if c.monitor {
+		flags += "O"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	events := ""
+	if c.interest&interestRead != 0 {
+		events += "r"
+	}
+	if c.interest&interestWrite != 0 {
+		events += "w"
+	}
+	return fmt.Sprintf("id=%d addr=%s fd=%d name=%s age=%d idle=%d flags=%s db=0 sub=%d psub=%d qbuf=%d qbuf-free=%d "+
+		"obl=%d omem=%d events=%s cmd=%s user=%s resp=%d",
+		c.id, c.remoteAddr, c.Fd, c.name, int64(now.Sub(c.createdAt).Seconds()), int64(now.Sub(c.idleStart).Seconds()),
+		flags, c.channels, c.patterns, len(c.inBuf)-c.inPos, cap(c.inBuf)-len(c.inBuf), len(c.outBuf)-c.outPos, cap(c.outBuf),
+		events, cmd, user, c.protocol)
+}
+
+// Read appends the bytes available on the socket to the input buffer
+func (c *Connection) Read() error {
+	if len(c.inBuf) >= maxQueryBufferSize {
+		return errQueryBufferLimit
+	}
+	if cap(c.inBuf)-len(c.inBuf) < readChunkSize {
+		grown := make([]byte, len(c.inBuf), 2*cap(c.inBuf)+readChunkSize)
+		copy(grown, c.inBuf)
+		c.inBuf = grown
+	}
+	end := len(c.inBuf)
+	sizeMsg, _, err := syscall.Recvfrom(c.Fd, c.inBuf[end:cap(c.inBuf)], 0)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if sizeMsg == 0 {
+		return io.EOF
+	}
+	c.inBuf = c.inBuf[:end+sizeMsg]
+
+	utils.Debugf("%d byte read from %s on socket %d", sizeMsg, c.remoteAddr, c.Fd)
+	utils.Debugf("Received command: %q", c.inBuf[end:])
+
+	return nil
+}
+
+// NextCommand extracts the next complete request from the input buffer,
+// it returns resp.ErrIncomplete and keeps the partial request when more bytes are needed
+func (c *Connection) NextCommand() ([]string, error) {
+	args, n, err := resp.ParseCommand(c.inBuf[c.inPos:])
+	if err == resp.ErrIncomplete {
+		c.compactInput()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.inPos += n
+	return args, nil
+}
+
+// compactInput moves the unparsed bytes to the beginning of the input buffer
+func (c *Connection) compactInput() {
+	if c.inPos == 0 {
+		return
 	}
-	log.Printf("Response message:\n%s ", msg)
-	return 1, err
+	remaining := copy(c.inBuf, c.inBuf[c.inPos:])
+	c.inPos = 0
+	if remaining == 0 && cap(c.inBuf) > readChunkSize {
+		// release the memory of a big request
+		c.inBuf = nil
+		return
+	}
+	c.inBuf = c.inBuf[:remaining]
+}
+
+// Queue appends the encoded reply to the output buffer, it is sent by Flush
+func (c *Connection) Queue(reply resp.Value) {
+	c.outBuf = reply.AppendTo(c.outBuf, c.protocol)
+}
+
+// Flush writes as much of the output buffer as the socket accepts without blocking
+func (c *Connection) Flush() error {
+	for c.outPos < len(c.outBuf) {
+		n, err := syscall.Write(c.Fd, c.outBuf[c.outPos:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			// the socket buffer is full, wait for write readiness.
+			// The sent bytes are dropped so that a slow client doesn't keep growing the buffer
+			c.compactOutput()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		utils.Debugf("Response message: %q", c.outBuf[c.outPos:c.outPos+n])
+		c.outPos += n
+	}
+	c.outPos = 0
+	if cap(c.outBuf) > readChunkSize {
+		// release the memory of a big reply
+		c.outBuf = nil
+	} else {
+		c.outBuf = c.outBuf[:0]
+	}
+	return nil
+}
+
+// compactOutput moves the unsent bytes to the beginning of the output buffer
+func (c *Connection) compactOutput() {
+	if c.outPos == 0 {
+		return
+	}
+	c.outBuf = c.outBuf[:copy(c.outBuf, c.outBuf[c.outPos:])]
+	c.outPos = 0
+}
+
+// HasPendingOutput reports whether some replies are waiting for write readiness
+func (c *Connection) HasPendingOutput() bool {
+	return c.outPos < len(c.outBuf)
+}
+
+// PendingOutput returns the number of bytes waiting to be sent
+func (c *Connection) PendingOutput() int {
+	return len(c.outBuf) - c.outPos
+}
+
+// ReadPaused reports whether the client should not be read until its output is drained
+func (c *Connection) ReadPaused() bool {
+	return len(c.outBuf)-c.outPos > maxOutputBufferSize
 }
 
 func (c Connection) Close() error {
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+func TestConnection_PartialFlush(t *testing.T) {
+	connection, peer := newTestConnection(t, "127.0.0.1:5000")
+	defer connection.Close()
+	reply := strings.Repeat("x", 4*1024*1024)
+	connection.Queue(resp.NewBulkString(reply))
+	queued := connection.PendingOutput()
+
+	if err := connection.Flush(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !connection.HasPendingOutput() || connection.PendingOutput() >= queued {
+		t.Fatalf("Expected a partial write of the %d bytes, %d are pending", queued, connection.PendingOutput())
+	}
+	if connection.outPos != 0 || len(connection.outBuf) != connection.PendingOutput() {
+		t.Errorf("Expected the sent bytes to be dropped, outPos %d and %d bytes buffered", connection.outPos, len(connection.outBuf))
+	}
+
+	received := make(chan []byte)
+	go func() {
+		_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, queued)
+		n, _ := io.ReadFull(peer, buf)
+		received <- buf[:n]
+	}()
+	for deadline := time.Now().Add(5 * time.Second); connection.HasPendingOutput() && time.Now().Before(deadline); {
+		if err := connection.Flush(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	data := <-received
+	if !bytes.Equal(data, resp.NewBulkString(reply).AppendTo(nil, resp.Version2)) {
+		t.Errorf("Expected the whole reply to be received, got %d bytes", len(data))
+	}
+	if connection.HasPendingOutput() || connection.outBuf != nil {
+		t.Errorf("Expected the big output buffer to be released")
+	}
+}
+
+func TestConnection_FlushClosedPeer(t *testing.T) {
+	connection, peer := newTestConnection(t, "127.0.0.1:5000")
+	defer connection.Close()
+	_ = peer.Close()
+	connection.Queue(resp.OK())
+	if err := connection.Flush(); err != syscall.EPIPE {
+		t.Errorf("Expected EPIPE, got %v", err)
+	}
+}
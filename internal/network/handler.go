@@ -1,169 +1,441 @@
 package network
 
 import (
-	"log"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
 
+	"github.com/miladbarzideh/goldis/internal/acl"
 	"github.com/miladbarzideh/goldis/internal/command"
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/internal/config"
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/pubsub"
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/internal/slowlog"
 	"github.com/miladbarzideh/goldis/utils"
 )
 
-const idleTimeout = 60 * time.Second
+const DefaultIdleTimeout = 60 * time.Second
 
 // ConnectionHandler handles the connection management logic
 type ConnectionHandler struct {
-	socket         *Socket
-	fdMax          int
-	activeFd       syscall.FdSet
+	listeners      map[int]*Socket
+	poller         poller
+	tasks          *loopTasks
 	fdConn         FdConn
 	commandHandler *command.Executor
 	idleList       *datastore.DList
 	dataStore      *datastore.DataStore
+	// idleTimeout is how long a client can stay silent before being disconnected, zero disables it
+	idleTimeout  time.Duration
+	tlsListeners []*TLSListener
+	// shutdownMode is set once a shutdown is requested, the event loop stops after the current iteration
+	shutdownMode  *actions.ShutdownMode
+	shutdownHooks []func(mode actions.ShutdownMode) error
+	nextClientID  int64
+	// killed are closed at the end of the event loop iteration
+	killed []*Connection
+	// pauseEnd is when CLIENT PAUSE ends, zero when the clients aren't paused
+	pauseEnd        time.Time
+	pauseWritesOnly bool
+	maxClients      int
+	maxClientsPerIP int
+	clientsPerIP    map[string]int
+	// acceptResume is when the listeners paused after an accept failure are watched again
+	acceptResume time.Time
+	hub          *pubsub.Hub
+	// pushed are the connections that received pubsub messages, they are flushed at the end of the iteration
+	pushed              []*Connection
+	startedAt           time.Time
+	totalConnections    int64
+	rejectedConnections int64
+	snapshotter         *persistence.Snapshotter
+	// aof is nil when the append only file is disabled
+	aof *persistence.AppendOnlyFile
+	// loadedFrom is the file Load restored the keyspace from, empty when there was none
+	loadedFrom string
+	// cronAt is when the periodic work, like the save rules, runs next
+	cronAt time.Time
+	// memory is the latest sample of the memory stats, read every second off the event loop
+	memory *memorySample
 }
 
-// NewConnectionHandler creates a new instance of ConnectionManager
-func NewConnectionHandler(socket *Socket) *ConnectionHandler {
-	serverFd := socket.Fd
-	var activeFd syscall.FdSet
-	fdSet(serverFd, &activeFd)
-	fdConn := FdConnInit()
+// NewConnectionHandler creates a new instance of ConnectionManager serving the clients of every listener
+func NewConnectionHandler(cfg *config.Config, sockets ...*Socket) (*ConnectionHandler, error) {
+	poller, err := newPoller()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := newLoopTasks()
+	if err != nil {
+		_ = poller.close()
+		return nil, err
+	}
+	listeners := make(map[int]*Socket, len(sockets))
+	for _, fd := range append([]int{tasks.readFd}, socketFds(sockets)...) {
+		if err := poller.add(fd, interestRead); err != nil {
+			_ = poller.close()
+			tasks.close()
+			return nil, err
+		}
+	}
+	for _, socket := range sockets {
+		listeners[socket.Fd] = socket
+	}
 	dataStore := datastore.NewDataStore()
-	return &ConnectionHandler{
-		socket:         socket,
-		fdMax:          serverFd,
-		activeFd:       activeFd,
-		fdConn:         fdConn,
-		commandHandler: command.NewExecutor(dataStore),
-		idleList:       datastore.NewDList(),
-		dataStore:      dataStore,
-	}
-}
-
-// StartServer starts the server and handles the connection management logic
-func (cm *ConnectionHandler) StartServer() {
-	for {
-		activeFDSet := cm.getActiveFDSet()
-		timeout := cm.nextTimer()
-		err := platformSpecificSelect(cm.fdMax+1, &activeFDSet, nil, nil, &timeout)
+	cm := &ConnectionHandler{
+		listeners:    listeners,
+		poller:       poller,
+		tasks:        tasks,
+		fdConn:       FdConnInit(),
+		idleList:     datastore.NewDList(),
+		dataStore:    dataStore,
+		idleTimeout:  DefaultIdleTimeout,
+		nextClientID: 1,
+		maxClients:   DefaultMaxClients,
+		clientsPerIP: make(map[string]int),
+		hub:          pubsub.NewHub(),
+		startedAt:    time.Now(),
+		cronAt:       time.Now().Add(cronInterval),
+		memory:       newMemorySample(),
+	}
+	cm.snapshotter = persistence.NewSnapshotter(dataStore, filepath.Join(cfg.Dir, cfg.DBFilename), tasks.submit)
+	if cfg.AppendOnly {
+		cm.aof = persistence.NewAppendOnlyFile(dataStore, filepath.Join(cfg.Dir, cfg.AppendFilename), tasks.submit)
+	}
+	cm.OnShutdown(cm.persistOnShutdown)
+	dataStore.SetNotifier(cm.hub.NotifyKeyspaceEvent)
+	cm.commandHandler = command.NewExecutor(dataStore, cfg, cm, cm.hub)
+	if cm.aof != nil {
+		cm.commandHandler.SetAppendLog(cm.aof)
+	}
+	return cm, nil
+}
+
+// DataStore returns the keyspace served by the handler
+func (cm *ConnectionHandler) DataStore() *datastore.DataStore {
+	return cm.dataStore
+}
+
+// ACL returns the users allowed to connect
+func (cm *ConnectionHandler) ACL() *acl.Registry {
+	return cm.commandHandler.ACL()
+}
+
+// SlowLog returns the log of the slow commands
+func (cm *ConnectionHandler) SlowLog() *slowlog.Log {
+	return cm.commandHandler.SlowLog()
+}
+
+// SetNotifyKeyspaceEvents selects the keyspace notifications published to the subscribers
+func (cm *ConnectionHandler) SetNotifyKeyspaceEvents(flags pubsub.NotifyFlags) {
+	cm.hub.SetNotifyFlags(flags)
+}
+
+func (cm *ConnectionHandler) SetIdleTimeout(timeout time.Duration) {
+	cm.idleTimeout = timeout
+}
+
+// AddTLSListener serves the TLS clients, they are handed to the event loop once the handshake is done
+func (cm *ConnectionHandler) AddTLSListener(listener *TLSListener) {
+	cm.tlsListeners = append(cm.tlsListeners, listener)
+	go listener.serve(func(connection *Connection) {
+		cm.tasks.submitOrDrop(func() {
+			cm.admit(connection)
+		}, func() {
+			// the loop side is closed at shutdown, the proxy goroutines see it and end
+			_ = connection.Close()
+		})
+	})
+}
+
+// StartServer starts the server and handles the connection management logic,
+// it returns once the server is shut down
+func (cm *ConnectionHandler) StartServer() error {
+	go cm.memory.run()
+	for cm.shutdownMode == nil {
+		events, err := cm.poller.wait(cm.nextTimer())
 		if err != nil {
-			log.Fatal("Select(): ", err)
+			utils.Warningf("Poll(): %v", err)
+			return cm.stop(actions.ShutdownDefault, fmt.Errorf("poll: %w", err))
 		}
-		cm.handleActiveConnections(activeFDSet)
+		cm.handleActiveConnections(events)
+		cm.closeKilled()
 		cm.processTimers()
+		cm.flushPushed()
 	}
+	return cm.stop(*cm.shutdownMode, nil)
 }
 
 func (cm *ConnectionHandler) processTimers() {
 	now := time.Now()
+	if !cm.pauseEnd.IsZero() && !now.Before(cm.pauseEnd) {
+		cm.UnpauseClients()
+	}
+	if !cm.acceptResume.IsZero() && !now.Before(cm.acceptResume) {
+		cm.resumeAccepting()
+	}
+	if !now.Before(cm.cronAt) {
+		cm.persistenceCron(now)
+		cm.cronAt = now.Add(cronInterval)
+	}
 	next := cm.idleList.Iterator()
-	for nxt := next(); nxt != nil; nxt = next() {
+	for nxt := next(); nxt != nil && cm.idleTimeout > 0; nxt = next() {
 		connection := getConnection(nxt)
-		nextTime := connection.idleStart.Add(idleTimeout)
+		nextTime := connection.idleStart.Add(cm.idleTimeout)
 		if nextTime.After(now) {
 			break
 		}
-		addrFrom := connection.Addr.(*syscall.SockaddrInet4)
-		log.Printf("Destroy idle connection %d:%d on socket %d\n", addrFrom.Addr, addrFrom.Port, connection.Fd)
+		utils.Verbosef("Destroy idle connection %s on socket %d", connection.RemoteAddr(), connection.Fd)
 		cm.destroyConnection(connection)
-		cm.idleList.Detach(&connection.idleNode, listEq)
 	}
 
 	cm.dataStore.RemoveExpiredKeys()
 }
 
-func (cm *ConnectionHandler) nextTimer() syscall.Timeval {
-	if cm.idleList.IsEmpty() {
-		return syscall.Timeval{Sec: 4} // no timer, the value doesn't matter
+func (cm *ConnectionHandler) nextTimer() time.Duration {
+	next := cm.cronAt
+	if !cm.idleList.IsEmpty() && cm.idleTimeout > 0 {
+		connection := getConnection(cm.idleList.GetHead())
+		if t := connection.idleStart.Add(cm.idleTimeout); t.Before(next) {
+			next = t
+		}
 	}
-	now := time.Now()
-	connection := getConnection(cm.idleList.GetHead())
-	next := connection.idleStart.Add(idleTimeout)
-	remaining := next.Sub(now)
+	// the expired keys are notified, they must be removed on time
+	expiration, _ := cm.dataStore.NextExpiration()
+	for _, t := range []time.Time{cm.pauseEnd, cm.acceptResume, expiration} {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
+	}
+	remaining := time.Until(next)
 	if remaining <= 0 {
-		return syscall.Timeval{}
+		return 0
 	}
-	return syscall.NsecToTimeval(int64(remaining))
+	return remaining
 }
 
-func (cm *ConnectionHandler) addConnection(connection *Connection) {
+func (cm *ConnectionHandler) addConnection(connection *Connection) error {
 	acceptedFd := connection.Fd
-	fdSet(acceptedFd, &cm.activeFd)
+	if err := cm.poller.add(acceptedFd, interestRead); err != nil {
+		return err
+	}
+	connection.interest = interestRead
+	connection.id = cm.nextClientID
+	cm.nextClientID++
+	connection.createdAt = time.Now()
+	connection.onPush = cm.markPushed
+	cm.totalConnections++
 	cm.fdConn.set(acceptedFd, connection)
-	if acceptedFd > cm.fdMax {
-		cm.fdMax = acceptedFd
+	if connection.ip != "" {
+		cm.clientsPerIP[connection.ip]++
 	}
+	cm.idleList.PushBack(&connection.idleNode)
+	return nil
 }
 
 func (cm *ConnectionHandler) destroyConnection(connection *Connection) {
-	fdClr(connection.Fd, &cm.activeFd)
+	cm.idleList.Detach(&connection.idleNode, listEq)
+	_ = cm.poller.remove(connection.Fd)
 	cm.fdConn.clr(connection.Fd)
+	cm.hub.UnsubscribeAll(connection)
+	connection.tx.Unwatch(cm.dataStore)
+	if connection.monitor {
+		cm.commandHandler.RemoveMonitor(connection)
+	}
+	if connection.ip != "" {
+		if cm.clientsPerIP[connection.ip]--; cm.clientsPerIP[connection.ip] <= 0 {
+			delete(cm.clientsPerIP, connection.ip)
+		}
+	}
 	_ = connection.Close()
 }
 
+// updateInterest watches for write readiness while replies are pending
+// and stops watching for reads while the client's output is over the limit
+func (cm *ConnectionHandler) updateInterest(connection *Connection) {
+	interest := 0
+	if !connection.ReadPaused() {
+		interest |= interestRead
+	}
+	if connection.HasPendingOutput() {
+		interest |= interestWrite
+	}
+	if interest == connection.interest {
+		return
+	}
+	if err := cm.poller.modify(connection.Fd, interest); err != nil {
+		utils.Warningf("Poll(): %v", err)
+		cm.destroyConnection(connection)
+		return
+	}
+	connection.interest = interest
+}
+
 func (cm *ConnectionHandler) handleConnectionIO(connection *Connection) {
-	input, err := connection.Read()
+	err := connection.Read()
 	if err != nil {
-		log.Println("Read(): ", err)
+		utils.Verbosef("Read(): %v", err)
 		cm.destroyConnection(connection)
 		return
 	}
 
-	cm.resetTimer(*connection)
+	cm.resetTimer(connection)
+	cm.processInput(connection)
+}
 
-	result := cm.commandHandler.Execute(input)
+// processInput executes the buffered requests and sends their replies
+func (cm *ConnectionHandler) processInput(connection *Connection) {
+	// execute every complete request of the buffer in order (pipelining),
+	// a partial request stays in the buffer until the next read
+	for cm.shutdownMode == nil && !connection.closeAfterReply {
+		if connection.ReadPaused() {
+			// the socket may take the whole output at once, then the buffered requests can go on
+			if err := connection.Flush(); err != nil {
+				utils.Verbosef("Write(): %v", err)
+				cm.destroyConnection(connection)
+				return
+			}
+			if connection.ReadPaused() {
+				break
+			}
+		}
+		args, err := connection.postponed, error(nil)
+		connection.postponed = nil
+		if args == nil {
+			args, err = connection.NextCommand()
+		}
+		if err == resp.ErrIncomplete {
+			break
+		}
+		if err != nil {
+			utils.Verbosef("Parse(): %v", err)
+			connection.Queue(resp.NewError(err.Error()))
+			_ = connection.Flush()
+			cm.destroyConnection(connection)
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if cm.paused(connection, args) {
+			// it runs when the clients are unpaused
+			connection.postponed = args
+			break
+		}
+		connection.lastCommand = strings.ToLower(args[0])
+		if reply := cm.commandHandler.Execute(connection, args); !reply.IsNoReply() {
+			connection.Queue(reply)
+		}
+	}
 
-	_, err = connection.Write([]byte(result + "\n"))
-	if err != nil {
-		log.Println("Write(): ", err)
+	cm.flushConnection(connection)
+	if _, ok := cm.fdConn[connection.Fd]; ok && connection.closeAfterReply && !connection.HasPendingOutput() {
+		cm.destroyConnection(connection)
 	}
 }
 
-func (cm *ConnectionHandler) resetTimer(connection Connection) {
-	connection.idleStart = time.Now()
-	cm.idleList.Detach(&connection.idleNode, listEq)
-	cm.idleList.InsertBefore(&connection.idleNode)
+// flushConnection sends the pending replies, the rest is sent when the socket becomes writable
+func (cm *ConnectionHandler) flushConnection(connection *Connection) {
+	if err := connection.Flush(); err != nil {
+		utils.Verbosef("Write(): %v", err)
+		cm.destroyConnection(connection)
+	}
 }
 
-func (cm *ConnectionHandler) getActiveFDSet() syscall.FdSet {
-	tmpFDSet := cm.activeFd
-	return tmpFDSet
+func (cm *ConnectionHandler) markPushed(connection *Connection) {
+	cm.pushed = append(cm.pushed, connection)
 }
 
-func (cm *ConnectionHandler) handleActiveConnections(fdSet syscall.FdSet) {
-	// the event loop
-	for fd := 0; fd < cm.fdMax+1; fd++ {
-		if fdIsSet(fd, &fdSet) {
-			if fd == cm.socket.Fd {
-				cm.acceptNewConnection()
-			} else {
-				cm.handleConnectionIO(cm.fdConn[fd])
-			}
+// flushPushed sends the pubsub messages fanned out during the iteration,
+// a subscriber too slow to read them is disconnected
+func (cm *ConnectionHandler) flushPushed() {
+	for _, connection := range cm.pushed {
+		if cm.fdConn[connection.Fd] != connection {
+			continue
+		}
+		cm.flushConnection(connection)
+		if cm.fdConn[connection.Fd] != connection {
+			continue
+		}
+		if connection.PendingOutput() > maxPubSubOutputSize {
+			utils.Warningf("Destroy subscriber %s on socket %d, its output buffer is over the limit",
+				connection.RemoteAddr(), connection.Fd)
+			cm.destroyConnection(connection)
+			continue
 		}
+		cm.updateInterest(connection)
 	}
+	cm.pushed = nil
 }
 
-func (cm *ConnectionHandler) acceptNewConnection() {
-	connection, err := cm.socket.Accept()
-	if err != nil {
-		log.Fatal("Accept(): ", err)
-	}
-	cm.idleList.InsertBefore(&connection.idleNode)
-	cm.addConnection(connection)
+func (cm *ConnectionHandler) resetTimer(connection *Connection) {
+	connection.idleStart = time.Now()
+	cm.idleList.Detach(&connection.idleNode, listEq)
+	cm.idleList.PushBack(&connection.idleNode)
 }
 
-func fdIsSet(fd int, p *syscall.FdSet) bool {
-	return p.Bits[fd/32]&(1<<(uint(fd)%32)) != 0
+func (cm *ConnectionHandler) handleActiveConnections(events []event) {
+	// the event loop
+	for _, ev := range events {
+		if ev.fd == cm.tasks.readFd {
+			cm.tasks.run()
+			continue
+		}
+		if socket, ok := cm.listeners[ev.fd]; ok {
+			cm.acceptNewConnection(socket)
+			continue
+		}
+		connection, ok := cm.fdConn[ev.fd]
+		if !ok {
+			continue
+		}
+		if ev.writable {
+			cm.flushConnection(connection)
+			if _, ok := cm.fdConn[ev.fd]; ok {
+				// resume the requests left in the buffer while reading was paused
+				cm.processInput(connection)
+			}
+		}
+		// the connection may be destroyed by the write
+		if _, ok := cm.fdConn[ev.fd]; ok && ev.readable {
+			cm.handleConnectionIO(connection)
+		}
+		if _, ok := cm.fdConn[ev.fd]; ok {
+			cm.updateInterest(connection)
+		}
+	}
 }
 
-func fdSet(fd int, p *syscall.FdSet) {
-	p.Bits[fd/32] |= 1 << (uint(fd) % 32)
+func (cm *ConnectionHandler) acceptNewConnection(socket *Socket) {
+	connection, err := socket.Accept()
+	switch err {
+	case nil:
+		cm.admit(connection)
+	case syscall.EAGAIN:
+		// another event already took the pending connection
+	case syscall.ECONNABORTED, syscall.EINTR, syscall.EPROTO:
+		// the client is gone before being accepted, the next one can be accepted
+		utils.Verbosef("Accept(): %v", err)
+	case syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM:
+		utils.Warningf("Accept(): %v, not accepting clients for %v", err, acceptBackoff)
+		cm.pauseAccepting()
+	default:
+		utils.Warningf("Accept(): %v", err)
+	}
 }
 
-func fdClr(fd int, p *syscall.FdSet) {
-	p.Bits[fd/32] &^= 1 << (uint(fd) % 32)
+func socketFds(sockets []*Socket) []int {
+	fds := make([]int, len(sockets))
+	for i, socket := range sockets {
+		fds[i] = socket.Fd
+	}
+	return fds
 }
 
 type FdConn map[int]*Connection
@@ -0,0 +1,213 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/config"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+func newTestHandler(t *testing.T) *ConnectionHandler {
+	cfg := config.Default()
+	cfg.Dir = t.TempDir()
+	cm, err := NewConnectionHandler(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		for _, connection := range cm.fdConn {
+			cm.destroyConnection(connection)
+		}
+		_ = cm.poller.close()
+		cm.tasks.close()
+	})
+	return cm
+}
+
+// newTestConnection returns a connection and the client side of its socketpair
+func newTestConnection(t *testing.T, remoteAddr string) (*Connection, *os.File) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, fd := range fds {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	// the client side is polled by the runtime so that the reads can time out
+	peer := os.NewFile(uintptr(fds[1]), "peer")
+	t.Cleanup(func() {
+		_ = peer.Close()
+	})
+	return &Connection{Fd: fds[0], remoteAddr: remoteAddr, idleStart: time.Now(), protocol: resp.Version2}, peer
+}
+
+// connect admits a new client and returns its connection and its side of the socket
+func connect(t *testing.T, cm *ConnectionHandler, remoteAddr string) (*Connection, *os.File) {
+	connection, peer := newTestConnection(t, remoteAddr)
+	cm.admit(connection)
+	if cm.fdConn[connection.Fd] != connection {
+		t.Fatalf("Expected the connection to be admitted")
+	}
+	return connection, peer
+}
+
+// send writes the bytes like the client and lets the handler read them
+func send(t *testing.T, cm *ConnectionHandler, connection *Connection, peer *os.File, data string) {
+	if _, err := peer.Write([]byte(data)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cm.handleActiveConnections([]event{{fd: connection.Fd, readable: true}})
+}
+
+// expectReply reads exactly the expected bytes from the client side
+func expectReply(t *testing.T, peer *os.File, expected string) {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(peer, buf); err != nil {
+		t.Fatalf("Expected %q, got %q and %v", expected, buf, err)
+	}
+	if string(buf) != expected {
+		t.Errorf("Expected %q, got %q", expected, buf)
+	}
+}
+
+// expectClosed checks that the server closed the connection
+func expectClosed(t *testing.T, peer *os.File) {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	// the unread requests make the close a reset
+	if _, err := io.ReadAll(peer); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected the connection to be closed")
+	}
+}
+
+// expectNoReply checks that nothing was sent to the client
+func expectNoReply(t *testing.T, peer *os.File) {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 64)
+	if n, err := peer.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected no reply, got %q and %v", buf[:n], err)
+	}
+}
+
+func TestHandler_SplitRequest(t *testing.T) {
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+
+	request := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	for i := 0; i < len(request)-1; i++ {
+		send(t, cm, connection, peer, request[i:i+1])
+	}
+	expectNoReply(t, peer)
+	send(t, cm, connection, peer, request[len(request)-1:])
+	expectReply(t, peer, "+OK\r\n")
+	if value, _ := cm.dataStore.Get("key"); value != "value" {
+		t.Errorf("Expected value, got '%s'", value)
+	}
+}
+
+func TestHandler_Pipelining(t *testing.T) {
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+
+	// the last request is cut in the middle, it runs once the rest arrives
+	send(t, cm, connection, peer, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\nPING\r\n*2\r\n$3\r\nGE")
+	expectReply(t, peer, "+OK\r\n$1\r\nv\r\n+PONG\r\n")
+	send(t, cm, connection, peer, "T\r\n$1\r\nk\r\n")
+	expectReply(t, peer, "$1\r\nv\r\n")
+}
+
+func TestHandler_InlineRequests(t *testing.T) {
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+
+	send(t, cm, connection, peer, "set k  v\r\nget k\nPI")
+	expectReply(t, peer, "+OK\r\n$1\r\nv\r\n")
+	send(t, cm, connection, peer, "NG\r\n\r\n")
+	expectReply(t, peer, "+PONG\r\n")
+	expectNoReply(t, peer)
+}
+
+func TestHandler_ProtocolError(t *testing.T) {
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+
+	send(t, cm, connection, peer, "PING\r\n*1\r\n$x\r\n")
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	data, _ := io.ReadAll(peer)
+	if !bytes.HasPrefix(data, []byte("+PONG\r\n-ERR Protocol error")) {
+		t.Errorf("Expected PONG and a protocol error, got %q", data)
+	}
+	if _, ok := cm.fdConn[connection.Fd]; ok {
+		t.Errorf("Expected the connection to be closed")
+	}
+}
+
+func TestHandler_QueryBufferLimit(t *testing.T) {
+	defer func(size int) { maxQueryBufferSize = size }(maxQueryBufferSize)
+	maxQueryBufferSize = 64
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+
+	send(t, cm, connection, peer, "*1\r\n$100\r\n"+string(bytes.Repeat([]byte("x"), 60)))
+	if _, ok := cm.fdConn[connection.Fd]; !ok {
+		t.Fatalf("Expected the connection to wait for the rest of the request")
+	}
+	send(t, cm, connection, peer, "xxxx")
+	if _, ok := cm.fdConn[connection.Fd]; ok {
+		t.Errorf("Expected the connection to be closed over the query buffer limit")
+	}
+	expectClosed(t, peer)
+}
+
+func TestHandler_OutputBackpressure(t *testing.T) {
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+	big := strings.Repeat("x", maxOutputBufferSize+4*1024*1024)
+	cm.dataStore.Set("big", big)
+
+	// the first reply stays over the limit after the socket buffer is full,
+	// the next requests wait until the client reads it
+	send(t, cm, connection, peer, "GET big\r\nPING\r\n")
+	if !connection.ReadPaused() || connection.interest&interestRead != 0 || connection.interest&interestWrite == 0 {
+		t.Fatalf("Expected the reads to be paused until the output is drained, interest %d", connection.interest)
+	}
+	if connection.lastCommand != "get" {
+		t.Errorf("Expected PING to be held back, the last command is %s", connection.lastCommand)
+	}
+
+	expected := resp.NewBulkString(big).AppendTo(nil, resp.Version2)
+	expected = append(expected, "+PONG\r\n"...)
+	received := make(chan []byte)
+	go func() {
+		_ = peer.SetReadDeadline(time.Now().Add(10 * time.Second))
+		buf := make([]byte, len(expected))
+		n, _ := io.ReadFull(peer, buf)
+		received <- buf[:n]
+	}()
+	for deadline := time.Now().Add(10 * time.Second); connection.lastCommand != "ping" || connection.HasPendingOutput(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the output to be drained")
+		}
+		// the poller reports write readiness
+		cm.handleActiveConnections([]event{{fd: connection.Fd, writable: true}})
+		time.Sleep(time.Millisecond)
+	}
+	if data := <-received; !bytes.Equal(data, expected) {
+		t.Errorf("Expected the reply and PONG, got %d bytes", len(data))
+	}
+	if connection.interest != interestRead {
+		t.Errorf("Expected the reads to resume, interest %d", connection.interest)
+	}
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+const (
+	DefaultMaxClients = 10000
+	// acceptBackoff is how long the listeners stay paused when the process runs out of file descriptors
+	acceptBackoff = 100 * time.Millisecond
+)
+
+func (cm *ConnectionHandler) SetMaxClients(n int) {
+	cm.maxClients = n
+}
+
+// SetMaxClientsPerIP limits the connections from a single IP address, zero disables the limit
+func (cm *ConnectionHandler) SetMaxClientsPerIP(n int) {
+	cm.maxClientsPerIP = n
+}
+
+// admit adds the connection unless a client limit is reached, the rejected client gets an error
+func (cm *ConnectionHandler) admit(connection *Connection) {
+	connection.ip = clientIP(connection.RemoteAddr())
+	reason := ""
+	if len(cm.fdConn) >= cm.maxClients {
+		reason = "ERR max number of clients reached"
+	} else if cm.maxClientsPerIP > 0 && connection.ip != "" && cm.clientsPerIP[connection.ip] >= cm.maxClientsPerIP {
+		reason = "ERR max number of clients per IP reached"
+	}
+	if reason != "" {
+		utils.Verbosef("Rejecting %s: %s", connection.RemoteAddr(), reason)
+		cm.rejectedConnections++
+		// best effort, the socket buffer of a new connection takes a short reply
+		_, _ = syscall.Write(connection.Fd, []byte("-"+reason+"\r\n"))
+		_ = connection.Close()
+		return
+	}
+	if err := cm.addConnection(connection); err != nil {
+		utils.Warningf("Poll(): %v", err)
+		_ = connection.Close()
+	}
+}
+
+// pauseAccepting stops watching the listeners for a while, the pending connections
+// would wake the event loop up again and again while no file descriptor is available
+func (cm *ConnectionHandler) pauseAccepting() {
+	if !cm.acceptResume.IsZero() {
+		return
+	}
+	for fd := range cm.listeners {
+		_ = cm.poller.remove(fd)
+	}
+	cm.acceptResume = time.Now().Add(acceptBackoff)
+}
+
+func (cm *ConnectionHandler) resumeAccepting() {
+	for fd := range cm.listeners {
+		if err := cm.poller.add(fd, interestRead); err != nil {
+			utils.Warningf("Poll(): %v", err)
+		}
+	}
+	cm.acceptResume = time.Time{}
+}
+
+// clientIP returns the IP address of a TCP client, empty for the Unix domain socket clients.
+// An IPv4 client of a dual-stack listener has an IPv4-mapped address, it counts as the IPv4 address
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	return addr.Unmap().WithZone("").String()
+}
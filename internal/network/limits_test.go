@@ -0,0 +1,94 @@
+package network
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	for remoteAddr, expected := range map[string]string{
+		"127.0.0.1:5000":          "127.0.0.1",
+		"[::ffff:127.0.0.1]:5000": "127.0.0.1",
+		"[::1]:5000":              "::1",
+		"[0:0::1]:5000":           "::1",
+		"[fe80::1%eth0]:5000":     "fe80::1",
+		"/tmp/goldis.sock:0":      "",
+		"?":                       "",
+	} {
+		if ip := clientIP(remoteAddr); ip != expected {
+			t.Errorf("Expected '%s' for %s, got '%s'", expected, remoteAddr, ip)
+		}
+	}
+}
+
+func TestHandler_MaxClients(t *testing.T) {
+	cm := newTestHandler(t)
+	cm.SetMaxClients(1)
+	connect(t, cm, "127.0.0.1:5001")
+
+	rejected, peer := newTestConnection(t, "127.0.0.1:5002")
+	cm.admit(rejected)
+	expectReply(t, peer, "-ERR max number of clients reached\r\n")
+	expectClosed(t, peer)
+	if len(cm.fdConn) != 1 || cm.rejectedConnections != 1 {
+		t.Errorf("Expected 1 client and 1 rejected, got %d and %d", len(cm.fdConn), cm.rejectedConnections)
+	}
+}
+
+func TestHandler_MaxClientsPerIP(t *testing.T) {
+	cm := newTestHandler(t)
+	cm.SetMaxClientsPerIP(1)
+	first, _ := connect(t, cm, "127.0.0.1:5001")
+	connect(t, cm, "127.0.0.2:5001")
+	connect(t, cm, "/tmp/goldis.sock:0")
+	connect(t, cm, "/tmp/goldis.sock:0")
+
+	// the same client through a dual-stack listener
+	rejected, peer := newTestConnection(t, "[::ffff:127.0.0.1]:5002")
+	cm.admit(rejected)
+	expectReply(t, peer, "-ERR max number of clients per IP reached\r\n")
+	expectClosed(t, peer)
+
+	cm.destroyConnection(first)
+	if _, ok := cm.clientsPerIP["127.0.0.1"]; ok {
+		t.Errorf("Expected the address to be forgotten once its clients are gone")
+	}
+	connect(t, cm, "[::ffff:127.0.0.1]:5003")
+	if cm.clientsPerIP["127.0.0.1"] != 1 {
+		t.Errorf("Expected the mapped address to count as 127.0.0.1, got %v", cm.clientsPerIP)
+	}
+}
+
+func TestHandler_AcceptBackoff(t *testing.T) {
+	socket, err := NewSocket(net.ParseIP("127.0.0.1"), 0, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer socket.Close()
+	cm := newTestHandler(t)
+	cm.listeners[socket.Fd] = socket
+	if err := cm.poller.add(socket.Fd, interestRead); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cm.pauseAccepting()
+	if next := cm.nextTimer(); next > acceptBackoff {
+		t.Errorf("Expected the event loop to wake up when accepting resumes, it waits %v", next)
+	}
+	// the listener isn't watched, a pending client doesn't wake the loop up
+	dial(t, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(socketPort(t, socket))))
+	if events, _ := cm.poller.wait(10 * time.Millisecond); len(events) != 0 {
+		t.Errorf("Expected no event while accepting is paused, got %v", events)
+	}
+
+	time.Sleep(acceptBackoff)
+	cm.processTimers()
+	if !cm.acceptResume.IsZero() {
+		t.Errorf("Expected accepting to resume")
+	}
+	if events, _ := cm.poller.wait(time.Second); len(events) != 1 || events[0].fd != socket.Fd {
+		t.Errorf("Expected the pending client to be reported, got %v", events)
+	}
+}
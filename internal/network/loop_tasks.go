@@ -0,0 +1,99 @@
+package network
+
+import (
+	"sync"
+	"syscall"
+)
+
+// loopTasks lets other goroutines run code on the event loop goroutine,
+// a byte written to a pipe watched by the poller wakes the loop up
+type loopTasks struct {
+	mutex   sync.Mutex
+	pending []loopTask
+	closed  bool
+	readFd  int
+	writeFd int
+}
+
+// loopTask is a queued task, drop releases its resources when the event loop closes before running it
+type loopTask struct {
+	run  func()
+	drop func()
+}
+
+func newLoopTasks() (*loopTasks, error) {
+	fds := make([]int, 2)
+	if err := syscall.Pipe(fds); err != nil {
+		return nil, err
+	}
+	for _, fd := range fds {
+		syscall.CloseOnExec(fd)
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			_ = syscall.Close(fds[0])
+			_ = syscall.Close(fds[1])
+			return nil, err
+		}
+	}
+	return &loopTasks{readFd: fds[0], writeFd: fds[1]}, nil
+}
+
+// submit queues the task and wakes the event loop, it is safe to call from any goroutine.
+// The task is dropped once the event loop is closed, submit then returns false
+func (lt *loopTasks) submit(task func()) bool {
+	return lt.submitOrDrop(task, nil)
+}
+
+// submitOrDrop is submit calling drop, on the caller goroutine or the closing one,
+// when the task is dropped instead of run
+func (lt *loopTasks) submitOrDrop(task func(), drop func()) bool {
+	lt.mutex.Lock()
+	closed := lt.closed
+	if !closed {
+		lt.pending = append(lt.pending, loopTask{run: task, drop: drop})
+		// the pipe may be full when the loop is already due to wake up, that's fine
+		_, _ = syscall.Write(lt.writeFd, []byte{0})
+	}
+	lt.mutex.Unlock()
+	if closed && drop != nil {
+		drop()
+	}
+	return !closed
+}
+
+// run drains the wake-up pipe and runs the queued tasks on the event loop
+func (lt *loopTasks) run() {
+	buf := make([]byte, 64)
+	for {
+		n, err := syscall.Read(lt.readFd, buf)
+		if n <= 0 || err != nil {
+			break
+		}
+	}
+	lt.mutex.Lock()
+	tasks := lt.pending
+	lt.pending = nil
+	lt.mutex.Unlock()
+	for _, task := range tasks {
+		task.run()
+	}
+}
+
+// close drops the queued tasks, it can be called more than once
+func (lt *loopTasks) close() {
+	lt.mutex.Lock()
+	if lt.closed {
+		lt.mutex.Unlock()
+		return
+	}
+	dropped := lt.pending
+	lt.closed = true
+	lt.pending = nil
+	_ = syscall.Close(lt.readFd)
+	_ = syscall.Close(lt.writeFd)
+	lt.mutex.Unlock()
+	for _, task := range dropped {
+		if task.drop != nil {
+			task.drop()
+		}
+	}
+}
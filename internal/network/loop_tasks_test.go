@@ -0,0 +1,39 @@
+package network
+
+import "testing"
+
+func TestLoopTasks_Run(t *testing.T) {
+	tasks, err := newLoopTasks()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ran := 0
+	for i := 0; i < 3; i++ {
+		if !tasks.submit(func() { ran++ }) {
+			t.Errorf("Expected the task to be queued")
+		}
+	}
+	tasks.run()
+	tasks.close()
+	if ran != 3 {
+		t.Errorf("Expected 3 tasks to run, got %d", ran)
+	}
+}
+
+func TestLoopTasks_Drop(t *testing.T) {
+	tasks, err := newLoopTasks()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ran, dropped := 0, 0
+	run, drop := func() { ran++ }, func() { dropped++ }
+	tasks.submitOrDrop(run, drop)
+	tasks.close()
+	if tasks.submitOrDrop(run, drop) {
+		t.Errorf("Expected the task to be refused once closed")
+	}
+	tasks.submit(run)
+	if ran != 0 || dropped != 2 {
+		t.Errorf("Expected the 2 tasks to be dropped, got %d ran and %d dropped", ran, dropped)
+	}
+}
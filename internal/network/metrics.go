@@ -0,0 +1,85 @@
+package network
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/metrics"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// metricsTimeout bounds the wait for the event loop, it may be busy with a slow command
+const metricsTimeout = 5 * time.Second
+
+// memorySampleInterval is how often the memory stats are read
+const memorySampleInterval = time.Second
+
+var errServerStopped = errors.New("the server is shutting down")
+
+// memorySample is the latest reading of the memory stats, reading them stops the world
+// so it's done once per interval off the event loop instead of on every INFO or scrape
+type memorySample struct {
+	heap atomic.Uint64
+	sys  atomic.Uint64
+	stop chan struct{}
+}
+
+func newMemorySample() *memorySample {
+	sample := &memorySample{stop: make(chan struct{})}
+	sample.read()
+	return sample
+}
+
+func (s *memorySample) read() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.heap.Store(mem.HeapAlloc)
+	s.sys.Store(mem.Sys)
+}
+
+// run reads the memory stats every interval until close
+func (s *memorySample) run() {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.read()
+		}
+	}
+}
+
+func (s *memorySample) close() {
+	close(s.stop)
+}
+
+// MetricsSnapshot collects the metrics on the event loop, it is safe to call from any goroutine
+func (cm *ConnectionHandler) MetricsSnapshot() (metrics.Snapshot, error) {
+	done := make(chan metrics.Snapshot, 1)
+	if !cm.tasks.submit(func() { done <- cm.metricsSnapshot() }) {
+		return metrics.Snapshot{}, errServerStopped
+	}
+	select {
+	case snapshot := <-done:
+		snapshot.LazyFreePending = utils.GetThreadPoolInstance().Pending()
+		return snapshot, nil
+	case <-time.After(metricsTimeout):
+		return metrics.Snapshot{}, errors.New("the event loop didn't answer in time")
+	}
+}
+
+func (cm *ConnectionHandler) metricsSnapshot() metrics.Snapshot {
+	return metrics.Snapshot{
+		Uptime:              time.Since(cm.startedAt),
+		ConnectedClients:    len(cm.fdConn),
+		TotalConnections:    cm.totalConnections,
+		RejectedConnections: cm.rejectedConnections,
+		Keyspace:            cm.dataStore.Stats(),
+		Commands:            cm.commandHandler.CommandStats().PerCommand(),
+		HeapBytes:           cm.memory.heap.Load(),
+	}
+}
@@ -0,0 +1,25 @@
+package network
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_InfoMemorySample(t *testing.T) {
+	cm := newTestHandler(t)
+	connection, peer := connect(t, cm, "127.0.0.1:5000")
+	if cm.memory.heap.Load() == 0 || cm.memory.sys.Load() == 0 {
+		t.Fatalf("Expected the memory stats to be sampled at start")
+	}
+
+	// INFO reports the latest sample instead of reading the memory stats
+	cm.memory.heap.Store(1536)
+	send(t, cm, connection, peer, "INFO memory\r\n")
+	_ = peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	data, _ := io.ReadAll(peer)
+	if !strings.Contains(string(data), "used_memory:1536\r\nused_memory_human:1.50K\r\n") {
+		t.Errorf("Expected the sampled heap size, got %q", data)
+	}
+}
@@ -0,0 +1,149 @@
+package network
+
+import (
+	"errors"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/rdb"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// cronInterval is how often the save rules and the append only file growth are checked
+const cronInterval = time.Second
+
+var errAppendOnlyDisabled = errors.New("the append only file is disabled, set appendonly yes")
+
+// Load restores the keyspace from the append only file when it's enabled and exists,
+// from the snapshot file otherwise. It must be called before StartServer
+func (cm *ConnectionHandler) Load() error {
+	if cm.aof == nil {
+		_, err := cm.loadSnapshot()
+		return err
+	}
+	if cm.aof.Exists() {
+		start := time.Now()
+		commands, err := cm.aof.Load()
+		if err != nil {
+			return err
+		}
+		cm.snapshotter.ResetChanges()
+		cm.loadedFrom = cm.aof.Path()
+		utils.Noticef("DB loaded from the append only file %s: %d commands in %v",
+			cm.aof.Path(), commands, time.Since(start))
+	} else {
+		keys, err := cm.loadSnapshot()
+		if err != nil {
+			return err
+		}
+		// the append only file must hold the keys of the snapshot, the next start only reads it
+		if keys > 0 {
+			if err := cm.aof.Rewrite(); err != nil {
+				return err
+			}
+		}
+	}
+	return cm.aof.Open()
+}
+
+func (cm *ConnectionHandler) loadSnapshot() (int, error) {
+	start := time.Now()
+	keys, err := cm.snapshotter.Load()
+	if err != nil {
+		return 0, err
+	}
+	if keys > 0 {
+		cm.loadedFrom = cm.snapshotter.Path()
+		utils.Noticef("DB loaded from %s: %d keys in %v", cm.snapshotter.Path(), keys, time.Since(start))
+	}
+	return keys, nil
+}
+
+// ImportRDB loads the strings and sorted sets of a redis RDB file in an empty keyspace, the append only
+// file is rewritten to keep them. It must be called after Load and before StartServer, the keys loaded
+// from the append only file or the snapshot are newer than the file and the import is skipped
+func (cm *ConnectionHandler) ImportRDB(path string, db int) error {
+	if keys := cm.dataStore.Stats().Keys(); keys > 0 {
+		utils.Warningf("Skipped the import of the RDB file %s: the %d keys loaded from %s are kept, "+
+			"remove import-rdb once the data is migrated", path, keys, cm.loadedFrom)
+		return nil
+	}
+	start := time.Now()
+	stats, err := rdb.Load(path, db, cm.dataStore.Restore)
+	if err != nil {
+		return err
+	}
+	utils.Noticef("Imported %d keys from the RDB file %s in %v", stats.Keys, path, time.Since(start))
+	if stats.Expired > 0 || stats.OtherDBs > 0 {
+		utils.Noticef("Dropped %d expired keys and %d keys of the other databases", stats.Expired, stats.OtherDBs)
+	}
+	for name, keys := range stats.Skipped {
+		utils.Warningf("Skipped %d keys of type %s, goldis only has strings and sorted sets", keys, name)
+	}
+	if cm.aof != nil {
+		return cm.aof.Rewrite()
+	}
+	return nil
+}
+
+// SetSaveRules sets the rules of the background saves
+func (cm *ConnectionHandler) SetSaveRules(rules []persistence.SaveRule) {
+	cm.snapshotter.SetRules(rules)
+}
+
+// SetAppendFsync sets the fsync policy of the append only file
+func (cm *ConnectionHandler) SetAppendFsync(policy persistence.FsyncPolicy) {
+	if cm.aof != nil {
+		cm.aof.SetFsync(policy)
+	}
+}
+
+// SetAOFRewriteRule sets when the append only file is rewritten automatically
+func (cm *ConnectionHandler) SetAOFRewriteRule(percentage int, minSize int64) {
+	if cm.aof != nil {
+		cm.aof.SetRewriteRule(percentage, minSize)
+	}
+}
+
+func (cm *ConnectionHandler) Save() error {
+	return cm.snapshotter.Save()
+}
+
+func (cm *ConnectionHandler) BackgroundSave() error {
+	return cm.snapshotter.BackgroundSave()
+}
+
+func (cm *ConnectionHandler) LastSave() time.Time {
+	return cm.snapshotter.LastSave()
+}
+
+func (cm *ConnectionHandler) BackgroundRewriteAOF() error {
+	if cm.aof == nil {
+		return errAppendOnlyDisabled
+	}
+	return cm.aof.BackgroundRewrite()
+}
+
+// persistenceCron runs the automatic saves and rewrites
+func (cm *ConnectionHandler) persistenceCron(now time.Time) {
+	cm.snapshotter.Cron(now)
+	if cm.aof != nil {
+		cm.aof.Cron(now)
+	}
+}
+
+// persistOnShutdown syncs the append only file, waits for the background save
+// and saves the keyspace unless the mode says otherwise
+func (cm *ConnectionHandler) persistOnShutdown(mode actions.ShutdownMode) error {
+	var aofErr error
+	if cm.aof != nil {
+		aofErr = cm.aof.Close()
+	}
+	cm.snapshotter.Wait()
+	if mode == actions.ShutdownNoSave || (mode == actions.ShutdownDefault && !cm.snapshotter.HasRules()) {
+		return aofErr
+	}
+	utils.Noticef("Saving the final snapshot before exiting")
+	return errors.Join(aofErr, cm.snapshotter.Save())
+}
@@ -0,0 +1,41 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConnectionHandler_ImportRDB(t *testing.T) {
+	// a version 3 file has no checksum: the string k set to imported
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := os.WriteFile(path, []byte("REDIS0003\x00\x01k\x08imported\xff"), 0o600); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cm := newTestHandler(t)
+	cm.dataStore.Set("k", "loaded")
+	if err := cm.Save(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := cm.Load(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cm.loadedFrom != cm.snapshotter.Path() {
+		t.Errorf("Expected the keys to be loaded from %s, got '%s'", cm.snapshotter.Path(), cm.loadedFrom)
+	}
+	if err := cm.ImportRDB(path, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := cm.dataStore.Get("k"); value != "loaded" {
+		t.Errorf("Expected the loaded keys to be kept, got '%s'", value)
+	}
+
+	cm = newTestHandler(t)
+	if err := cm.ImportRDB(path, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := cm.dataStore.Get("k"); value != "imported" {
+		t.Errorf("Expected imported, got '%s'", value)
+	}
+}
@@ -0,0 +1,26 @@
+package network
+
+import "time"
+
+// interest flags of a watched fd
+const (
+	interestRead = 1 << iota
+	interestWrite
+)
+
+type event struct {
+	fd       int
+	readable bool
+	writable bool
+}
+
+// poller watches fds and reports the ones ready for IO,
+// epoll is used on linux and select on darwin (select is built on linux too, for the tests)
+type poller interface {
+	add(fd int, interest int) error
+	modify(fd int, interest int) error
+	remove(fd int) error
+	// wait blocks until some fds are ready or the timeout expires
+	wait(timeout time.Duration) ([]event, error)
+	close() error
+}
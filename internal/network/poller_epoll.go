@@ -0,0 +1,84 @@
+//go:build linux
+
+package network
+
+import (
+	"syscall"
+	"time"
+)
+
+const maxEpollEvents = 1024
+
+type epollPoller struct {
+	epfd   int
+	events []syscall.EpollEvent
+	ready  []event
+}
+
+func newPoller() (poller, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &epollPoller{
+		epfd:   epfd,
+		events: make([]syscall.EpollEvent, maxEpollEvents),
+		ready:  make([]event, 0, maxEpollEvents),
+	}, nil
+}
+
+func (p *epollPoller) add(fd int, interest int) error {
+	ev := syscall.EpollEvent{Events: epollEvents(interest), Fd: int32(fd)}
+	return syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fd, &ev)
+}
+
+func (p *epollPoller) modify(fd int, interest int) error {
+	ev := syscall.EpollEvent{Events: epollEvents(interest), Fd: int32(fd)}
+	return syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_MOD, fd, &ev)
+}
+
+func (p *epollPoller) remove(fd int) error {
+	return syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, fd, nil)
+}
+
+func (p *epollPoller) wait(timeout time.Duration) ([]event, error) {
+	// the timeout is rounded up, a truncated sub-millisecond wait would spin until the next timer
+	n, err := syscall.EpollWait(p.epfd, p.events, int((timeout+time.Millisecond-1)/time.Millisecond))
+	if err == syscall.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.ready = p.ready[:0]
+	for _, ev := range p.events[:n] {
+		p.ready = append(p.ready, event{
+			fd: int(ev.Fd),
+			// errors and hang-ups are reported by the next read
+			readable: ev.Events&(syscall.EPOLLIN|syscall.EPOLLERR|syscall.EPOLLHUP) != 0,
+			writable: ev.Events&syscall.EPOLLOUT != 0,
+		})
+	}
+	return p.ready, nil
+}
+
+// close can be called more than once, the fd number may be reused after the first call
+func (p *epollPoller) close() error {
+	if p.epfd < 0 {
+		return nil
+	}
+	err := syscall.Close(p.epfd)
+	p.epfd = -1
+	return err
+}
+
+func epollEvents(interest int) uint32 {
+	var events uint32
+	if interest&interestRead != 0 {
+		events |= syscall.EPOLLIN
+	}
+	if interest&interestWrite != 0 {
+		events |= syscall.EPOLLOUT
+	}
+	return events
+}
@@ -0,0 +1,94 @@
+//go:build darwin || linux
+
+package network
+
+import (
+	"errors"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var errFdSetSize = errors.New("fd is out of the select range (FD_SETSIZE)")
+
+// selectPoller is the portable fallback, it can't watch fds above FD_SETSIZE
+type selectPoller struct {
+	fdMax    int
+	readFds  syscall.FdSet
+	writeFds syscall.FdSet
+	ready    []event
+}
+
+func newSelectPoller() (poller, error) {
+	return &selectPoller{fdMax: -1}, nil
+}
+
+func (p *selectPoller) add(fd int, interest int) error {
+	if fd >= syscall.FD_SETSIZE {
+		return errFdSetSize
+	}
+	if fd > p.fdMax {
+		p.fdMax = fd
+	}
+	return p.modify(fd, interest)
+}
+
+func (p *selectPoller) modify(fd int, interest int) error {
+	fdClr(fd, &p.readFds)
+	fdClr(fd, &p.writeFds)
+	if interest&interestRead != 0 {
+		fdSet(fd, &p.readFds)
+	}
+	if interest&interestWrite != 0 {
+		fdSet(fd, &p.writeFds)
+	}
+	return nil
+}
+
+func (p *selectPoller) remove(fd int) error {
+	fdClr(fd, &p.readFds)
+	fdClr(fd, &p.writeFds)
+	for p.fdMax >= 0 && !fdIsSet(p.fdMax, &p.readFds) && !fdIsSet(p.fdMax, &p.writeFds) {
+		p.fdMax--
+	}
+	return nil
+}
+
+func (p *selectPoller) wait(timeout time.Duration) ([]event, error) {
+	readFds, writeFds := p.readFds, p.writeFds
+	tv := syscall.NsecToTimeval(int64(timeout))
+	err := platformSpecificSelect(p.fdMax+1, &readFds, &writeFds, nil, &tv)
+	if err == syscall.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.ready = p.ready[:0]
+	for fd := 0; fd <= p.fdMax; fd++ {
+		readable, writable := fdIsSet(fd, &readFds), fdIsSet(fd, &writeFds)
+		if readable || writable {
+			p.ready = append(p.ready, event{fd: fd, readable: readable, writable: writable})
+		}
+	}
+	return p.ready, nil
+}
+
+func (p *selectPoller) close() error {
+	return nil
+}
+
+// nfdbits is the number of fds stored in one word of FdSet.Bits, the word size depends on the platform
+const nfdbits = 8 * int(unsafe.Sizeof(syscall.FdSet{}.Bits[0]))
+
+func fdIsSet(fd int, p *syscall.FdSet) bool {
+	return p.Bits[fd/nfdbits]&(1<<(uint(fd)%uint(nfdbits))) != 0
+}
+
+func fdSet(fd int, p *syscall.FdSet) {
+	p.Bits[fd/nfdbits] |= 1 << (uint(fd) % uint(nfdbits))
+}
+
+func fdClr(fd int, p *syscall.FdSet) {
+	p.Bits[fd/nfdbits] &^= 1 << (uint(fd) % uint(nfdbits))
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pollers are the backends built for the platform, newPoller is epoll on linux
+var pollers = map[string]func() (poller, error){
+	"default": newPoller,
+	"select":  newSelectPoller,
+}
+
+func newTestPipe(t *testing.T) (int, int) {
+	fds := make([]int, 2)
+	if err := syscall.Pipe(fds); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = syscall.Close(fds[0])
+		_ = syscall.Close(fds[1])
+	})
+	return fds[0], fds[1]
+}
+
+func TestPoller_Readiness(t *testing.T) {
+	for name, newBackend := range pollers {
+		t.Run(name, func(t *testing.T) {
+			p, err := newBackend()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer p.close()
+			readFd, writeFd := newTestPipe(t)
+			if err := p.add(readFd, interestRead); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if events, err := p.wait(0); err != nil || len(events) != 0 {
+				t.Errorf("Expected no event, got %v, %v", events, err)
+			}
+
+			_, _ = syscall.Write(writeFd, []byte{1})
+			events, err := p.wait(time.Second)
+			if err != nil || len(events) != 1 || events[0].fd != readFd || !events[0].readable || events[0].writable {
+				t.Errorf("Expected the read end to be readable, got %v, %v", events, err)
+			}
+
+			if err := p.add(writeFd, 0); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := p.modify(writeFd, interestWrite); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := p.remove(readFd); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			events, err = p.wait(time.Second)
+			if err != nil || len(events) != 1 || events[0].fd != writeFd || !events[0].writable {
+				t.Errorf("Expected only the write end to be writable, got %v, %v", events, err)
+			}
+		})
+	}
+}
+
+func TestPoller_Timeout(t *testing.T) {
+	for name, newBackend := range pollers {
+		t.Run(name, func(t *testing.T) {
+			p, err := newBackend()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer p.close()
+			readFd, _ := newTestPipe(t)
+			if err := p.add(readFd, interestRead); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			// a sub-millisecond timeout must not return at once, the event loop would spin
+			for _, timeout := range []time.Duration{300 * time.Microsecond, 20 * time.Millisecond} {
+				start := time.Now()
+				events, err := p.wait(timeout)
+				if elapsed := time.Since(start); err != nil || len(events) != 0 || elapsed < timeout {
+					t.Errorf("Expected to wait %v without event, waited %v and got %v, %v", timeout, elapsed, events, err)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,10 @@ package network
 
 import "syscall"
 
+func newPoller() (poller, error) {
+	return newSelectPoller()
+}
+
 func platformSpecificSelect(n int, r *syscall.FdSet, w *syscall.FdSet, e *syscall.FdSet, timeout *syscall.Timeval) (err error) {
 	return syscall.Select(n, r, w, e, timeout)
 }
@@ -0,0 +1,110 @@
+package network
+
+import (
+	"errors"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// shutdownFlushTimeout bounds the time spent sending the pending replies on shutdown
+const shutdownFlushTimeout = 5 * time.Second
+
+// OnShutdown registers a function run when the server stops, after the clients are gone
+// and the background work is done. The hooks run in registration order
+func (cm *ConnectionHandler) OnShutdown(hook func(mode actions.ShutdownMode) error) {
+	cm.shutdownHooks = append(cm.shutdownHooks, hook)
+}
+
+// Shutdown stops the event loop after the current iteration, it must be called on the event loop
+func (cm *ConnectionHandler) Shutdown(mode actions.ShutdownMode) {
+	if cm.shutdownMode == nil {
+		cm.shutdownMode = &mode
+	}
+}
+
+// RequestShutdown is Shutdown for the other goroutines, like a signal handler
+func (cm *ConnectionHandler) RequestShutdown(mode actions.ShutdownMode) {
+	cm.tasks.submit(func() {
+		cm.Shutdown(mode)
+	})
+}
+
+// stop stops accepting clients, sends the pending replies, waits for the background work
+// and runs the shutdown hooks
+func (cm *ConnectionHandler) stop(mode actions.ShutdownMode, cause error) error {
+	utils.Noticef("Shutting down, %d clients connected", len(cm.fdConn))
+	_ = cm.poller.remove(cm.tasks.readFd)
+	cm.tasks.close()
+	for fd, socket := range cm.listeners {
+		_ = cm.poller.remove(fd)
+		_ = socket.Close()
+	}
+	cm.listeners = make(map[int]*Socket)
+	for _, listener := range cm.tlsListeners {
+		_ = listener.Close()
+	}
+
+	cm.flushAll(shutdownFlushTimeout)
+	utils.GetThreadPoolInstance().Drain()
+
+	errs := []error{cause}
+	for _, hook := range cm.shutdownHooks {
+		if err := hook(mode); err != nil {
+			utils.Warningf("Shutdown hook failed: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	_ = cm.poller.close()
+	cm.memory.close()
+	utils.Noticef("Goldis is now ready to exit, bye bye...")
+	return errors.Join(errs...)
+}
+
+// flushAll sends the pending replies and closes every connection,
+// the ones still having replies after the timeout are closed anyway
+func (cm *ConnectionHandler) flushAll(timeout time.Duration) {
+	finish := func(connection *Connection) {
+		if _, ok := cm.fdConn[connection.Fd]; !ok {
+			return
+		}
+		if !connection.HasPendingOutput() {
+			cm.destroyConnection(connection)
+			return
+		}
+		if connection.interest != interestWrite {
+			if err := cm.poller.modify(connection.Fd, interestWrite); err != nil {
+				cm.destroyConnection(connection)
+				return
+			}
+			connection.interest = interestWrite
+		}
+	}
+	for _, connection := range cm.fdConn {
+		cm.flushConnection(connection)
+		finish(connection)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for len(cm.fdConn) > 0 {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		events, err := cm.poller.wait(remaining)
+		if err != nil {
+			break
+		}
+		for _, ev := range events {
+			if connection, ok := cm.fdConn[ev.fd]; ok {
+				cm.flushConnection(connection)
+				finish(connection)
+			}
+		}
+	}
+	for _, connection := range cm.fdConn {
+		utils.Verbosef("Dropping the pending replies of %s on socket %d", connection.RemoteAddr(), connection.Fd)
+		cm.destroyConnection(connection)
+	}
+}
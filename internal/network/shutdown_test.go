@@ -0,0 +1,78 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/command/actions"
+	"github.com/miladbarzideh/goldis/internal/persistence"
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+func TestHandler_Shutdown(t *testing.T) {
+	cm := newTestHandler(t)
+	reader, readerPeer := connect(t, cm, "127.0.0.1:5000")
+	client, clientPeer := connect(t, cm, "127.0.0.1:5001")
+	big := strings.Repeat("x", maxOutputBufferSize+4*1024*1024)
+	cm.dataStore.Set("big", big)
+	var hookMode *actions.ShutdownMode
+	cm.OnShutdown(func(mode actions.ShutdownMode) error {
+		hookMode = &mode
+		return nil
+	})
+
+	// the reply to the reader is still pending when the shutdown starts
+	send(t, cm, reader, readerPeer, "GET big\r\n")
+	if !reader.HasPendingOutput() {
+		t.Fatalf("Expected the reply to be pending")
+	}
+	send(t, cm, client, clientPeer, "SET k v\r\nSHUTDOWN SAVE\r\nSET k w\r\n")
+	if cm.shutdownMode == nil || *cm.shutdownMode != actions.ShutdownSave {
+		t.Fatalf("Expected a SAVE shutdown to be requested")
+	}
+
+	expected := resp.NewBulkString(big).AppendTo(nil, resp.Version2)
+	received := make(chan []byte)
+	go func() {
+		_ = readerPeer.SetReadDeadline(time.Now().Add(10 * time.Second))
+		buf := make([]byte, len(expected))
+		n, _ := io.ReadFull(readerPeer, buf)
+		received <- buf[:n]
+	}()
+	if err := cm.stop(*cm.shutdownMode, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if data := <-received; !bytes.Equal(data, expected) {
+		t.Errorf("Expected the whole reply before the close, got %d bytes", len(data))
+	}
+	expectClosed(t, readerPeer)
+	// the request after SHUTDOWN is not run
+	expectReply(t, clientPeer, "+OK\r\n")
+	expectClosed(t, clientPeer)
+	if len(cm.fdConn) != 0 {
+		t.Errorf("Expected every client to be closed, got %d", len(cm.fdConn))
+	}
+	if hookMode == nil || *hookMode != actions.ShutdownSave {
+		t.Errorf("Expected the hooks to run with the SAVE mode")
+	}
+	entries, err := persistence.LoadSnapshot(cm.snapshotter.Path())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	saved := false
+	for _, entry := range entries {
+		if entry.Key == "k" {
+			saved = true
+			if entry.Value != "v" {
+				t.Errorf("Expected v, got '%v'", entry.Value)
+			}
+		}
+	}
+	if !saved {
+		t.Errorf("Expected the keyspace to be saved on shutdown")
+	}
+}
@@ -1,41 +1,103 @@
 package network
 
 import (
+	"errors"
 	"net"
+	"os"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
 )
 
+// Socket is a listening socket, either TCP (IPv4 or IPv6) or Unix domain
 type Socket struct {
 	Fd int
+	// path of the socket file for a Unix domain socket
+	path string
 }
 
-func NewSocket(ip net.IP, port int) (*Socket, error) {
-	//AF_INET for IPv4 & SOCK_STREAM for TCP connection
-	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+// NewSocket creates a TCP listener on ip:port.
+// An IPv6 wildcard address (::) is dual-stack and accepts IPv4 clients too, unless v6only is set
+func NewSocket(ip net.IP, port int, v6only bool) (*Socket, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		//AF_INET for IPv4 & SOCK_STREAM for TCP connection
+		socketAddress := &syscall.SockaddrInet4{Port: port}
+		copy(socketAddress.Addr[:], ip4)
+		return listen(syscall.AF_INET, socketAddress, func(fd int) error {
+			return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		})
+	}
+
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return nil, errors.New("invalid IP address: " + ip.String())
+	}
+	socketAddress := &syscall.SockaddrInet6{Port: port}
+	copy(socketAddress.Addr[:], ip16)
+	return listen(syscall.AF_INET6, socketAddress, func(fd int) error {
+		err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		if err != nil {
+			return err
+		}
+		only := 0
+		if v6only {
+			only = 1
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, only)
+	})
+}
+
+// NewUnixSocket creates a Unix domain socket listener, a stale socket file on the path is replaced
+func NewUnixSocket(path string, perm os.FileMode) (*Socket, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	socket, err := listen(syscall.AF_UNIX, &syscall.SockaddrUnix{Name: path}, nil)
 	if err != nil {
 		return nil, err
 	}
+	socket.path = path
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			_ = socket.Close()
+			return nil, err
+		}
+	}
+	return socket, nil
+}
 
-	//configure the socket
-	err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+func listen(family int, socketAddress syscall.Sockaddr, configure func(fd int) error) (*Socket, error) {
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, 0)
 	if err != nil {
 		return nil, err
 	}
+	syscall.CloseOnExec(fd)
 
-	//bind on a wildcard address 0.0.0.0:8585
-	socketAddress := &syscall.SockaddrInet4{
-		Port: port,
-		Addr: [4]byte(ip),
+	//configure the socket
+	if configure != nil {
+		if err := configure(fd); err != nil {
+			_ = syscall.Close(fd)
+			return nil, err
+		}
 	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+
 	if err := syscall.Bind(fd, socketAddress); err != nil {
+		_ = syscall.Close(fd)
 		return nil, err
 	}
 
 	//listen
 	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		_ = syscall.Close(fd)
 		return nil, err
 	}
 	return &Socket{Fd: fd}, nil
@@ -47,9 +109,45 @@ func (s Socket) Accept() (*Connection, error) {
 		return nil, err
 	}
 	syscall.CloseOnExec(fd)
-	return &Connection{Fd: fd, Addr: addr, idleStart: time.Now(), idleNode: datastore.LNode{}}, nil
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+	remoteAddr := formatSockaddr(addr)
+	if s.path != "" {
+		// the peers of a Unix domain socket are usually unnamed
+		remoteAddr = s.path + ":0"
+	} else {
+		// replies are small and latency matters more than packet count
+		_ = syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1)
+	}
+	return &Connection{
+		Fd:         fd,
+		Addr:       addr,
+		remoteAddr: remoteAddr,
+		idleStart:  time.Now(),
+		idleNode:   datastore.LNode{},
+		protocol:   resp.Version2,
+	}, nil
 }
 
 func (s Socket) Close() error {
-	return syscall.Close(s.Fd)
+	err := syscall.Close(s.Fd)
+	if s.path != "" {
+		_ = os.Remove(s.path)
+	}
+	return err
+}
+
+// formatSockaddr formats the address as ip:port, [ip]:port for IPv6 or the path for Unix domain sockets
+func formatSockaddr(addr syscall.Sockaddr) string {
+	switch a := addr.(type) {
+	case *syscall.SockaddrInet4:
+		return net.JoinHostPort(net.IP(a.Addr[:]).String(), strconv.Itoa(a.Port))
+	case *syscall.SockaddrInet6:
+		return net.JoinHostPort(net.IP(a.Addr[:]).String(), strconv.Itoa(a.Port))
+	case *syscall.SockaddrUnix:
+		return a.Name
+	}
+	return "?"
 }
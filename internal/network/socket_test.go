@@ -0,0 +1,158 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func socketPort(t *testing.T, socket *Socket) int {
+	addr, err := syscall.Getsockname(socket.Fd)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	switch a := addr.(type) {
+	case *syscall.SockaddrInet4:
+		return a.Port
+	case *syscall.SockaddrInet6:
+		return a.Port
+	}
+	t.Fatalf("Expected a TCP address, got %v", addr)
+	return 0
+}
+
+// accept waits for the pending connection of the nonblocking listener
+func accept(t *testing.T, socket *Socket) *Connection {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		connection, err := socket.Accept()
+		if err == syscall.EAGAIN {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		t.Cleanup(func() {
+			_ = connection.Close()
+		})
+		return connection
+	}
+	t.Fatalf("Expected a connection to accept")
+	return nil
+}
+
+func dial(t *testing.T, network string, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestSocket_IPv4(t *testing.T) {
+	socket, err := NewSocket(net.ParseIP("127.0.0.1"), 0, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer socket.Close()
+	conn := dial(t, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(socketPort(t, socket))))
+
+	connection := accept(t, socket)
+	if connection.RemoteAddr() != conn.LocalAddr().String() {
+		t.Errorf("Expected %s, got %s", conn.LocalAddr(), connection.RemoteAddr())
+	}
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	err = connection.Read()
+	for deadline := time.Now().Add(time.Second); err == syscall.EAGAIN && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		err = connection.Read()
+	}
+	if err != nil || string(connection.inBuf) != "PING\r\n" {
+		t.Errorf("Expected to read PING, got %q, %v", connection.inBuf, err)
+	}
+}
+
+func TestSocket_DualStack(t *testing.T) {
+	socket, err := NewSocket(net.IPv6unspecified, 0, false)
+	if err != nil {
+		t.Skipf("IPv6 isn't available: %v", err)
+	}
+	defer socket.Close()
+	port := strconv.Itoa(socketPort(t, socket))
+
+	conn := dial(t, "tcp4", net.JoinHostPort("127.0.0.1", port))
+	connection := accept(t, socket)
+	if connection.RemoteAddr() != conn.LocalAddr().String() {
+		t.Errorf("Expected the IPv4 client %s, got %s", conn.LocalAddr(), connection.RemoteAddr())
+	}
+	if conn, err := net.DialTimeout("tcp6", net.JoinHostPort("::1", port), time.Second); err == nil {
+		defer conn.Close()
+		if connection := accept(t, socket); connection.RemoteAddr() != conn.LocalAddr().String() {
+			t.Errorf("Expected the IPv6 client %s, got %s", conn.LocalAddr(), connection.RemoteAddr())
+		}
+	}
+}
+
+func TestSocket_V6Only(t *testing.T) {
+	socket, err := NewSocket(net.IPv6unspecified, 0, true)
+	if err != nil {
+		t.Skipf("IPv6 isn't available: %v", err)
+	}
+	defer socket.Close()
+	// an IPv4 listener can share the port of a v6only listener
+	port := socketPort(t, socket)
+	ipv4, err := NewSocket(net.ParseIP("127.0.0.1"), port, false)
+	if err != nil {
+		t.Fatalf("Expected the IPv4 listener to bind the port, got %v", err)
+	}
+	defer ipv4.Close()
+
+	dial(t, "tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	accept(t, ipv4)
+	if _, err := socket.Accept(); err != syscall.EAGAIN {
+		t.Errorf("Expected no IPv4 client on the v6only listener, got %v", err)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goldis.sock")
+	stale, err := NewUnixSocket(path, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// a crashed server leaves the socket file behind
+	_ = syscall.Close(stale.Fd)
+
+	socket, err := NewUnixSocket(path, 0700)
+	if err != nil {
+		t.Fatalf("Expected the stale socket file to be replaced, got %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected the permissions 0700, got %v, %v", info.Mode(), err)
+	}
+	dial(t, "unix", path)
+	if connection := accept(t, socket); connection.RemoteAddr() != path+":0" {
+		t.Errorf("Expected %s:0, got %s", path, connection.RemoteAddr())
+	}
+
+	_ = socket.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket file to be removed, got %v", err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewUnixSocket(path, 0); err == nil {
+		t.Errorf("Expected a regular file not to be replaced")
+	}
+}
@@ -0,0 +1,208 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TLS client certificate verification modes
+const (
+	TLSAuthClientsNo       = "no"
+	TLSAuthClientsYes      = "yes"
+	TLSAuthClientsOptional = "optional"
+)
+
+// TLSSettings are the files and options of the TLS listener
+type TLSSettings struct {
+	CertFile    string
+	KeyFile     string
+	CAFile      string
+	AuthClients string
+}
+
+// TLSListener accepts TLS clients. crypto/tls needs blocking IO, so every client is terminated
+// in its own goroutines and bridged to the event loop through a socketpair: the ConnectionHandler
+// only sees the plaintext side and handshakes or records spanning reads never reach the loop.
+type TLSListener struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	settings TLSSettings
+	config   atomic.Pointer[tls.Config]
+}
+
+// NewTLSListener loads the certificates and listens on addr (host:port),
+// network is tcp, tcp4 or tcp6 (tcp6 makes an IPv6 wildcard address v6only)
+func NewTLSListener(network string, addr string, settings TLSSettings) (*TLSListener, error) {
+	l := &TLSListener{settings: settings}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	l.listener = listener
+	return l, nil
+}
+
+// Reload reads the certificate, key and CA files again,
+// new handshakes use them while the established connections are not affected
+func (l *TLSListener) Reload() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	config, err := loadTLSConfig(l.settings)
+	if err != nil {
+		return err
+	}
+	l.config.Store(config)
+	return nil
+}
+
+// Update loads new settings, the current ones are kept when the files can't be loaded
+func (l *TLSListener) Update(settings TLSSettings) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	config, err := loadTLSConfig(settings)
+	if err != nil {
+		return err
+	}
+	l.settings = settings
+	l.config.Store(config)
+	return nil
+}
+
+func (l *TLSListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *TLSListener) Close() error {
+	return l.listener.Close()
+}
+
+func loadTLSConfig(settings TLSSettings) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	switch settings.AuthClients {
+	case TLSAuthClientsNo:
+		config.ClientAuth = tls.NoClientCert
+	case TLSAuthClientsYes, "":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case TLSAuthClientsOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid tls-auth-clients value: %s", settings.AuthClients)
+	}
+	if config.ClientAuth == tls.NoClientCert {
+		return config, nil
+	}
+
+	if settings.CAFile == "" {
+		return nil, errors.New("tls-ca-cert-file is required to verify client certificates")
+	}
+	pem, err := os.ReadFile(settings.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", settings.CAFile)
+	}
+	config.ClientCAs = pool
+	return config, nil
+}
+
+// serve accepts TLS clients until the listener is closed and passes the plaintext side to handoff
+func (l *TLSListener) serve(handoff func(*Connection)) {
+	for {
+		conn, err := l.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			utils.Warningf("TLS Accept(): %v", err)
+			continue
+		}
+		go l.terminate(conn, handoff)
+	}
+}
+
+// terminate runs the handshake and proxies the records between the client and the event loop
+func (l *TLSListener) terminate(conn net.Conn, handoff func(*Connection)) {
+	tlsConn := tls.Server(conn, l.config.Load())
+	_ = tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		utils.Verbosef("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+		_ = tlsConn.Close()
+		return
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		utils.Warningf("Socketpair(): %v", err)
+		_ = tlsConn.Close()
+		return
+	}
+	loopFd, proxyFd := fds[0], fds[1]
+	syscall.CloseOnExec(loopFd)
+	syscall.CloseOnExec(proxyFd)
+	if err := syscall.SetNonblock(loopFd, true); err != nil {
+		_ = syscall.Close(loopFd)
+		_ = syscall.Close(proxyFd)
+		_ = tlsConn.Close()
+		return
+	}
+	proxyFile := os.NewFile(uintptr(proxyFd), "tls-proxy")
+	plain, err := net.FileConn(proxyFile)
+	_ = proxyFile.Close()
+	if err != nil {
+		_ = syscall.Close(loopFd)
+		_ = tlsConn.Close()
+		return
+	}
+
+	handoff(&Connection{
+		Fd:         loopFd,
+		remoteAddr: tlsConn.RemoteAddr().String(),
+		idleStart:  time.Now(),
+		idleNode:   datastore.LNode{},
+		protocol:   resp.Version2,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		// replies from the event loop to the client
+		_, _ = io.Copy(tlsConn, plain)
+		_ = tlsConn.Close()
+		close(done)
+	}()
+	// requests from the client to the event loop
+	_, _ = io.Copy(plain, tlsConn)
+	if unixConn, ok := plain.(*net.UnixConn); ok {
+		_ = unixConn.CloseWrite()
+	}
+	<-done
+	_ = plain.Close()
+}
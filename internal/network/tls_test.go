@@ -0,0 +1,211 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and its key,
+// it is its own CA so that it can verify a client too
+func writeTestCertificate(t *testing.T, dir string, serial int64) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// newTestTLSListener serves a TLS listener on a random port and returns the handed off connections
+func newTestTLSListener(t *testing.T, settings TLSSettings) (*TLSListener, chan *Connection) {
+	listener, err := NewTLSListener("tcp", "127.0.0.1:0", settings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	handedOff := make(chan *Connection, 1)
+	go listener.serve(func(connection *Connection) {
+		handedOff <- connection
+	})
+	return listener, handedOff
+}
+
+func dialTLS(t *testing.T, listener *TLSListener, config *tls.Config) *tls.Conn {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	return conn
+}
+
+func rootCAs(certs ...*x509.Certificate) *tls.Config {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return &tls.Config{RootCAs: pool}
+}
+
+// loopSide returns the plaintext side of a handed off connection as a file with deadlines
+func loopSide(t *testing.T, handedOff chan *Connection) (*Connection, *os.File) {
+	select {
+	case connection := <-handedOff:
+		file := os.NewFile(uintptr(connection.Fd), "loop")
+		t.Cleanup(func() {
+			_ = file.Close()
+		})
+		_ = file.SetDeadline(time.Now().Add(time.Second))
+		return connection, file
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the connection to be handed off")
+		return nil, nil
+	}
+}
+
+func TestTLSListener_Bridge(t *testing.T) {
+	certFile, keyFile, cert := writeTestCertificate(t, t.TempDir(), 1)
+	listener, handedOff := newTestTLSListener(t, TLSSettings{CertFile: certFile, KeyFile: keyFile, AuthClients: TLSAuthClientsNo})
+	conn := dialTLS(t, listener, rootCAs(cert))
+
+	// a request split over several records reaches the event loop as a byte stream
+	for _, part := range []string{"*1\r\n$4\r\n", "PI", "NG\r\n"} {
+		if _, err := conn.Write([]byte(part)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	connection, loop := loopSide(t, handedOff)
+	if connection.RemoteAddr() != conn.LocalAddr().String() {
+		t.Errorf("Expected %s, got %s", conn.LocalAddr(), connection.RemoteAddr())
+	}
+	request := make([]byte, len("*1\r\n$4\r\nPING\r\n"))
+	if _, err := io.ReadFull(loop, request); err != nil || string(request) != "*1\r\n$4\r\nPING\r\n" {
+		t.Errorf("Expected the PING request, got %q, %v", request, err)
+	}
+
+	if _, err := loop.Write([]byte("+PONG\r\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reply := make([]byte, len("+PONG\r\n"))
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "+PONG\r\n" {
+		t.Errorf("Expected PONG, got %q, %v", reply, err)
+	}
+
+	// closing the loop side ends the TLS connection
+	_ = loop.Close()
+	if _, err := conn.Read(reply); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestTLSListener_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, first := writeTestCertificate(t, dir, 1)
+	listener, _ := newTestTLSListener(t, TLSSettings{CertFile: certFile, KeyFile: keyFile, AuthClients: TLSAuthClientsNo})
+	conn := dialTLS(t, listener, rootCAs(first))
+
+	_, _, second := writeTestCertificate(t, dir, 2)
+	if err := listener.Reload(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reloaded := dialTLS(t, listener, rootCAs(second))
+	if serial := reloaded.ConnectionState().PeerCertificates[0].SerialNumber; serial.Int64() != 2 {
+		t.Errorf("Expected the reloaded certificate, got serial %v", serial)
+	}
+	if serial := conn.ConnectionState().PeerCertificates[0].SerialNumber; serial.Int64() != 1 {
+		t.Errorf("Expected the established connection to keep its certificate, got serial %v", serial)
+	}
+
+	missing := TLSSettings{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile, AuthClients: TLSAuthClientsNo}
+	if err := listener.Update(missing); err == nil {
+		t.Errorf("Expected an error for a missing certificate")
+	}
+	dialTLS(t, listener, rootCAs(second))
+}
+
+func TestTLSListener_ClientAuth(t *testing.T) {
+	certFile, keyFile, cert := writeTestCertificate(t, t.TempDir(), 1)
+	settings := TLSSettings{CertFile: certFile, KeyFile: keyFile, CAFile: certFile, AuthClients: TLSAuthClientsYes}
+	listener, handedOff := newTestTLSListener(t, settings)
+
+	anonymous := dialTLS(t, listener, rootCAs(cert))
+	// the server rejects the handshake after the client considers it done
+	if _, err := anonymous.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Expected a client without certificate to be rejected")
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := rootCAs(cert)
+	config.Certificates = []tls.Certificate{pair}
+	conn := dialTLS(t, listener, config)
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loopSide(t, handedOff)
+
+	if _, err := NewTLSListener("tcp", "127.0.0.1:0", TLSSettings{CertFile: certFile, KeyFile: keyFile}); err == nil {
+		t.Errorf("Expected an error without a CA to verify the clients")
+	}
+}
+
+func TestHandler_TLSHandoffAfterShutdown(t *testing.T) {
+	cm := newTestHandler(t)
+	certFile, keyFile, cert := writeTestCertificate(t, t.TempDir(), 1)
+	listener, err := NewTLSListener("tcp", "127.0.0.1:0", TLSSettings{CertFile: certFile, KeyFile: keyFile, AuthClients: TLSAuthClientsNo})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer listener.Close()
+	cm.AddTLSListener(listener)
+	// the event loop is closed while the handshake runs
+	cm.tasks.close()
+
+	conn := dialTLS(t, listener, rootCAs(cert))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the dropped connection to be closed, got %v", err)
+	}
+}
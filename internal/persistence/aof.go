@@ -0,0 +1,553 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// FsyncPolicy tells when the appended commands are flushed to the disk
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs every command before replying, FsyncEverySec once per second
+	// and FsyncNo leaves it to the operating system
+	FsyncAlways FsyncPolicy = iota
+	FsyncEverySec
+	FsyncNo
+)
+
+var fsyncPolicies = map[string]FsyncPolicy{"always": FsyncAlways, "everysec": FsyncEverySec, "no": FsyncNo}
+
+func ParseFsyncPolicy(value string) (FsyncPolicy, error) {
+	policy, ok := fsyncPolicies[strings.ToLower(value)]
+	if !ok {
+		return FsyncEverySec, errors.New("expected always, everysec or no")
+	}
+	return policy, nil
+}
+
+func (p FsyncPolicy) String() string {
+	for name, policy := range fsyncPolicies {
+		if policy == p {
+			return name
+		}
+	}
+	return strconv.Itoa(int(p))
+}
+
+var ErrRewriteInProgress = errors.New("background append only file rewriting already in progress")
+
+// AppendOnlyFile logs the write commands, replaying them rebuilds the keyspace.
+// The file is written by the event loop, the everysec fsync runs in another goroutine
+type AppendOnlyFile struct {
+	dataStore *datastore.DataStore
+	path      string
+	// submit runs the end of a background rewrite on the event loop
+	submit func(task func()) bool
+	// mutex guards file and fsync against the fsync goroutine, the event loop is the only writer
+	mutex    sync.Mutex
+	file     *os.File
+	fsync    FsyncPolicy
+	unsynced atomic.Bool
+	stop     chan struct{}
+	// buf holds the commands not written yet, they stay there after a failed write to be written again
+	buf []byte
+	// writeErr is the error of the last write, nil once a write succeeds
+	writeErr error
+	// size is the size of the file, baseSize its size after the last rewrite
+	size     int64
+	baseSize int64
+	// the file is rewritten in the background once it grew by rewritePercentage and is over rewriteMinSize
+	rewritePercentage int
+	rewriteMinSize    int64
+	rewrite           *rewriteJob
+	lastFailure       time.Time
+}
+
+// rewriteJob is a background rewrite, buf holds the commands appended meanwhile
+type rewriteJob struct {
+	done chan struct{}
+	buf  []byte
+	tmp  string
+	err  error
+}
+
+func NewAppendOnlyFile(dataStore *datastore.DataStore, path string, submit func(task func()) bool) *AppendOnlyFile {
+	return &AppendOnlyFile{dataStore: dataStore, path: path, submit: submit, fsync: FsyncEverySec}
+}
+
+func (a *AppendOnlyFile) Path() string {
+	return a.path
+}
+
+// SetFsync changes the fsync policy
+func (a *AppendOnlyFile) SetFsync(policy FsyncPolicy) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.fsync = policy
+}
+
+// SetRewriteRule sets the growth in percent and the min size triggering a rewrite, a zero percentage disables it
+func (a *AppendOnlyFile) SetRewriteRule(percentage int, minSize int64) {
+	a.rewritePercentage = percentage
+	a.rewriteMinSize = minSize
+}
+
+// Exists reports whether there's a file to replay
+func (a *AppendOnlyFile) Exists() bool {
+	_, err := os.Stat(a.path)
+	return err == nil
+}
+
+// Load replays the commands of the file and returns their number, the commands of a MULTI ... EXEC block
+// are applied on EXEC. A command or a transaction cut by a crash at the end of the file is dropped
+// with a warning and the file is truncated, any other damage is an error
+func (a *AppendOnlyFile) Load() (int, error) {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return 0, err
+	}
+	count, offset := 0, 0
+	// multiAt is the offset of the MULTI of the current transaction, -1 outside of a transaction
+	multiAt := -1
+	var queued [][]string
+	for offset < len(data) {
+		if data[offset] != '*' {
+			return count, fmt.Errorf("%s is corrupted at offset %d, expected a command", a.path, offset)
+		}
+		args, n, err := resp.ParseCommand(data[offset:])
+		if err == resp.ErrIncomplete {
+			break
+		}
+		if err == nil {
+			switch name := strings.ToLower(args[0]); {
+			case name == "multi" && len(args) == 1 && multiAt < 0:
+				multiAt = offset
+			case name == "exec" && len(args) == 1 && multiAt >= 0:
+				for _, command := range queued {
+					if err = a.apply(command); err != nil {
+						break
+					}
+					count++
+				}
+				multiAt, queued = -1, nil
+			case multiAt >= 0:
+				queued = append(queued, args)
+			default:
+				if err = a.apply(args); err == nil {
+					count++
+				}
+			}
+		}
+		if err != nil {
+			return count, fmt.Errorf("%s is corrupted at offset %d: %w", a.path, offset, err)
+		}
+		offset += n
+	}
+	if multiAt >= 0 {
+		offset = multiAt
+	}
+	if offset < len(data) {
+		utils.Warningf("The append only file %s ends with an incomplete command or transaction, "+
+			"dropping its last %d bytes", a.path, len(data)-offset)
+		if err := os.Truncate(a.path, int64(offset)); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// apply runs a logged command on the keyspace
+func (a *AppendOnlyFile) apply(args []string) error {
+	name := strings.ToLower(args[0])
+	switch {
+	case name == "set" && len(args) == 3:
+		a.dataStore.Set(args[1], args[2])
+	case name == "del" && len(args) == 2:
+		a.dataStore.Delete(args[1])
+	case name == "zadd" && len(args) == 4:
+		score, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return errors.New("invalid score")
+		}
+		if _, err := a.dataStore.ZAdd(args[1], score, args[3]); err != nil {
+			return err
+		}
+	case name == "zrem" && len(args) == 3:
+		a.dataStore.ZRemove(args[1], args[2])
+	case (name == "pexpire" || name == "pexpireat") && len(args) == 3:
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errors.New("invalid expiration")
+		}
+		if name == "pexpireat" {
+			a.dataStore.ExpireAt(args[1], ms)
+		} else {
+			a.dataStore.Expire(args[1], ms)
+		}
+	case name == "restore" && len(args) >= 4:
+		// only the successful commands are logged, REPLACE doesn't matter
+		entry, err := ParsePayload(args[1], []byte(args[3]))
+		if err != nil {
+			return err
+		}
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errors.New("invalid ttl")
+		}
+		if ms > 0 && !hasOption(args[4:], "absttl") {
+			ms += time.Now().UnixMilli()
+		}
+		entry.ExpireAt = ms
+		a.dataStore.Restore(entry)
+	default:
+		return fmt.Errorf("unexpected command '%s' with %d arguments", args[0], len(args)-1)
+	}
+	return nil
+}
+
+// Open starts appending to the file, it's created when missing
+func (a *AppendOnlyFile) Open() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	a.file = file
+	a.size, a.baseSize = info.Size(), info.Size()
+	a.stop = make(chan struct{})
+	go a.syncEverySecond(a.stop)
+	return nil
+}
+
+// Rewrite replaces the file with the commands rebuilding the current keyspace, it blocks the clients
+func (a *AppendOnlyFile) Rewrite() error {
+	tmp, err := writeRewrite(a.path, a.dataStore.Entries())
+	if err != nil {
+		return err
+	}
+	if a.file == nil {
+		err = os.Rename(tmp, a.path)
+	} else {
+		err = a.switchTo(&rewriteJob{tmp: tmp})
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// Append logs write commands with a single write, PEXPIRE and RESTORE are logged with an absolute time
+// so that the replay keeps the deadline. A failed write is returned and the commands are written
+// again with the next ones
+func (a *AppendOnlyFile) Append(commands ...[]string) error {
+	if a.file == nil {
+		return nil
+	}
+	start := len(a.buf)
+	for _, args := range commands {
+		a.buf = resp.NewBulkArray(absoluteTTL(args)).AppendTo(a.buf, resp.Version2)
+	}
+	if a.rewrite != nil {
+		a.rewrite.buf = append(a.rewrite.buf, a.buf[start:]...)
+	}
+	return a.flush()
+}
+
+// WriteError returns the error of the last write, nil once a write succeeds
+func (a *AppendOnlyFile) WriteError() error {
+	return a.writeErr
+}
+
+// flush writes the buffered commands and syncs them when the policy says so
+func (a *AppendOnlyFile) flush() error {
+	if len(a.buf) > 0 {
+		n, err := a.file.Write(a.buf)
+		if err != nil {
+			// a partial command would make the replay fail
+			if n > 0 {
+				_ = a.file.Truncate(a.size)
+			}
+			return a.failed(err)
+		}
+		a.size += int64(n)
+		a.buf = a.buf[:0]
+	}
+	a.mutex.Lock()
+	policy := a.fsync
+	a.mutex.Unlock()
+	switch policy {
+	case FsyncAlways:
+		if err := a.file.Sync(); err != nil {
+			return a.failed(err)
+		}
+	case FsyncEverySec:
+		a.unsynced.Store(true)
+	}
+	if a.writeErr != nil {
+		utils.Noticef("Writing to the append only file succeeded again")
+		a.writeErr = nil
+	}
+	return nil
+}
+
+func (a *AppendOnlyFile) failed(err error) error {
+	if a.writeErr == nil {
+		utils.Warningf("Writing to the append only file failed, the write commands are refused: %v", err)
+	}
+	a.writeErr = err
+	return err
+}
+
+// absoluteTTL rewrites the relative ttl of PEXPIRE and RESTORE to a unix time in milliseconds
+func absoluteTTL(args []string) []string {
+	name := strings.ToLower(args[0])
+	if (name != "pexpire" || len(args) != 3) && (name != "restore" || len(args) < 4) {
+		return args
+	}
+	ttl, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || ttl <= 0 {
+		return args
+	}
+	at := strconv.FormatInt(time.Now().UnixMilli()+ttl, 10)
+	if name == "pexpire" {
+		return []string{"PEXPIREAT", args[1], at}
+	}
+	if hasOption(args[4:], "absttl") {
+		return args
+	}
+	return append(append([]string{"RESTORE", args[1], at}, args[3:]...), "ABSTTL")
+}
+
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if strings.EqualFold(o, option) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AppendOnlyFile) syncEverySecond(stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !a.unsynced.Swap(false) {
+			continue
+		}
+		a.mutex.Lock()
+		if a.file != nil && a.fsync == FsyncEverySec {
+			if err := a.file.Sync(); err != nil {
+				utils.Warningf("Syncing the append only file failed: %v", err)
+			}
+		}
+		a.mutex.Unlock()
+	}
+}
+
+// BackgroundRewrite copies the keyspace and writes the commands rebuilding it in another goroutine,
+// the commands appended meanwhile are added to the new file before it replaces the current one.
+// The clients wait for the copy, which is logged with its duration
+func (a *AppendOnlyFile) BackgroundRewrite() error {
+	if a.rewrite != nil {
+		return ErrRewriteInProgress
+	}
+	entries := a.dataStore.Entries()
+	job := &rewriteJob{done: make(chan struct{})}
+	a.rewrite = job
+	utils.Noticef("Background append only file rewriting started, copying the %d keys took %v",
+		len(entries), a.dataStore.Stats().LatestCopy)
+	go func() {
+		job.tmp, job.err = writeRewrite(a.path, entries)
+		close(job.done)
+		if !a.submit(func() { a.rewritten(job) }) && job.tmp != "" {
+			_ = os.Remove(job.tmp)
+		}
+	}()
+	return nil
+}
+
+// rewritten switches to the rewritten file
+func (a *AppendOnlyFile) rewritten(job *rewriteJob) {
+	if a.rewrite != job {
+		return
+	}
+	a.rewrite = nil
+	err := job.err
+	if err == nil {
+		err = a.switchTo(job)
+	}
+	if err != nil {
+		if job.tmp != "" {
+			_ = os.Remove(job.tmp)
+		}
+		a.lastFailure = time.Now()
+		utils.Warningf("Background append only file rewriting failed: %v", err)
+		return
+	}
+	a.lastFailure = time.Time{}
+	utils.Noticef("Background append only file rewriting finished, the file is %d bytes", a.size)
+}
+
+func (a *AppendOnlyFile) switchTo(job *rewriteJob) error {
+	file, err := os.OpenFile(job.tmp, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(job.buf); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := os.Rename(job.tmp, a.path); err != nil {
+		_ = file.Close()
+		return err
+	}
+	a.mutex.Lock()
+	previous := a.file
+	a.file = file
+	a.mutex.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+	a.size, a.baseSize = info.Size(), info.Size()
+	// the new file holds the commands a failed write left behind
+	a.buf = a.buf[:0]
+	a.writeErr = nil
+	return nil
+}
+
+// InProgress reports whether a background rewrite is running
+func (a *AppendOnlyFile) InProgress() bool {
+	return a.rewrite != nil
+}
+
+// Cron writes again the commands of a failed write and starts a background rewrite
+// when the file grew too much, it's called about every second
+func (a *AppendOnlyFile) Cron(now time.Time) {
+	if a.file != nil && a.writeErr != nil {
+		_ = a.flush()
+	}
+	if a.file == nil || a.rewrite != nil || a.rewritePercentage <= 0 || now.Sub(a.lastFailure) < retryDelay {
+		return
+	}
+	base := a.baseSize
+	if base == 0 {
+		base = 1
+	}
+	growth := (a.size - base) * 100 / base
+	if a.size >= a.rewriteMinSize && growth >= int64(a.rewritePercentage) {
+		utils.Noticef("Starting automatic rewriting of the append only file on %d%% growth", growth)
+		_ = a.BackgroundRewrite()
+	}
+}
+
+// Close waits for the background rewrite, whose result is dropped, writes the commands left by a failed write
+// and syncs the file
+func (a *AppendOnlyFile) Close() error {
+	if job := a.rewrite; job != nil {
+		<-job.done
+		if job.tmp != "" {
+			_ = os.Remove(job.tmp)
+		}
+		a.rewrite = nil
+	}
+	if a.file == nil {
+		return nil
+	}
+	close(a.stop)
+	// the commands left by a failed write get a last chance
+	err := a.flush()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if syncErr := a.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.file = nil
+	return err
+}
+
+// writeRewrite writes the commands rebuilding the entries to a synced temp file next to path
+func writeRewrite(path string, entries []datastore.Entry) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	fail := func(err error) (string, error) {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return fail(err)
+	}
+	buf := make([]byte, 0, 64*1024)
+	for _, entry := range entries {
+		buf = appendEntryCommands(buf, entry)
+		if len(buf) >= 64*1024 {
+			if _, err := tmp.Write(buf); err != nil {
+				return fail(err)
+			}
+			buf = buf[:0]
+		}
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// appendEntryCommands appends the SET or ZADD commands creating the entry and its PEXPIREAT
+func appendEntryCommands(buf []byte, entry datastore.Entry) []byte {
+	if entry.Type == datastore.ZSET {
+		for _, member := range entry.Members {
+			score := strconv.FormatFloat(member.Score, 'g', -1, 64)
+			buf = resp.NewBulkArray([]string{"ZADD", entry.Key, score, member.Name}).AppendTo(buf, resp.Version2)
+		}
+	} else {
+		buf = resp.NewBulkArray([]string{"SET", entry.Key, entry.Value}).AppendTo(buf, resp.Version2)
+	}
+	if entry.ExpireAt != 0 {
+		at := strconv.FormatInt(entry.ExpireAt, 10)
+		buf = resp.NewBulkArray([]string{"PEXPIREAT", entry.Key, at}).AppendTo(buf, resp.Version2)
+	}
+	return buf
+}
@@ -0,0 +1,212 @@
+package persistence
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+func openTestAOF(t *testing.T, path string) (*AppendOnlyFile, *datastore.DataStore) {
+	dataStore := datastore.NewDataStore()
+	aof := NewAppendOnlyFile(dataStore, path, func(task func()) bool {
+		task()
+		return true
+	})
+	if _, err := aof.Load(); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := aof.Open(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return aof, dataStore
+}
+
+func TestAppendOnlyFile_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, _ := openTestAOF(t, path)
+	aof.SetFsync(FsyncAlways)
+	for _, command := range [][]string{
+		{"SET", "k", "v"}, {"SET", "gone", "x"}, {"DEL", "gone"},
+		{"ZADD", "z", "1", "a"}, {"ZADD", "z", "2", "b"}, {"ZREM", "z", "b"},
+		{"PEXPIRE", "k", "60000"},
+	} {
+		aof.Append(command)
+	}
+	if err := aof.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	restored := datastore.NewDataStore()
+	count, err := NewAppendOnlyFile(restored, path, nil).Load()
+	if err != nil || count != 7 {
+		t.Fatalf("Expected 7 commands, got %d, %v", count, err)
+	}
+	if value, _ := restored.Get("k"); value != "v" {
+		t.Errorf("Expected v, got '%s'", value)
+	}
+	if _, err := restored.Get("gone"); err != datastore.ErrNotFound {
+		t.Errorf("Expected the deleted key to stay deleted")
+	}
+	if _, ok := restored.ZScore("z", "b"); ok {
+		t.Errorf("Expected the removed member to stay removed")
+	}
+	if ttl := restored.Ttl("k"); ttl <= 0 || ttl > 60000 {
+		t.Errorf("Expected the ttl to be kept, got %d", ttl)
+	}
+}
+
+func TestAppendOnlyFile_Truncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	complete := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n"
+	if err := os.WriteFile(path, []byte(complete+"*3\r\n$3\r\nSET\r\n$1\r\nx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dataStore := datastore.NewDataStore()
+	count, err := NewAppendOnlyFile(dataStore, path, nil).Load()
+	if err != nil || count != 1 {
+		t.Fatalf("Expected the complete command to be replayed, got %d, %v", count, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != complete {
+		t.Errorf("Expected the incomplete command to be truncated, got %q", content)
+	}
+
+	if err := os.WriteFile(path, []byte("*1\r\n$4\r\nPING\r\n"+complete), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAppendOnlyFile(dataStore, path, nil).Load(); err == nil {
+		t.Errorf("Expected an error for an unexpected command")
+	}
+}
+
+func TestAppendOnlyFile_Transaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, _ := openTestAOF(t, path)
+	aof.Append([]string{"MULTI"}, []string{"SET", "a", "1"}, []string{"SET", "b", "2"}, []string{"EXEC"})
+	aof.Append([]string{"SET", "c", "3"})
+	if err := aof.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	complete, _ := os.ReadFile(path)
+	// a crash in the middle of a transaction leaves its MULTI without EXEC
+	partial := "*1\r\n$5\r\nMULTI\r\n*3\r\n$3\r\nSET\r\n$1\r\nd\r\n$1\r\n4\r\n*3\r\n$3\r\nSET\r\n$1"
+	if err := os.WriteFile(path, append(append([]byte(nil), complete...), partial...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dataStore := datastore.NewDataStore()
+	count, err := NewAppendOnlyFile(dataStore, path, nil).Load()
+	if err != nil || count != 3 {
+		t.Fatalf("Expected the 3 complete commands to be replayed, got %d, %v", count, err)
+	}
+	if _, err := dataStore.Get("d"); err != datastore.ErrNotFound {
+		t.Errorf("Expected the incomplete transaction to be dropped")
+	}
+	if value, _ := dataStore.Get("b"); value != "2" {
+		t.Errorf("Expected 2, got '%s'", value)
+	}
+	if content, _ := os.ReadFile(path); string(content) != string(complete) {
+		t.Errorf("Expected the incomplete transaction to be truncated, got %q", content)
+	}
+}
+
+func TestAppendOnlyFile_BackgroundRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, _ := openTestAOF(t, path)
+	for i := 0; i < 100; i++ {
+		aof.Append([]string{"SET", "k", "v"})
+	}
+	aof.Append([]string{"ZADD", "z", "-inf", "a"})
+	aof.Append([]string{"PEXPIRE", "z", "60000"})
+	aof.dataStore.Set("k", "v")
+	_, _ = aof.dataStore.ZAdd("z", math.Inf(-1), "a")
+	aof.dataStore.ExpireAt("z", time.Now().Add(time.Minute).UnixMilli())
+	before := aof.size
+
+	tasks := make(chan func(), 1)
+	aof.submit = func(task func()) bool {
+		tasks <- task
+		return true
+	}
+	if err := aof.BackgroundRewrite(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// the command appended during the rewrite must be kept
+	aof.Append([]string{"SET", "late", "1"})
+	(<-tasks)()
+	if aof.InProgress() {
+		t.Fatalf("Expected the rewrite to be done")
+	}
+	if aof.size >= before {
+		t.Errorf("Expected the file to shrink from %d bytes, got %d", before, aof.size)
+	}
+	_ = aof.Close()
+
+	restored := datastore.NewDataStore()
+	if _, err := NewAppendOnlyFile(restored, path, nil).Load(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := restored.Get("late"); value != "1" {
+		t.Errorf("Expected the late write to be kept, got '%s'", value)
+	}
+	if ttl := restored.Ttl("z"); ttl <= 0 {
+		t.Errorf("Expected the ttl to be kept, got %d", ttl)
+	}
+}
+
+func TestAppendOnlyFile_WriteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, _ := openTestAOF(t, path)
+	if err := aof.Append([]string{"SET", "a", "1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// a read only file makes the writes fail
+	writable := aof.file
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	aof.mutex.Lock()
+	aof.file = readOnly
+	aof.mutex.Unlock()
+	if err := aof.Append([]string{"SET", "b", "2"}); err == nil || aof.WriteError() == nil {
+		t.Fatalf("Expected the write to fail")
+	}
+	aof.Cron(time.Now())
+	if aof.WriteError() == nil {
+		t.Errorf("Expected the error to stay until a write succeeds")
+	}
+
+	aof.mutex.Lock()
+	aof.file = writable
+	aof.mutex.Unlock()
+	_ = readOnly.Close()
+	aof.Cron(time.Now())
+	if err := aof.WriteError(); err != nil {
+		t.Errorf("Expected the commands to be written again, got %v", err)
+	}
+	restored := datastore.NewDataStore()
+	if count, err := NewAppendOnlyFile(restored, path, nil).Load(); err != nil || count != 2 {
+		t.Errorf("Expected 2 commands, got %d and %v", count, err)
+	}
+	if value, _ := restored.Get("b"); value != "2" {
+		t.Errorf("Expected 2, got '%s'", value)
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, name := range []string{"always", "everysec", "no"} {
+		policy, err := ParseFsyncPolicy(name)
+		if err != nil || policy.String() != name {
+			t.Errorf("Expected %s, got %v, %v", name, policy, err)
+		}
+	}
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+// The DUMP payload of a key is its type and its value encoded like in the snapshots,
+// followed by the version of the format (2 bytes) and the CRC-64 (ECMA) of every previous byte (8 bytes),
+// both little endian. The key and its ttl aren't part of it, RESTORE gets them as arguments
+const dumpVersion = 1
+
+var (
+	ErrBadPayload     = errors.New("DUMP payload version or checksum are wrong")
+	ErrBadPayloadData = errors.New("bad data format")
+)
+
+// DumpPayload serializes the value of the entry
+func DumpPayload(entry datastore.Entry) []byte {
+	var buf bytes.Buffer
+	enc := &encoder{w: &buf}
+	if entry.Type == datastore.ZSET {
+		enc.byte(typeZSet)
+	} else {
+		enc.byte(typeString)
+	}
+	enc.value(entry)
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(dumpVersion))
+	_ = binary.Write(&buf, binary.LittleEndian, crc64.Checksum(buf.Bytes(), crcTable))
+	return buf.Bytes()
+}
+
+// ParsePayload creates the entry of the key from a DUMP payload, the entry has no ttl
+func ParsePayload(key string, payload []byte) (datastore.Entry, error) {
+	const trailerSize = 10
+	if len(payload) < 1+trailerSize {
+		return datastore.Entry{}, ErrBadPayload
+	}
+	body, trailer := payload[:len(payload)-trailerSize], payload[len(payload)-trailerSize:]
+	version := binary.LittleEndian.Uint16(trailer)
+	sum := binary.LittleEndian.Uint64(trailer[2:])
+	if version != dumpVersion || sum != crc64.Checksum(payload[:len(payload)-8], crcTable) {
+		return datastore.Entry{}, ErrBadPayload
+	}
+
+	dec := &decoder{r: bufio.NewReader(bytes.NewReader(body[1:])), crc: crc64.New(crcTable), remaining: int64(len(body) - 1)}
+	entry := datastore.Entry{Key: key}
+	dec.value(body[0], &entry)
+	if dec.err != nil {
+		return datastore.Entry{}, ErrBadPayloadData
+	}
+	if dec.remaining != 0 || (entry.Type == datastore.ZSET && len(entry.Members) == 0) {
+		return datastore.Entry{}, ErrBadPayloadData
+	}
+	return entry, nil
+}
@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"hash/crc64"
+	"testing"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+func TestDumpPayload_RoundTrip(t *testing.T) {
+	for _, entry := range testEntries() {
+		restored, err := ParsePayload("copy", DumpPayload(entry))
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", entry.Key, err)
+		}
+		if restored.Key != "copy" || restored.Type != entry.Type || restored.Value != entry.Value || restored.ExpireAt != 0 {
+			t.Errorf("Expected a copy of %v without ttl, got %v", entry, restored)
+		}
+		if len(restored.Members) != len(entry.Members) {
+			t.Errorf("Expected members %v, got %v", entry.Members, restored.Members)
+		}
+	}
+}
+
+func TestParsePayload_Invalid(t *testing.T) {
+	payload := DumpPayload(datastore.Entry{Key: "k", Type: datastore.STR, Value: "value"})
+
+	flipped := append([]byte(nil), payload...)
+	flipped[2] ^= 0x01
+	if _, err := ParsePayload("k", flipped); err != ErrBadPayload {
+		t.Errorf("Expected ErrBadPayload for a flipped bit, got %v", err)
+	}
+	if _, err := ParsePayload("k", payload[:5]); err != ErrBadPayload {
+		t.Errorf("Expected ErrBadPayload for a truncated payload, got %v", err)
+	}
+
+	// a valid trailer around a value followed by garbage
+	body := append(append([]byte(nil), payload[:len(payload)-10]...), 'x')
+	if _, err := ParsePayload("k", checksum(body)); err != ErrBadPayloadData {
+		t.Errorf("Expected ErrBadPayloadData, got %v", err)
+	}
+}
+
+// checksum wraps a forged body in a valid trailer
+func checksum(body []byte) []byte {
+	body = binary.LittleEndian.AppendUint16(body, dumpVersion)
+	return binary.LittleEndian.AppendUint64(body, crc64.Checksum(body, crcTable))
+}
+
+func TestParsePayload_OversizedLength(t *testing.T) {
+	oversized := binary.AppendUvarint([]byte{typeString}, 1<<31-1)
+	if _, err := ParsePayload("k", checksum(oversized)); err != ErrBadPayloadData {
+		t.Errorf("Expected ErrBadPayloadData for an oversized string, got %v", err)
+	}
+	members := binary.AppendUvarint([]byte{typeZSet}, 1<<40)
+	if _, err := ParsePayload("k", checksum(members)); err != ErrBadPayloadData {
+		t.Errorf("Expected ErrBadPayloadData for an oversized member count, got %v", err)
+	}
+}
+
+func TestAbsoluteTTL(t *testing.T) {
+	if args := absoluteTTL([]string{"PEXPIRE", "k", "1000"}); args[0] != "PEXPIREAT" || len(args) != 3 {
+		t.Errorf("Expected PEXPIREAT, got %v", args)
+	}
+	args := absoluteTTL([]string{"RESTORE", "k", "1000", "payload", "REPLACE"})
+	if len(args) != 6 || args[3] != "payload" || args[4] != "REPLACE" || args[5] != "ABSTTL" || args[2] == "1000" {
+		t.Errorf("Expected an absolute RESTORE, got %v", args)
+	}
+	for _, unchanged := range [][]string{
+		{"RESTORE", "k", "0", "payload"}, {"RESTORE", "k", "1000", "payload", "absttl"}, {"SET", "k", "v"},
+	} {
+		if args := absoluteTTL(unchanged); len(args) != len(unchanged) || args[2] != unchanged[2] {
+			t.Errorf("Expected %v to be unchanged, got %v", unchanged, args)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package persistence
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SaveRule triggers a background save once Changes keys changed and Seconds elapsed since the last save
+type SaveRule struct {
+	Seconds int
+	Changes int
+}
+
+// ParseSaveRules parses "<seconds> <changes> [<seconds> <changes> ...]", an empty string disables the saves
+func ParseSaveRules(value string) ([]SaveRule, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("expected pairs of seconds and changes")
+	}
+	rules := make([]SaveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.Atoi(fields[i])
+		if err != nil || seconds <= 0 {
+			return nil, errors.New("the seconds must be a positive integer")
+		}
+		changes, err := strconv.Atoi(fields[i+1])
+		if err != nil || changes <= 0 {
+			return nil, errors.New("the changes must be a positive integer")
+		}
+		rules = append(rules, SaveRule{Seconds: seconds, Changes: changes})
+	}
+	return rules, nil
+}
+
+// FormatSaveRules is the inverse of ParseSaveRules
+func FormatSaveRules(rules []SaveRule) string {
+	fields := make([]string, 0, len(rules)*2)
+	for _, rule := range rules {
+		fields = append(fields, strconv.Itoa(rule.Seconds), strconv.Itoa(rule.Changes))
+	}
+	return strings.Join(fields, " ")
+}
+
+// due reports whether the rule asks for a save
+func (rule SaveRule) due(changes int64, sinceSave time.Duration) bool {
+	return changes >= int64(rule.Changes) && sinceSave >= time.Duration(rule.Seconds)*time.Second
+}
@@ -0,0 +1,300 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+// The snapshot format is the magic, the entries, the end marker and the CRC-64 (ECMA) of every previous byte.
+// An entry is its type, its expiry as a unix time in milliseconds (zero without ttl), its key
+// and its value: the bytes of a string or the number of members followed by each member name and score.
+// The lengths and counts are uvarints, the expiry and the scores are 8 bytes little endian
+const (
+	snapshotMagic = "GOLDIS01"
+
+	typeString byte = 0
+	typeZSet   byte = 1
+	opEOF      byte = 0xFF
+)
+
+var (
+	ErrBadMagic    = errors.New("not a goldis snapshot")
+	ErrBadChecksum = errors.New("snapshot checksum mismatch")
+
+	crcTable = crc64.MakeTable(crc64.ECMA)
+)
+
+// WriteSnapshot encodes the entries
+func WriteSnapshot(w io.Writer, entries []datastore.Entry) error {
+	crc := crc64.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	enc := &encoder{w: bw}
+	enc.bytes([]byte(snapshotMagic))
+	for _, entry := range entries {
+		enc.entry(entry)
+	}
+	enc.byte(opEOF)
+	if enc.err != nil {
+		return enc.err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, crc.Sum64())
+}
+
+// ReadSnapshot decodes the entries of a snapshot of size bytes, nothing is returned unless the whole snapshot is valid
+func ReadSnapshot(r io.Reader, size int64) ([]datastore.Entry, error) {
+	crc := crc64.New(crcTable)
+	dec := &decoder{r: bufio.NewReader(r), crc: crc, remaining: size}
+	magic := make([]byte, len(snapshotMagic))
+	dec.read(magic)
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if string(magic) != snapshotMagic {
+		return nil, ErrBadMagic
+	}
+	entries := make([]datastore.Entry, 0)
+	for {
+		op := dec.byte()
+		if dec.err != nil {
+			return nil, dec.err
+		}
+		if op == opEOF {
+			break
+		}
+		entry := dec.entry(op)
+		if dec.err != nil {
+			return nil, dec.err
+		}
+		entries = append(entries, entry)
+	}
+	sum := crc.Sum64()
+	var expected uint64
+	if err := binary.Read(dec.r, binary.LittleEndian, &expected); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if sum != expected {
+		return nil, ErrBadChecksum
+	}
+	return entries, nil
+}
+
+// SaveSnapshot writes the entries to the file, the file is replaced atomically
+func SaveSnapshot(path string, entries []datastore.Entry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp restricts the file to the owner
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := WriteSnapshot(tmp, entries); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads the entries of the file
+func LoadSnapshot(path string) ([]datastore.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ReadSnapshot(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("can't load the snapshot %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// encoder keeps the first error, the callers check it once at the end
+type encoder struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.bytes([]byte{b})
+}
+
+func (e *encoder) uvarint(n uint64) {
+	e.bytes(e.buf[:binary.PutUvarint(e.buf[:], n)])
+}
+
+func (e *encoder) uint64(n uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], n)
+	e.bytes(e.buf[:8])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) entry(entry datastore.Entry) {
+	if entry.Type == datastore.ZSET {
+		e.byte(typeZSet)
+	} else {
+		e.byte(typeString)
+	}
+	e.uint64(uint64(entry.ExpireAt))
+	e.string(entry.Key)
+	e.value(entry)
+}
+
+func (e *encoder) value(entry datastore.Entry) {
+	if entry.Type != datastore.ZSET {
+		e.string(entry.Value)
+		return
+	}
+	e.uvarint(uint64(len(entry.Members)))
+	for _, member := range entry.Members {
+		e.string(member.Name)
+		e.uint64(math.Float64bits(member.Score))
+	}
+}
+
+// decoder keeps the first error and feeds the checksum with the bytes read.
+// The lengths and counts are checked against the remaining bytes before anything is allocated
+type decoder struct {
+	r         *bufio.Reader
+	crc       hash.Hash64
+	remaining int64
+	err       error
+}
+
+func (d *decoder) read(b []byte) {
+	if d.err != nil {
+		return
+	}
+	if int64(len(b)) > d.remaining {
+		d.err = io.ErrUnexpectedEOF
+		return
+	}
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = unexpectedEOF(err)
+		return
+	}
+	d.remaining -= int64(len(b))
+	_, _ = d.crc.Write(b)
+}
+
+// fits checks that n items of at least itemSize bytes each can still be read
+func (d *decoder) fits(n uint64, itemSize int64, what string) bool {
+	if d.err == nil && n > uint64(d.remaining/itemSize) {
+		d.err = fmt.Errorf("%s %d exceeds the remaining %d bytes", what, n, d.remaining)
+	}
+	return d.err == nil
+}
+
+func (d *decoder) byte() byte {
+	b := make([]byte, 1)
+	d.read(b)
+	return b[0]
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(byteReader{d})
+	if err != nil && d.err == nil {
+		d.err = unexpectedEOF(err)
+	}
+	return n
+}
+
+func (d *decoder) uint64() uint64 {
+	b := make([]byte, 8)
+	d.read(b)
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if !d.fits(n, 1, "string length") {
+		return ""
+	}
+	b := make([]byte, n)
+	d.read(b)
+	return string(b)
+}
+
+func (d *decoder) entry(op byte) datastore.Entry {
+	entry := datastore.Entry{ExpireAt: int64(d.uint64()), Key: d.string()}
+	d.value(op, &entry)
+	return entry
+}
+
+func (d *decoder) value(op byte, entry *datastore.Entry) {
+	switch op {
+	case typeString:
+		entry.Type = datastore.STR
+		entry.Value = d.string()
+	case typeZSet:
+		entry.Type = datastore.ZSET
+		// a member is at least a length byte and a score
+		n := d.uvarint()
+		if !d.fits(n, 1+8, "member count") {
+			return
+		}
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			name := d.string()
+			entry.Members = append(entry.Members, datastore.ZMember{Name: name, Score: math.Float64frombits(d.uint64())})
+		}
+	default:
+		d.err = fmt.Errorf("unknown entry type %d", op)
+	}
+}
+
+// byteReader reads the uvarints through the decoder so that the checksum sees their bytes
+type byteReader struct {
+	d *decoder
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	b := br.d.byte()
+	return b, br.d.err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+func testEntries() []datastore.Entry {
+	return []datastore.Entry{
+		{Key: "name", Type: datastore.STR, Value: "goldis"},
+		{Key: "", Type: datastore.STR, Value: ""},
+		{Key: "session", Type: datastore.STR, Value: "token", ExpireAt: 1893456000000},
+		{Key: "board", Type: datastore.ZSET, Members: []datastore.ZMember{
+			{Name: "low", Score: math.Inf(-1)}, {Name: "alice", Score: 1.5}, {Name: "bob", Score: 42},
+		}},
+	}
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, testEntries()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	entries, err := ReadSnapshot(&buf, int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := testEntries()
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		want := expected[i]
+		if entry.Key != want.Key || entry.Type != want.Type || entry.Value != want.Value || entry.ExpireAt != want.ExpireAt {
+			t.Errorf("Expected %v, got %v", want, entry)
+		}
+		if len(entry.Members) != len(want.Members) {
+			t.Fatalf("Expected members %v, got %v", want.Members, entry.Members)
+		}
+		for j, member := range entry.Members {
+			if member != want.Members[j] {
+				t.Errorf("Expected member %v, got %v", want.Members[j], member)
+			}
+		}
+	}
+}
+
+func TestSnapshot_Corrupted(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, testEntries()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data := buf.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(snapshotMagic)+12] ^= 0x01
+	if _, err := ReadSnapshot(bytes.NewReader(flipped), int64(len(flipped))); err == nil {
+		t.Errorf("Expected an error for a flipped bit")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader(data[:len(data)-3]), int64(len(data)-3)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected an unexpected EOF for a truncated snapshot, got %v", err)
+	}
+	if _, err := ReadSnapshot(bytes.NewReader([]byte("NOTGOLDIS")), 9); err != ErrBadMagic {
+		t.Errorf("Expected ErrBadMagic, got %v", err)
+	}
+}
+
+func TestSnapshot_OversizedLength(t *testing.T) {
+	data := append([]byte(snapshotMagic), typeString)
+	data = append(data, make([]byte, 8)...)
+	data = binary.AppendUvarint(data, 1<<31-1)
+	if _, err := ReadSnapshot(bytes.NewReader(data), int64(len(data))); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Expected an oversized length error, got %v", err)
+	}
+}
+
+func TestSnapshotter_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.gdb")
+	dataStore := datastore.NewDataStore()
+	dataStore.Set("k", "v")
+	dataStore.Set("gone", "soon")
+	dataStore.Expire("gone", 60000)
+	_, _ = dataStore.ZAdd("z", 2, "b")
+	_, _ = dataStore.ZAdd("z", 1, "a")
+
+	snapshotter := NewSnapshotter(dataStore, path, nil)
+	if snapshotter.Changes() == 0 {
+		t.Errorf("Expected pending changes before the save")
+	}
+	if err := snapshotter.Save(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if snapshotter.Changes() != 0 {
+		t.Errorf("Expected no pending change after the save, got %d", snapshotter.Changes())
+	}
+
+	restored := datastore.NewDataStore()
+	keys, err := NewSnapshotter(restored, path, nil).Load()
+	if err != nil || keys != 3 {
+		t.Fatalf("Expected 3 keys loaded, got %d, %v", keys, err)
+	}
+	if value, _ := restored.Get("k"); value != "v" {
+		t.Errorf("Expected v, got '%s'", value)
+	}
+	if ttl := restored.Ttl("gone"); ttl <= 0 || ttl > 60000 {
+		t.Errorf("Expected the ttl to be kept, got %d", ttl)
+	}
+	if score, ok := restored.ZScore("z", "a"); !ok || score != 1 {
+		t.Errorf("Expected score 1, got %v, %v", score, ok)
+	}
+}
+
+func TestSnapshotter_LoadMissingFile(t *testing.T) {
+	snapshotter := NewSnapshotter(datastore.NewDataStore(), filepath.Join(t.TempDir(), "dump.gdb"), nil)
+	if keys, err := snapshotter.Load(); err != nil || keys != 0 {
+		t.Errorf("Expected an empty keyspace, got %d, %v", keys, err)
+	}
+}
+
+func TestSnapshotter_Cron(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.gdb")
+	dataStore := datastore.NewDataStore()
+	tasks := make(chan func(), 1)
+	snapshotter := NewSnapshotter(dataStore, path, func(task func()) bool {
+		tasks <- task
+		return true
+	})
+	snapshotter.SetRules([]SaveRule{{Seconds: 10, Changes: 2}})
+
+	dataStore.Set("a", "1")
+	snapshotter.Cron(time.Now().Add(time.Minute))
+	if snapshotter.InProgress() {
+		t.Fatalf("Expected no save with fewer changes than the rule")
+	}
+	dataStore.Set("b", "2")
+	snapshotter.Cron(time.Now())
+	if snapshotter.InProgress() {
+		t.Fatalf("Expected no save before the rule's seconds elapse")
+	}
+	snapshotter.Cron(time.Now().Add(time.Minute))
+	if !snapshotter.InProgress() {
+		t.Fatalf("Expected a background save")
+	}
+	if err := snapshotter.BackgroundSave(); err != ErrSaveInProgress {
+		t.Errorf("Expected ErrSaveInProgress, got %v", err)
+	}
+	(<-tasks)()
+	if snapshotter.InProgress() || snapshotter.Changes() != 0 {
+		t.Errorf("Expected the save to be done, got %d pending changes", snapshotter.Changes())
+	}
+}
+
+func TestParseSaveRules(t *testing.T) {
+	rules, err := ParseSaveRules("3600 1  300 100")
+	if err != nil || len(rules) != 2 || rules[1] != (SaveRule{Seconds: 300, Changes: 100}) {
+		t.Errorf("Expected 2 rules, got %v, %v", rules, err)
+	}
+	if FormatSaveRules(rules) != "3600 1 300 100" {
+		t.Errorf("Expected '3600 1 300 100', got '%s'", FormatSaveRules(rules))
+	}
+	if rules, err := ParseSaveRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("Expected no rule, got %v, %v", rules, err)
+	}
+	for _, value := range []string{"3600", "0 1", "60 -1", "a b"} {
+		if _, err := ParseSaveRules(value); err == nil {
+			t.Errorf("Expected an error for '%s'", value)
+		}
+	}
+}
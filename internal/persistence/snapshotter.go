@@ -0,0 +1,153 @@
+package persistence
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// retryDelay is how long the save rules wait after a failed background save
+const retryDelay = 5 * time.Second
+
+var ErrSaveInProgress = errors.New("background save already in progress")
+
+// Snapshotter saves the keyspace to a snapshot file and loads it back, it's used by the event loop only
+type Snapshotter struct {
+	dataStore *datastore.DataStore
+	path      string
+	// submit runs the end of a background save on the event loop
+	submit func(task func()) bool
+	rules  []SaveRule
+	// dirtyAtSave is the dirty counter of the keyspace when the last saved snapshot was taken
+	dirtyAtSave int64
+	lastSave    time.Time
+	lastFailure time.Time
+	// saving is closed when the background save ends, nil when there's none
+	saving chan struct{}
+}
+
+func NewSnapshotter(dataStore *datastore.DataStore, path string, submit func(task func()) bool) *Snapshotter {
+	return &Snapshotter{dataStore: dataStore, path: path, submit: submit, lastSave: time.Now()}
+}
+
+// SetRules replaces the rules of the automatic saves
+func (s *Snapshotter) SetRules(rules []SaveRule) {
+	s.rules = rules
+}
+
+// HasRules reports whether the automatic saves are enabled
+func (s *Snapshotter) HasRules() bool {
+	return len(s.rules) > 0
+}
+
+func (s *Snapshotter) Path() string {
+	return s.path
+}
+
+// Load restores the keys of the snapshot file, it returns the number of keys loaded.
+// A missing file isn't an error, the server starts empty
+func (s *Snapshotter) Load() (int, error) {
+	entries, err := LoadSnapshot(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		s.dataStore.Restore(entry)
+	}
+	s.ResetChanges()
+	return len(entries), nil
+}
+
+// ResetChanges forgets the changes since the last save, like the ones replayed from the append only file
+func (s *Snapshotter) ResetChanges() {
+	s.dirtyAtSave = s.dataStore.Dirty()
+}
+
+// Save writes the snapshot on the event loop, the clients wait until it's done
+func (s *Snapshotter) Save() error {
+	if s.saving != nil {
+		return ErrSaveInProgress
+	}
+	dirty := s.dataStore.Dirty()
+	err := SaveSnapshot(s.path, s.dataStore.Entries())
+	s.saved(err, dirty)
+	return err
+}
+
+// BackgroundSave copies the keyspace and writes it in another goroutine,
+// the clients wait for the copy, which is logged with its duration
+func (s *Snapshotter) BackgroundSave() error {
+	if s.saving != nil {
+		return ErrSaveInProgress
+	}
+	entries, dirty := s.dataStore.Entries(), s.dataStore.Dirty()
+	saving := make(chan struct{})
+	s.saving = saving
+	utils.Noticef("Background saving started, copying the %d keys took %v", len(entries), s.dataStore.Stats().LatestCopy)
+	go func() {
+		defer close(saving)
+		err := SaveSnapshot(s.path, entries)
+		s.submit(func() {
+			s.saving = nil
+			s.saved(err, dirty)
+		})
+	}()
+	return nil
+}
+
+// InProgress reports whether a background save is running
+func (s *Snapshotter) InProgress() bool {
+	return s.saving != nil
+}
+
+// Wait blocks until the background save ends
+func (s *Snapshotter) Wait() {
+	if s.saving != nil {
+		<-s.saving
+		s.saving = nil
+	}
+}
+
+// LastSave is the time of the last successful save, or of the start when nothing was saved
+func (s *Snapshotter) LastSave() time.Time {
+	return s.lastSave
+}
+
+// Changes returns the number of changes since the last save
+func (s *Snapshotter) Changes() int64 {
+	return s.dataStore.Dirty() - s.dirtyAtSave
+}
+
+// Cron starts a background save when a rule is due, it's called about every second
+func (s *Snapshotter) Cron(now time.Time) {
+	if s.saving != nil || now.Sub(s.lastFailure) < retryDelay {
+		return
+	}
+	changes, sinceSave := s.Changes(), now.Sub(s.lastSave)
+	for _, rule := range s.rules {
+		if rule.due(changes, sinceSave) {
+			utils.Noticef("%d changes in %d seconds. Saving...", rule.Changes, rule.Seconds)
+			_ = s.BackgroundSave()
+			return
+		}
+	}
+}
+
+// saved records the end of a save, dirty is the dirty counter when the snapshot was taken
+func (s *Snapshotter) saved(err error, dirty int64) {
+	if err != nil {
+		s.lastFailure = time.Now()
+		utils.Warningf("Saving the snapshot to %s failed: %v", s.path, err)
+		return
+	}
+	s.dirtyAtSave = dirty
+	s.lastSave = time.Now()
+	s.lastFailure = time.Time{}
+	utils.Noticef("DB saved on disk")
+}
@@ -0,0 +1,201 @@
+package pubsub
+
+import (
+	"sort"
+
+	"github.com/miladbarzideh/goldis/internal/resp"
+	"github.com/miladbarzideh/goldis/utils"
+)
+
+// Subscriber receives the messages of the channels and patterns it subscribed to
+type Subscriber interface {
+	// Push queues a message, it's sent when the event loop flushes the subscriber
+	Push(message resp.Value)
+	// SetSubscriptions tells the subscriber how many channels and patterns it's subscribed to
+	SetSubscriptions(channels int, patterns int)
+}
+
+// Hub routes the published messages to the subscribers, it's used by the event loop only
+type Hub struct {
+	channels subscribers
+	patterns subscribers
+	// the channels and patterns of each subscriber
+	subscriptions map[Subscriber]*subscriptions
+	notifyFlags   NotifyFlags
+}
+
+// subscribers are the subscribers of each channel or pattern
+type subscribers map[string]map[Subscriber]bool
+
+type subscriptions struct {
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		channels:      make(subscribers),
+		patterns:      make(subscribers),
+		subscriptions: make(map[Subscriber]*subscriptions),
+	}
+}
+
+// Subscribe adds the subscriber to the channel and returns its number of subscriptions
+func (h *Hub) Subscribe(sub Subscriber, channel string) int {
+	h.channels.add(channel, sub)
+	h.of(sub).channels[channel] = true
+	return h.updateCount(sub)
+}
+
+// Unsubscribe removes the subscriber from the channel and returns its number of subscriptions
+func (h *Hub) Unsubscribe(sub Subscriber, channel string) int {
+	h.channels.remove(channel, sub)
+	delete(h.of(sub).channels, channel)
+	return h.updateCount(sub)
+}
+
+// PSubscribe adds the subscriber to the channels matching the glob pattern
+func (h *Hub) PSubscribe(sub Subscriber, pattern string) int {
+	h.patterns.add(pattern, sub)
+	h.of(sub).patterns[pattern] = true
+	return h.updateCount(sub)
+}
+
+func (h *Hub) PUnsubscribe(sub Subscriber, pattern string) int {
+	h.patterns.remove(pattern, sub)
+	delete(h.of(sub).patterns, pattern)
+	return h.updateCount(sub)
+}
+
+// Channels returns the sorted channels the subscriber is subscribed to
+func (h *Hub) Channels(sub Subscriber) []string {
+	if s, ok := h.subscriptions[sub]; ok {
+		return sortedKeys(s.channels)
+	}
+	return nil
+}
+
+// Patterns returns the sorted patterns the subscriber is subscribed to
+func (h *Hub) Patterns(sub Subscriber) []string {
+	if s, ok := h.subscriptions[sub]; ok {
+		return sortedKeys(s.patterns)
+	}
+	return nil
+}
+
+// Count returns the number of channels and patterns the subscriber is subscribed to
+func (h *Hub) Count(sub Subscriber) int {
+	if s, ok := h.subscriptions[sub]; ok {
+		return len(s.channels) + len(s.patterns)
+	}
+	return 0
+}
+
+// UnsubscribeAll removes every subscription of a subscriber, like a disconnected client
+func (h *Hub) UnsubscribeAll(sub Subscriber) {
+	s, ok := h.subscriptions[sub]
+	if !ok {
+		return
+	}
+	for channel := range s.channels {
+		h.channels.remove(channel, sub)
+	}
+	for pattern := range s.patterns {
+		h.patterns.remove(pattern, sub)
+	}
+	delete(h.subscriptions, sub)
+	sub.SetSubscriptions(0, 0)
+}
+
+// Publish pushes the message to the subscribers of the channel and of the matching patterns,
+// it returns the number of receivers
+func (h *Hub) Publish(channel string, message string) int {
+	receivers := 0
+	for sub := range h.channels[channel] {
+		sub.Push(resp.NewPush(resp.NewBulkString("message"), resp.NewBulkString(channel), resp.NewBulkString(message)))
+		receivers++
+	}
+	for pattern, subs := range h.patterns {
+		if !utils.GlobMatch(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			sub.Push(resp.NewPush(resp.NewBulkString("pmessage"), resp.NewBulkString(pattern),
+				resp.NewBulkString(channel), resp.NewBulkString(message)))
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// ActiveChannels returns the sorted channels having subscribers and matching the pattern, empty matches all
+func (h *Hub) ActiveChannels(pattern string) []string {
+	channels := make([]string, 0)
+	for channel := range h.channels {
+		if pattern == "" || utils.GlobMatch(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub returns the number of subscribers of a channel, the pattern subscribers aren't counted
+func (h *Hub) NumSub(channel string) int {
+	return len(h.channels[channel])
+}
+
+// NumPat returns the number of patterns having subscribers
+func (h *Hub) NumPat() int {
+	return len(h.patterns)
+}
+
+// of returns the subscriptions of a subscriber, they are created on the first subscription
+func (h *Hub) of(sub Subscriber) *subscriptions {
+	s, ok := h.subscriptions[sub]
+	if !ok {
+		s = &subscriptions{channels: make(map[string]bool), patterns: make(map[string]bool)}
+		h.subscriptions[sub] = s
+	}
+	return s
+}
+
+// updateCount tells the subscriber its number of subscriptions and forgets it when there's none left
+func (h *Hub) updateCount(sub Subscriber) int {
+	s := h.subscriptions[sub]
+	channels, patterns := len(s.channels), len(s.patterns)
+	if channels+patterns == 0 {
+		delete(h.subscriptions, sub)
+	}
+	sub.SetSubscriptions(channels, patterns)
+	return channels + patterns
+}
+
+func (s subscribers) add(name string, sub Subscriber) {
+	subs, ok := s[name]
+	if !ok {
+		subs = make(map[Subscriber]bool)
+		s[name] = subs
+	}
+	subs[sub] = true
+}
+
+func (s subscribers) remove(name string, sub Subscriber) {
+	subs, ok := s[name]
+	if !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(s, name)
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miladbarzideh/goldis/internal/resp"
+)
+
+type fakeSubscriber struct {
+	messages []resp.Value
+	count    int
+}
+
+func (f *fakeSubscriber) Push(message resp.Value) {
+	f.messages = append(f.messages, message)
+}
+
+func (f *fakeSubscriber) SetSubscriptions(channels int, patterns int) {
+	f.count = channels + patterns
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub()
+	news, all := &fakeSubscriber{}, &fakeSubscriber{}
+	hub.Subscribe(news, "news")
+	hub.Subscribe(news, "sport")
+	hub.PSubscribe(all, "*")
+
+	if receivers := hub.Publish("news", "hello"); receivers != 2 {
+		t.Errorf("Expected 2 receivers, got %d", receivers)
+	}
+	expected := resp.NewPush(resp.NewBulkString("message"), resp.NewBulkString("news"), resp.NewBulkString("hello"))
+	if len(news.messages) != 1 || !reflect.DeepEqual(news.messages[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, news.messages)
+	}
+	expected = resp.NewPush(resp.NewBulkString("pmessage"), resp.NewBulkString("*"),
+		resp.NewBulkString("news"), resp.NewBulkString("hello"))
+	if len(all.messages) != 1 || !reflect.DeepEqual(all.messages[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, all.messages)
+	}
+	if receivers := hub.Publish("weather", "sunny"); receivers != 1 {
+		t.Errorf("Expected 1 receiver, got %d", receivers)
+	}
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	hub := NewHub()
+	sub := &fakeSubscriber{}
+	hub.Subscribe(sub, "a")
+	hub.Subscribe(sub, "b")
+	hub.PSubscribe(sub, "c*")
+	if sub.count != 3 || hub.Count(sub) != 3 {
+		t.Errorf("Expected 3 subscriptions, got %d", sub.count)
+	}
+	if !reflect.DeepEqual(hub.ActiveChannels(""), []string{"a", "b"}) {
+		t.Errorf("Expected [a b], got %v", hub.ActiveChannels(""))
+	}
+
+	if count := hub.Unsubscribe(sub, "a"); count != 2 {
+		t.Errorf("Expected 2 subscriptions left, got %d", count)
+	}
+	if hub.NumSub("a") != 0 || hub.NumSub("b") != 1 || hub.NumPat() != 1 {
+		t.Errorf("Expected only b and c* to have subscribers")
+	}
+
+	hub.UnsubscribeAll(sub)
+	if sub.count != 0 || hub.Count(sub) != 0 || hub.NumPat() != 0 || len(hub.ActiveChannels("")) != 0 {
+		t.Errorf("Expected no subscription left")
+	}
+	if receivers := hub.Publish("b", "x"); receivers != 0 {
+		t.Errorf("Expected no receiver, got %d", receivers)
+	}
+}
@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"errors"
+	"strings"
+)
+
+// NotifyFlags selects the keyspace notifications, it's the notify-keyspace-events config
+type NotifyFlags int
+
+const (
+	// NotifyKeyspace publishes the event names on __keyspace__:<key>
+	NotifyKeyspace NotifyFlags = 1 << iota
+	// NotifyKeyevent publishes the key names on __keyevent__:<event>
+	NotifyKeyevent
+	// NotifyGeneric is the class of the del, expire, persist and restore events
+	NotifyGeneric
+	// NotifyString is the class of the set event
+	NotifyString
+	// NotifySortedSet is the class of the zadd and zrem events
+	NotifySortedSet
+	// NotifyExpired is the class of the expired event, sent when a key is removed by its ttl
+	NotifyExpired
+
+	notifyAll = NotifyGeneric | NotifyString | NotifySortedSet | NotifyExpired
+)
+
+const (
+	keyspacePrefix = "__keyspace__:"
+	keyeventPrefix = "__keyevent__:"
+)
+
+// eventClasses maps the events sent by the data store to their class
+var eventClasses = map[string]NotifyFlags{
+	"del":     NotifyGeneric,
+	"expire":  NotifyGeneric,
+	"persist": NotifyGeneric,
+	"restore": NotifyGeneric,
+	"set":     NotifyString,
+	"zadd":    NotifySortedSet,
+	"zrem":    NotifySortedSet,
+	"expired": NotifyExpired,
+}
+
+var flagChars = []struct {
+	char byte
+	flag NotifyFlags
+}{
+	{'g', NotifyGeneric}, {'$', NotifyString}, {'z', NotifySortedSet}, {'x', NotifyExpired},
+	{'K', NotifyKeyspace}, {'E', NotifyKeyevent},
+}
+
+// ParseNotifyFlags parses flags like "KEA": K and E select the channels,
+// g, $, z and x the event classes and A is an alias of "g$zx"
+func ParseNotifyFlags(value string) (NotifyFlags, error) {
+	var flags NotifyFlags
+	for i := 0; i < len(value); i++ {
+		if value[i] == 'A' {
+			flags |= notifyAll
+			continue
+		}
+		found := false
+		for _, fc := range flagChars {
+			if fc.char == value[i] {
+				flags |= fc.flag
+				found = true
+			}
+		}
+		if !found {
+			return 0, errors.New("unknown flag '" + value[i:i+1] + "', expected a combination of K, E, g, $, z, x and A")
+		}
+	}
+	return flags, nil
+}
+
+func (f NotifyFlags) String() string {
+	var sb strings.Builder
+	if f&notifyAll == notifyAll {
+		sb.WriteByte('A')
+	}
+	for _, fc := range flagChars {
+		if f&fc.flag != 0 && (f&notifyAll != notifyAll || fc.flag&notifyAll == 0) {
+			sb.WriteByte(fc.char)
+		}
+	}
+	return sb.String()
+}
+
+// SetNotifyFlags selects the keyspace notifications published by NotifyKeyspaceEvent
+func (h *Hub) SetNotifyFlags(flags NotifyFlags) {
+	h.notifyFlags = flags
+}
+
+// NotifyKeyspaceEvent publishes a change of the key when its class is enabled,
+// the event name goes to __keyspace__:<key> and the key name to __keyevent__:<event>
+func (h *Hub) NotifyKeyspaceEvent(event string, key string) {
+	class, ok := eventClasses[event]
+	if !ok || h.notifyFlags&class == 0 {
+		return
+	}
+	if h.notifyFlags&NotifyKeyspace != 0 {
+		h.Publish(keyspacePrefix+key, event)
+	}
+	if h.notifyFlags&NotifyKeyevent != 0 {
+		h.Publish(keyeventPrefix+event, key)
+	}
+}
@@ -0,0 +1,49 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestParseNotifyFlags(t *testing.T) {
+	tests := map[string]string{
+		"":      "",
+		"KEA":   "AKE",
+		"E$z":   "$zE",
+		"Kxg$z": "AK",
+	}
+	for value, expected := range tests {
+		flags, err := ParseNotifyFlags(value)
+		if err != nil {
+			t.Errorf("Expected no error for '%s', got %v", value, err)
+		}
+		if flags.String() != expected {
+			t.Errorf("Expected '%s' for '%s', got '%s'", expected, value, flags.String())
+		}
+	}
+	if _, err := ParseNotifyFlags("Kq"); err == nil {
+		t.Errorf("Expected an error for an unknown flag")
+	}
+}
+
+func TestHub_NotifyKeyspaceEvent(t *testing.T) {
+	hub := NewHub()
+	keyspace, keyevent := &fakeSubscriber{}, &fakeSubscriber{}
+	hub.Subscribe(keyspace, "__keyspace__:k")
+	hub.PSubscribe(keyevent, "__keyevent__:*")
+
+	hub.NotifyKeyspaceEvent("set", "k")
+	if len(keyspace.messages)+len(keyevent.messages) != 0 {
+		t.Errorf("Expected no notification while disabled")
+	}
+
+	hub.SetNotifyFlags(NotifyKeyspace | NotifyKeyevent | NotifyString)
+	hub.NotifyKeyspaceEvent("set", "k")
+	hub.NotifyKeyspaceEvent("del", "k")
+	if len(keyspace.messages) != 1 || keyspace.messages[0].Elems[2].Str != "set" {
+		t.Errorf("Expected the set event on the keyspace channel, got %v", keyspace.messages)
+	}
+	if len(keyevent.messages) != 1 || keyevent.messages[0].Elems[2].Str != "__keyevent__:set" ||
+		keyevent.messages[0].Elems[3].Str != "k" {
+		t.Errorf("Expected the key on the keyevent channel, got %v", keyevent.messages)
+	}
+}
@@ -0,0 +1,14 @@
+package rdb
+
+import "hash/crc64"
+
+// The RDB checksum is the CRC-64 with the Jones polynomial, reflected, without the initial
+// and final inversions of hash/crc64, only its table is reused
+var jonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func crcJones(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = jonesTable[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
@@ -0,0 +1,207 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var (
+	errBadZiplist  = errors.New("corrupted ziplist")
+	errBadListpack = errors.New("corrupted listpack")
+)
+
+// ziplistEntries decodes the entries of a ziplist, the compact encoding of the small containers before redis 7
+func ziplistEntries(zl []byte) ([]string, error) {
+	// zlbytes, zltail, zllen
+	const headerSize = 10
+	if len(zl) < headerSize+1 || int(binary.LittleEndian.Uint32(zl)) != len(zl) {
+		return nil, errBadZiplist
+	}
+	entries := make([]string, 0, binary.LittleEndian.Uint16(zl[8:]))
+	pos := headerSize
+	for {
+		if pos >= len(zl) {
+			return nil, errBadZiplist
+		}
+		if zl[pos] == 0xff {
+			return entries, nil
+		}
+		// the length of the previous entry, used to walk backwards
+		if zl[pos] < 0xfe {
+			pos++
+		} else {
+			pos += 5
+		}
+		if pos >= len(zl) {
+			return nil, errBadZiplist
+		}
+		entry, n, err := ziplistEntry(zl[pos:])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		pos += n
+	}
+}
+
+// ziplistEntry decodes the encoding and the content of an entry, it returns their size
+func ziplistEntry(b []byte) (string, int, error) {
+	enc := b[0]
+	strLen, header := 0, 0
+	switch enc >> 6 {
+	case 0:
+		strLen, header = int(enc&0x3f), 1
+	case 1:
+		if len(b) < 2 {
+			return "", 0, errBadZiplist
+		}
+		strLen, header = int(enc&0x3f)<<8|int(b[1]), 2
+	case 2:
+		if len(b) < 5 {
+			return "", 0, errBadZiplist
+		}
+		strLen, header = int(binary.BigEndian.Uint32(b[1:])), 5
+	default:
+		return ziplistInt(b)
+	}
+	if strLen < 0 || header+strLen > len(b) {
+		return "", 0, errBadZiplist
+	}
+	return string(b[header : header+strLen]), header + strLen, nil
+}
+
+func ziplistInt(b []byte) (string, int, error) {
+	enc := b[0]
+	size := 0
+	switch enc {
+	case 0xc0:
+		size = 2
+	case 0xd0:
+		size = 4
+	case 0xe0:
+		size = 8
+	case 0xf0:
+		size = 3
+	case 0xfe:
+		size = 1
+	default:
+		// 1111xxxx holds the values 0 to 12 as xxxx-1
+		if enc >= 0xf1 && enc <= 0xfd {
+			return strconv.Itoa(int(enc&0x0f) - 1), 1, nil
+		}
+		return "", 0, errBadZiplist
+	}
+	if 1+size > len(b) {
+		return "", 0, errBadZiplist
+	}
+	return strconv.FormatInt(littleEndianInt(b[1:1+size]), 10), 1 + size, nil
+}
+
+// listpackEntries decodes the entries of a listpack, the compact encoding of the small containers since redis 7
+func listpackEntries(lp []byte) ([]string, error) {
+	// total bytes, number of elements
+	const headerSize = 6
+	if len(lp) < headerSize+1 || int(binary.LittleEndian.Uint32(lp)) != len(lp) {
+		return nil, errBadListpack
+	}
+	entries := make([]string, 0, binary.LittleEndian.Uint16(lp[4:]))
+	pos := headerSize
+	for {
+		if pos >= len(lp) {
+			return nil, errBadListpack
+		}
+		if lp[pos] == 0xff {
+			return entries, nil
+		}
+		entry, n, err := listpackEntry(lp[pos:])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		// the entry is followed by its size, used to walk backwards
+		pos += n + backlenSize(n)
+	}
+}
+
+// listpackEntry decodes an entry, it returns the size of its encoding and content
+func listpackEntry(b []byte) (string, int, error) {
+	enc := b[0]
+	intOf := func(size int, bits uint) (string, int, error) {
+		if 1+size > len(b) {
+			return "", 0, errBadListpack
+		}
+		return strconv.FormatInt(signExtend(littleEndianUint(b[1:1+size]), bits), 10), 1 + size, nil
+	}
+	str := func(header int, strLen int) (string, int, error) {
+		if header+strLen > len(b) {
+			return "", 0, errBadListpack
+		}
+		return string(b[header : header+strLen]), header + strLen, nil
+	}
+	switch {
+	case enc&0x80 == 0:
+		return strconv.Itoa(int(enc)), 1, nil
+	case enc&0xc0 == 0x80:
+		return str(1, int(enc&0x3f))
+	case enc&0xe0 == 0xc0:
+		if len(b) < 2 {
+			return "", 0, errBadListpack
+		}
+		return strconv.FormatInt(signExtend(uint64(enc&0x1f)<<8|uint64(b[1]), 13), 10), 2, nil
+	case enc&0xf0 == 0xe0:
+		if len(b) < 2 {
+			return "", 0, errBadListpack
+		}
+		return str(2, int(enc&0x0f)<<8|int(b[1]))
+	}
+	switch enc {
+	case 0xf0:
+		if len(b) < 5 {
+			return "", 0, errBadListpack
+		}
+		return str(5, int(binary.LittleEndian.Uint32(b[1:])))
+	case 0xf1:
+		return intOf(2, 16)
+	case 0xf2:
+		return intOf(3, 24)
+	case 0xf3:
+		return intOf(4, 32)
+	case 0xf4:
+		return intOf(8, 64)
+	}
+	return "", 0, errBadListpack
+}
+
+// backlenSize is the number of bytes storing the size of a listpack entry, 7 bits per byte
+func backlenSize(n int) int {
+	switch {
+	case n < 1<<7:
+		return 1
+	case n < 1<<14:
+		return 2
+	case n < 1<<21:
+		return 3
+	case n < 1<<28:
+		return 4
+	}
+	return 5
+}
+
+func littleEndianUint(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func littleEndianInt(b []byte) int64 {
+	return signExtend(littleEndianUint(b), uint(len(b)*8))
+}
+
+// signExtend reads the lowest bits of v as a two's complement integer
+func signExtend(v uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64(v<<shift) >> shift
+}
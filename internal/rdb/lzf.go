@@ -0,0 +1,50 @@
+package rdb
+
+import "errors"
+
+var errBadLZF = errors.New("corrupted lzf compressed string")
+
+// lzfDecompress expands the LZF compressed strings of the RDB files into a buffer of the known size
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// a run of ctrl+1 literal bytes
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > size {
+				return nil, errBadLZF
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// a back reference copying length+2 bytes from offset+1 bytes before
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errBadLZF
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errBadLZF
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		length += 2
+		if ref < 0 || len(out)+length > size {
+			return nil, errBadLZF
+		}
+		// the copy can overlap the bytes it produces
+		for j := 0; j < length; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, errBadLZF
+	}
+	return out, nil
+}
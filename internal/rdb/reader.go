@@ -0,0 +1,473 @@
+// Package rdb imports the RDB files written by redis, the strings and the sorted sets
+// are loaded and the other types are skipped, except the streams and the module values that stop the import
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+const (
+	maxVersion   = 12
+	maxStringLen = 512 * 1024 * 1024
+	// AllDBs imports the keys of every database
+	AllDBs = -1
+)
+
+// value types
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeModule         = 6
+	typeModule2        = 7
+	typeHashZipmap     = 9
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeStream         = 15
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeStream2        = 19
+	typeSetListpack    = 20
+	typeStream3        = 21
+)
+
+// opcodes
+const (
+	opSlotInfo     = 0xf4
+	opFunction2    = 0xf5
+	opModuleAux    = 0xf7
+	opIdle         = 0xf8
+	opFreq         = 0xf9
+	opAux          = 0xfa
+	opResizeDB     = 0xfb
+	opExpireTimeMs = 0xfc
+	opExpireTime   = 0xfd
+	opSelectDB     = 0xfe
+	opEOF          = 0xff
+)
+
+// special encodings of the strings, flagged by the 11 prefix of their length
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+var ErrBadChecksum = errors.New("RDB checksum mismatch")
+
+// Stats counts what an import did with the keys of the file
+type Stats struct {
+	Keys int
+	// Expired keys are dropped, like the keys of the other databases
+	Expired  int
+	OtherDBs int
+	// Skipped counts the keys of the types goldis doesn't have by type name
+	Skipped map[string]int
+}
+
+// Load imports the keys of the file, see Read
+func Load(path string, db int, restore func(entry datastore.Entry)) (Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer f.Close()
+	stats, err := Read(f, db, restore)
+	if err != nil {
+		return stats, fmt.Errorf("can't import the RDB file %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+// Read decodes an RDB file and hands its strings and sorted sets to restore, they are in the database db
+// or any database with AllDBs. The keys are restored as they are read, an error can stop the import halfway
+func Read(r io.Reader, db int, restore func(entry datastore.Entry)) (Stats, error) {
+	rd := &reader{r: bufio.NewReader(r)}
+	stats := Stats{Skipped: make(map[string]int)}
+	header := make([]byte, 9)
+	if err := rd.read(header); err != nil {
+		return stats, err
+	}
+	if string(header[:5]) != "REDIS" {
+		return stats, errors.New("not an RDB file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 || version > maxVersion {
+		return stats, fmt.Errorf("unsupported RDB version %s", header[5:])
+	}
+
+	now := time.Now().UnixMilli()
+	currentDB, expireAt := 0, int64(0)
+	for {
+		op, err := rd.byte()
+		if err != nil {
+			return stats, err
+		}
+		switch op {
+		case opEOF:
+			return stats, rd.checksum(version)
+		case opSelectDB:
+			n, err := rd.length()
+			if err != nil {
+				return stats, err
+			}
+			currentDB = int(n)
+		case opExpireTime:
+			if err := rd.read(rd.buf[:4]); err != nil {
+				return stats, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(rd.buf[:4])) * 1000
+		case opExpireTimeMs:
+			if err := rd.read(rd.buf[:8]); err != nil {
+				return stats, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(rd.buf[:8]))
+		case opResizeDB:
+			err = rd.skipLengths(2)
+		case opSlotInfo:
+			err = rd.skipLengths(3)
+		case opAux:
+			err = rd.skipStrings(2)
+		case opFunction2:
+			err = rd.skipStrings(1)
+		case opFreq:
+			_, err = rd.byte()
+		case opIdle:
+			err = rd.skipLengths(1)
+		case opModuleAux:
+			return stats, errors.New("the module data can't be imported")
+		default:
+			key, err := rd.string()
+			if err != nil {
+				return stats, err
+			}
+			entry, ok, err := rd.value(op, key)
+			if err != nil {
+				return stats, fmt.Errorf("key '%s': %w", key, err)
+			}
+			entry.ExpireAt = expireAt
+			expireAt = 0
+			switch {
+			case !ok:
+				stats.Skipped[typeName(op)]++
+			case db != AllDBs && currentDB != db:
+				stats.OtherDBs++
+			case entry.ExpireAt != 0 && entry.ExpireAt <= now:
+				stats.Expired++
+			default:
+				restore(entry)
+				stats.Keys++
+			}
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+}
+
+// value reads the value of a key, false when goldis doesn't have its type
+func (rd *reader) value(valueType byte, key string) (datastore.Entry, bool, error) {
+	entry := datastore.Entry{Key: key, Type: datastore.STR}
+	var err error
+	switch valueType {
+	case typeString:
+		entry.Value, err = rd.string()
+		return entry, true, err
+	case typeZSet, typeZSet2:
+		entry.Type = datastore.ZSET
+		entry.Members, err = rd.zset(valueType == typeZSet2)
+		return entry, true, err
+	case typeZSetZiplist, typeZSetListpack:
+		entry.Type = datastore.ZSET
+		blob, err := rd.string()
+		if err != nil {
+			return entry, false, err
+		}
+		var items []string
+		if valueType == typeZSetZiplist {
+			items, err = ziplistEntries([]byte(blob))
+		} else {
+			items, err = listpackEntries([]byte(blob))
+		}
+		if err != nil {
+			return entry, false, err
+		}
+		entry.Members, err = zsetMembers(items)
+		return entry, true, err
+	case typeList, typeSet, typeListQuicklist:
+		return entry, false, rd.skipContainer(1)
+	case typeHash:
+		return entry, false, rd.skipContainer(2)
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeHashZiplist, typeHashListpack, typeSetListpack:
+		return entry, false, rd.skipStrings(1)
+	case typeListQuicklist2:
+		n, err := rd.length()
+		for i := uint64(0); i < n && err == nil; i++ {
+			// the container type of the node, then the node
+			if err = rd.skipLengths(1); err == nil {
+				err = rd.skipStrings(1)
+			}
+		}
+		return entry, false, err
+	case typeStream, typeStream2, typeStream3, typeModule, typeModule2:
+		// they can't be skipped without decoding them, the keys after them can't be found
+		return entry, false, fmt.Errorf("%s values can't be imported, delete them before saving the RDB file", typeName(valueType))
+	}
+	return entry, false, fmt.Errorf("unsupported value type %d", valueType)
+}
+
+func (rd *reader) zset(binaryScores bool) ([]datastore.ZMember, error) {
+	n, err := rd.length()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]datastore.ZMember, 0, minInt(n, 1024))
+	for i := uint64(0); i < n; i++ {
+		name, err := rd.string()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScores {
+			score, err = rd.binaryDouble()
+		} else {
+			score, err = rd.stringDouble()
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, datastore.ZMember{Name: name, Score: score})
+	}
+	return members, nil
+}
+
+// zsetMembers pairs the members and the scores of a ziplist or a listpack
+func zsetMembers(items []string) ([]datastore.ZMember, error) {
+	if len(items)%2 != 0 {
+		return nil, errors.New("a sorted set member has no score")
+	}
+	members := make([]datastore.ZMember, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		score, err := strconv.ParseFloat(items[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid score '%s'", items[i+1])
+		}
+		members = append(members, datastore.ZMember{Name: items[i], Score: score})
+	}
+	return members, nil
+}
+
+func typeName(valueType byte) string {
+	switch valueType {
+	case typeList, typeListZiplist, typeListQuicklist, typeListQuicklist2:
+		return "list"
+	case typeSet, typeSetIntset, typeSetListpack:
+		return "set"
+	case typeHash, typeHashZipmap, typeHashZiplist, typeHashListpack:
+		return "hash"
+	case typeStream, typeStream2, typeStream3:
+		return "stream"
+	case typeModule, typeModule2:
+		return "module"
+	}
+	return strconv.Itoa(int(valueType))
+}
+
+// reader reads the RDB primitives and computes the checksum of what it read
+type reader struct {
+	r   *bufio.Reader
+	crc uint64
+	buf [8]byte
+}
+
+func (rd *reader) read(p []byte) error {
+	if _, err := io.ReadFull(rd.r, p); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	rd.crc = crcJones(rd.crc, p)
+	return nil
+}
+
+func (rd *reader) byte() (byte, error) {
+	err := rd.read(rd.buf[:1])
+	return rd.buf[0], err
+}
+
+// checksum verifies the CRC-64 of the file, there's none before version 5 and zero means it was disabled
+func (rd *reader) checksum(version int) error {
+	if version < 5 {
+		return nil
+	}
+	expected := rd.crc
+	if err := rd.read(rd.buf[:8]); err != nil {
+		return err
+	}
+	sum := binary.LittleEndian.Uint64(rd.buf[:8])
+	if sum != 0 && sum != expected {
+		return ErrBadChecksum
+	}
+	return nil
+}
+
+// lengthOrEncoding reads a length, or the special encoding of a string when encoded is true
+func (rd *reader) lengthOrEncoding() (n uint64, encoded bool, err error) {
+	b, err := rd.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := rd.byte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 3:
+		return uint64(b & 0x3f), true, nil
+	}
+	switch b {
+	case 0x80:
+		err = rd.read(rd.buf[:4])
+		return uint64(binary.BigEndian.Uint32(rd.buf[:4])), false, err
+	case 0x81:
+		err = rd.read(rd.buf[:8])
+		return binary.BigEndian.Uint64(rd.buf[:8]), false, err
+	}
+	return 0, false, fmt.Errorf("unknown length encoding 0x%x", b)
+}
+
+func (rd *reader) length() (uint64, error) {
+	n, encoded, err := rd.lengthOrEncoding()
+	if err == nil && encoded {
+		err = errors.New("unexpected encoded string")
+	}
+	return n, err
+}
+
+func (rd *reader) string() (string, error) {
+	n, encoded, err := rd.lengthOrEncoding()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		b, err := rd.bytes(n)
+		return string(b), err
+	}
+	switch n {
+	case encInt8, encInt16, encInt32:
+		size := 1 << n
+		if err := rd.read(rd.buf[:size]); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(littleEndianInt(rd.buf[:size]), 10), nil
+	case encLZF:
+		compressedLen, err := rd.length()
+		if err != nil {
+			return "", err
+		}
+		size, err := rd.length()
+		if err != nil {
+			return "", err
+		}
+		if size > maxStringLen {
+			return "", errors.New("string too long")
+		}
+		compressed, err := rd.bytes(compressedLen)
+		if err != nil {
+			return "", err
+		}
+		b, err := lzfDecompress(compressed, int(size))
+		return string(b), err
+	}
+	return "", fmt.Errorf("unknown string encoding %d", n)
+}
+
+func (rd *reader) bytes(n uint64) ([]byte, error) {
+	if n > maxStringLen {
+		return nil, errors.New("string too long")
+	}
+	b := make([]byte, n)
+	return b, rd.read(b)
+}
+
+// stringDouble reads the scores of the version 1 sorted sets, a length followed by the text of the number
+func (rd *reader) stringDouble() (float64, error) {
+	n, err := rd.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	b, err := rd.bytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(b), 64)
+}
+
+func (rd *reader) binaryDouble() (float64, error) {
+	if err := rd.read(rd.buf[:8]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(rd.buf[:8])), nil
+}
+
+func (rd *reader) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := rd.length(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rd *reader) skipStrings(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := rd.string(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipContainer skips a container of stringsPerItem strings per item
+func (rd *reader) skipContainer(stringsPerItem int) error {
+	n, err := rd.length()
+	for i := uint64(0); i < n && err == nil; i++ {
+		err = rd.skipStrings(stringsPerItem)
+	}
+	return err
+}
+
+func minInt(n uint64, limit int) int {
+	if n < uint64(limit) {
+		return int(n)
+	}
+	return limit
+}
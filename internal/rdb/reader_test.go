@@ -0,0 +1,247 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miladbarzideh/goldis/internal/datastore"
+)
+
+// rdbWriter builds the RDB files of the tests, like redis-server would write them
+type rdbWriter struct {
+	bytes.Buffer
+}
+
+func newRDBWriter(version string) *rdbWriter {
+	w := &rdbWriter{}
+	w.WriteString("REDIS" + version)
+	return w
+}
+
+func (w *rdbWriter) length(n int) {
+	switch {
+	case n < 1<<6:
+		w.WriteByte(byte(n))
+	case n < 1<<14:
+		w.WriteByte(byte(n>>8) | 0x40)
+		w.WriteByte(byte(n))
+	default:
+		w.WriteByte(0x80)
+		_ = binary.Write(w, binary.BigEndian, uint32(n))
+	}
+}
+
+func (w *rdbWriter) str(s string) {
+	w.length(len(s))
+	w.WriteString(s)
+}
+
+func (w *rdbWriter) end() []byte {
+	w.WriteByte(opEOF)
+	sum := crcJones(0, w.Bytes())
+	_ = binary.Write(w, binary.LittleEndian, sum)
+	return w.Bytes()
+}
+
+// ziplist builds a ziplist of strings and small integers
+func ziplist(entries ...[]byte) string {
+	var body bytes.Buffer
+	prev := 0
+	for _, entry := range entries {
+		body.WriteByte(byte(prev))
+		body.Write(entry)
+		prev = 1 + len(entry)
+	}
+	body.WriteByte(0xff)
+	zl := make([]byte, 10, 10+body.Len())
+	binary.LittleEndian.PutUint32(zl, uint32(10+body.Len()))
+	binary.LittleEndian.PutUint16(zl[8:], uint16(len(entries)))
+	return string(append(zl, body.Bytes()...))
+}
+
+// listpack builds a listpack from the encoded entries
+func listpack(entries ...[]byte) string {
+	var body bytes.Buffer
+	for _, entry := range entries {
+		body.Write(entry)
+		body.WriteByte(byte(len(entry)))
+	}
+	body.WriteByte(0xff)
+	lp := make([]byte, 6, 6+body.Len())
+	binary.LittleEndian.PutUint32(lp, uint32(6+body.Len()))
+	binary.LittleEndian.PutUint16(lp[4:], uint16(len(entries)))
+	return string(append(lp, body.Bytes()...))
+}
+
+func readAll(t *testing.T, data []byte, db int) (map[string]datastore.Entry, Stats) {
+	entries := make(map[string]datastore.Entry)
+	stats, err := Read(bytes.NewReader(data), db, func(entry datastore.Entry) {
+		entries[entry.Key] = entry
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return entries, stats
+}
+
+func TestRead_Types(t *testing.T) {
+	future := time.Now().Add(time.Hour).UnixMilli()
+	w := newRDBWriter("0011")
+	w.WriteByte(opAux)
+	w.str("redis-ver")
+	w.str("7.2.4")
+	w.WriteByte(opSelectDB)
+	w.length(0)
+	w.WriteByte(opResizeDB)
+	w.length(6)
+	w.length(1)
+
+	w.WriteByte(typeString)
+	w.str("plain")
+	w.str("hello")
+
+	// an int16 encoded string with an expiry
+	w.WriteByte(opExpireTimeMs)
+	_ = binary.Write(w, binary.LittleEndian, uint64(future))
+	w.WriteByte(typeString)
+	w.str("counter")
+	w.Write([]byte{0xc0 | encInt16, 0x39, 0x30})
+
+	// "abcabcabc" compressed with lzf
+	w.WriteByte(typeString)
+	w.str("compressed")
+	w.Write([]byte{0xc0 | encLZF, 6, 9, 2, 'a', 'b', 'c', 0x80, 2})
+
+	w.WriteByte(typeZSet2)
+	w.str("binary")
+	w.length(2)
+	w.str("a")
+	_ = binary.Write(w, binary.LittleEndian, math.Float64bits(1.5))
+	w.str("b")
+	_ = binary.Write(w, binary.LittleEndian, math.Float64bits(math.Inf(1)))
+
+	w.WriteByte(typeZSetZiplist)
+	w.str("zip")
+	w.str(ziplist([]byte{0x01, 'x'}, []byte{0xf3}, []byte{0x01, 'y'}, []byte{0xc0, 0x18, 0xfc}))
+
+	w.WriteByte(typeZSetListpack)
+	w.str("pack")
+	w.str(listpack([]byte{0x81, 'x'}, []byte{0x07}, []byte{0x81, 'y'}, []byte{0xdf, 0xff}, []byte{0x81, 'z'}, []byte{0x83, '2', '.', '5'}))
+
+	w.WriteByte(typeList)
+	w.str("list")
+	w.length(2)
+	w.str("a")
+	w.str("b")
+
+	entries, stats := readAll(t, w.end(), 0)
+
+	if stats.Keys != 6 || stats.Skipped["list"] != 1 {
+		t.Errorf("Expected 6 keys and a skipped list, got %+v", stats)
+	}
+	expected := map[string]string{"plain": "hello", "counter": "12345", "compressed": "abcabcabc"}
+	for key, value := range expected {
+		if entries[key].Value != value {
+			t.Errorf("Expected %s to be '%s', got '%s'", key, value, entries[key].Value)
+		}
+	}
+	if entries["counter"].ExpireAt != future || entries["plain"].ExpireAt != 0 {
+		t.Errorf("Expected only counter to expire at %d, got %v", future, entries)
+	}
+	scores := map[string][]datastore.ZMember{
+		"binary": {{Name: "a", Score: 1.5}, {Name: "b", Score: math.Inf(1)}},
+		"zip":    {{Name: "x", Score: 2}, {Name: "y", Score: -1000}},
+		"pack":   {{Name: "x", Score: 7}, {Name: "y", Score: -1}, {Name: "z", Score: 2.5}},
+	}
+	for key, members := range scores {
+		entry := entries[key]
+		if entry.Type != datastore.ZSET || len(entry.Members) != len(members) {
+			t.Fatalf("Expected %s to be a sorted set of %v, got %v", key, members, entry)
+		}
+		for i, member := range members {
+			if entry.Members[i] != member {
+				t.Errorf("Expected %s member %v, got %v", key, member, entry.Members[i])
+			}
+		}
+	}
+}
+
+func TestRead_DatabasesAndExpired(t *testing.T) {
+	w := newRDBWriter("0009")
+	w.WriteByte(opSelectDB)
+	w.length(0)
+	w.WriteByte(opExpireTime)
+	_ = binary.Write(w, binary.LittleEndian, uint32(1000))
+	w.WriteByte(typeString)
+	w.str("old")
+	w.str("v")
+	w.WriteByte(typeZSet)
+	w.str("v1")
+	w.length(1)
+	w.str("m")
+	w.WriteByte(3)
+	w.WriteString("0.5")
+	w.WriteByte(opSelectDB)
+	w.length(1)
+	w.WriteByte(typeString)
+	w.str("other")
+	w.str("v")
+	data := w.end()
+
+	entries, stats := readAll(t, data, 0)
+	if stats.Keys != 1 || stats.Expired != 1 || stats.OtherDBs != 1 {
+		t.Errorf("Expected 1 key, 1 expired and 1 in another db, got %+v", stats)
+	}
+	if members := entries["v1"].Members; len(members) != 1 || members[0].Score != 0.5 {
+		t.Errorf("Expected m with score 0.5, got %v", members)
+	}
+	if _, stats := readAll(t, data, AllDBs); stats.Keys != 2 {
+		t.Errorf("Expected 2 keys from every database, got %+v", stats)
+	}
+}
+
+func TestRead_Corrupted(t *testing.T) {
+	w := newRDBWriter("0010")
+	w.WriteByte(typeString)
+	w.str("k")
+	w.str("v")
+	data := w.end()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-12] ^= 'v' ^ 'w'
+	if _, err := Read(bytes.NewReader(flipped), 0, func(datastore.Entry) {}); err != ErrBadChecksum {
+		t.Errorf("Expected ErrBadChecksum, got %v", err)
+	}
+	if _, err := Read(bytes.NewReader(data[:len(data)-10]), 0, func(datastore.Entry) {}); err == nil {
+		t.Errorf("Expected an error for a truncated file")
+	}
+	if _, err := Read(bytes.NewReader([]byte("REDIS0099")), 0, func(datastore.Entry) {}); err == nil {
+		t.Errorf("Expected an error for an unsupported version")
+	}
+}
+
+func TestCRCJones(t *testing.T) {
+	if sum := crcJones(0, []byte("123456789")); sum != 0xe9c6d914c4b8d9ca {
+		t.Errorf("Expected 0xe9c6d914c4b8d9ca, got %x", sum)
+	}
+}
+
+func TestRead_Stream(t *testing.T) {
+	w := newRDBWriter("0011")
+	w.WriteByte(typeString)
+	w.str("k")
+	w.str("v")
+	w.WriteByte(typeStream2)
+	w.str("events")
+	w.length(0)
+	data := w.end()
+
+	_, err := Read(bytes.NewReader(data), 0, func(datastore.Entry) {})
+	if err == nil || !strings.Contains(err.Error(), "key 'events': stream values can't be imported") {
+		t.Errorf("Expected the stream to stop the import, got %v", err)
+	}
+}
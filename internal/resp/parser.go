@@ -0,0 +1,125 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+const (
+	maxMultiBulkLen = 1024 * 1024
+	maxBulkLen      = 512 * 1024 * 1024
+	maxInlineLen    = 64 * 1024
+)
+
+// ErrIncomplete is returned when the buffer does not hold a whole request yet
+var ErrIncomplete = errors.New("incomplete request")
+
+// ProtocolError is returned for malformed requests, the connection can't be used after that
+type ProtocolError struct {
+	msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return "ERR Protocol error: " + e.msg
+}
+
+func protocolError(msg string) error {
+	return &ProtocolError{msg: msg}
+}
+
+// ParseCommand extracts one request from the beginning of buf.
+// A request is either a RESP array of bulk strings (what redis clients send)
+// or an inline command, a line of space separated words (what netcat users type).
+// It returns the command arguments and the number of consumed bytes.
+// An empty inline line consumes bytes and returns no arguments.
+func ParseCommand(buf []byte) ([]string, int, error) {
+	if len(buf) == 0 {
+		return nil, 0, ErrIncomplete
+	}
+	if buf[0] == byte(Array) {
+		return parseMultiBulk(buf)
+	}
+	return parseInline(buf)
+}
+
+func parseInline(buf []byte) ([]string, int, error) {
+	end := bytes.IndexByte(buf, '\n')
+	if end < 0 {
+		if len(buf) > maxInlineLen {
+			return nil, 0, protocolError("too big inline request")
+		}
+		return nil, 0, ErrIncomplete
+	}
+	line := bytes.TrimSuffix(buf[:end], []byte("\r"))
+	fields := bytes.Fields(line)
+	args := make([]string, len(fields))
+	for i, field := range fields {
+		args[i] = string(field)
+	}
+	return args, end + 1, nil
+}
+
+func parseMultiBulk(buf []byte) ([]string, int, error) {
+	count, pos, err := readLength(buf, 0, Array)
+	if err != nil {
+		return nil, 0, err
+	}
+	if count > maxMultiBulkLen {
+		return nil, 0, protocolError("invalid multibulk length")
+	}
+	if count <= 0 {
+		return nil, pos, nil
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if pos >= len(buf) {
+			return nil, 0, ErrIncomplete
+		}
+		if buf[pos] != byte(BulkString) {
+			return nil, 0, protocolError("expected '$', got '" + string(buf[pos]) + "'")
+		}
+		size, next, err := readLength(buf, pos, BulkString)
+		if err != nil {
+			return nil, 0, err
+		}
+		if size < 0 || size > maxBulkLen {
+			return nil, 0, protocolError("invalid bulk length")
+		}
+		end := next + size
+		if end+len(crlf) > len(buf) {
+			return nil, 0, ErrIncomplete
+		}
+		if buf[end] != '\r' || buf[end+1] != '\n' {
+			return nil, 0, protocolError("bulk string is not terminated by CRLF")
+		}
+		args = append(args, string(buf[next:end]))
+		pos = end + len(crlf)
+	}
+	return args, pos, nil
+}
+
+// readLength reads a "<prefix><n>\r\n" header starting at pos,
+// it returns n and the position right after the header
+func readLength(buf []byte, pos int, kind Kind) (int, int, error) {
+	end := bytes.Index(buf[pos:], []byte(crlf))
+	if end < 0 {
+		if len(buf)-pos > maxInlineLen {
+			return 0, 0, protocolError("too big " + kindName(kind) + " count")
+		}
+		return 0, 0, ErrIncomplete
+	}
+	n, err := strconv.Atoi(string(buf[pos+1 : pos+end]))
+	if err != nil {
+		return 0, 0, protocolError("invalid " + kindName(kind) + " length")
+	}
+	return n, pos + end + len(crlf), nil
+}
+
+func kindName(kind Kind) string {
+	if kind == Array {
+		return "multibulk"
+	}
+	return "bulk"
+}
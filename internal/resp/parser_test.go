@@ -0,0 +1,76 @@
+package resp
+
+import (
+	"testing"
+)
+
+func TestParseCommand_MultiBulk(t *testing.T) {
+	input := []byte("*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+
+	args, n, err := ParseCommand(input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n != len(input) {
+		t.Errorf("Expected %d consumed bytes, got %d", len(input), n)
+	}
+	expected := []string{"set", "key", "value"}
+	if len(args) != len(expected) {
+		t.Fatalf("Expected %d args, got %d", len(expected), len(args))
+	}
+	for i, arg := range expected {
+		if args[i] != arg {
+			t.Errorf("Expected arg %d to be %s, got %s", i, arg, args[i])
+		}
+	}
+}
+
+func TestParseCommand_BinarySafe(t *testing.T) {
+	input := []byte("*2\r\n$3\r\nget\r\n$4\r\na\r\nb\r\n")
+
+	args, _, err := ParseCommand(input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if args[1] != "a\r\nb" {
+		t.Errorf("Expected arg to be %q, got %q", "a\r\nb", args[1])
+	}
+}
+
+func TestParseCommand_Inline(t *testing.T) {
+	input := []byte("set  key value\r\nget key\n")
+
+	args, n, err := ParseCommand(input)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n != len("set  key value\r\n") {
+		t.Errorf("Expected %d consumed bytes, got %d", len("set  key value\r\n"), n)
+	}
+	if len(args) != 3 || args[0] != "set" || args[2] != "value" {
+		t.Errorf("Expected [set key value], got %v", args)
+	}
+}
+
+func TestParseCommand_Incomplete(t *testing.T) {
+	inputs := []string{"", "*2\r\n$3\r\nget\r\n", "*2\r\n$3\r\nget\r\n$3\r\nke", "*1", "get key"}
+	for _, input := range inputs {
+		_, _, err := ParseCommand([]byte(input))
+		if err != ErrIncomplete {
+			t.Errorf("Expected ErrIncomplete for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestParseCommand_ProtocolError(t *testing.T) {
+	inputs := []string{"*x\r\n", "*1\r\n:1\r\n", "*1\r\n$3\r\nget!!"}
+	for _, input := range inputs {
+		_, _, err := ParseCommand([]byte(input))
+		if _, ok := err.(*ProtocolError); !ok {
+			t.Errorf("Expected protocol error for %q, got %v", input, err)
+		}
+	}
+}
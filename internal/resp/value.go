@@ -0,0 +1,251 @@
+package resp
+
+import (
+	"math"
+	"strconv"
+)
+
+// Protocol versions negotiated by HELLO
+const (
+	Version2 = 2
+	Version3 = 3
+)
+
+// Kind is the RESP type of Value, it matches the type prefix on the wire
+type Kind byte
+
+const (
+	SimpleString Kind = '+'
+	Error        Kind = '-'
+	Integer      Kind = ':'
+	BulkString   Kind = '$'
+	Array        Kind = '*'
+	// RESP3 only types, they are downgraded to RESP2 types when the client speaks RESP2
+	Null    Kind = '_'
+	Boolean Kind = '#'
+	Double  Kind = ','
+	Map     Kind = '%'
+	Set     Kind = '~'
+	Push    Kind = '>'
+)
+
+const crlf = "\r\n"
+
+// Value is a reply produced by a command
+type Value struct {
+	Kind  Kind
+	Str   string
+	Int   int64
+	Float float64
+	Bool  bool
+	// Elems holds the items of aggregate types, a map is stored as key, value, key, value, ...
+	Elems []Value
+	// Nil marks a null bulk string or a null array
+	Nil bool
+}
+
+func OK() Value {
+	return NewSimpleString("OK")
+}
+
+func NewSimpleString(s string) Value {
+	return Value{Kind: SimpleString, Str: s}
+}
+
+// NewError creates an error reply, the message should start with an error code like ERR
+func NewError(msg string) Value {
+	return Value{Kind: Error, Str: msg}
+}
+
+func NewInteger(n int64) Value {
+	return Value{Kind: Integer, Int: n}
+}
+
+func NewBulkString(s string) Value {
+	return Value{Kind: BulkString, Str: s}
+}
+
+func NilBulkString() Value {
+	return Value{Kind: BulkString, Nil: true}
+}
+
+// NilArray is the reply of an aborted transaction
+func NilArray() Value {
+	return Value{Kind: Array, Nil: true}
+}
+
+func NewArray(elems ...Value) Value {
+	if elems == nil {
+		elems = make([]Value, 0)
+	}
+	return Value{Kind: Array, Elems: elems}
+}
+
+// NewBulkArray creates an array of bulk strings
+func NewBulkArray(items []string) Value {
+	elems := make([]Value, len(items))
+	for i, item := range items {
+		elems[i] = NewBulkString(item)
+	}
+	return NewArray(elems...)
+}
+
+func NewNull() Value {
+	return Value{Kind: Null}
+}
+
+func NewBoolean(b bool) Value {
+	return Value{Kind: Boolean, Bool: b}
+}
+
+func NewDouble(f float64) Value {
+	return Value{Kind: Double, Float: f}
+}
+
+// NewMap creates a map from a flat key, value, key, value, ... list
+func NewMap(kvs ...Value) Value {
+	if kvs == nil {
+		kvs = make([]Value, 0)
+	}
+	return Value{Kind: Map, Elems: kvs}
+}
+
+func NewSet(elems ...Value) Value {
+	if elems == nil {
+		elems = make([]Value, 0)
+	}
+	return Value{Kind: Set, Elems: elems}
+}
+
+// NewBulkSet creates a set of bulk strings
+func NewBulkSet(items []string) Value {
+	v := NewBulkArray(items)
+	v.Kind = Set
+	return v
+}
+
+// NewPush creates an out-of-band message like pubsub messages
+func NewPush(elems ...Value) Value {
+	return Value{Kind: Push, Elems: elems}
+}
+
+// NoReply is returned by the commands sending nothing back, like a successful SHUTDOWN
+func NoReply() Value {
+	return Value{}
+}
+
+// IsNoReply reports whether the value is NoReply
+func (v Value) IsNoReply() bool {
+	return v.Kind == 0
+}
+
+func (v Value) IsError() bool {
+	return v.Kind == Error
+}
+
+// Encode serializes the value with the given protocol version
+func (v Value) Encode(proto int) []byte {
+	return v.AppendTo(nil, proto)
+}
+
+// AppendTo appends the encoding of the value to buf,
+// RESP3 types are mapped to their RESP2 equivalent when proto is Version2
+func (v Value) AppendTo(buf []byte, proto int) []byte {
+	if proto < Version3 {
+		return v.appendResp2(buf)
+	}
+	switch v.Kind {
+	case Null:
+		return append(buf, "_\r\n"...)
+	case BulkString:
+		if v.Nil {
+			return append(buf, "_\r\n"...)
+		}
+	case Array:
+		if v.Nil {
+			return append(buf, "_\r\n"...)
+		}
+		buf = appendLength(buf, v.Kind, len(v.Elems))
+		return appendElems(buf, v.Elems, proto)
+	case Boolean:
+		if v.Bool {
+			return append(buf, "#t\r\n"...)
+		}
+		return append(buf, "#f\r\n"...)
+	case Double:
+		buf = append(buf, byte(v.Kind))
+		buf = append(buf, formatDouble(v.Float)...)
+		return append(buf, crlf...)
+	case Map:
+		buf = appendLength(buf, v.Kind, len(v.Elems)/2)
+		return appendElems(buf, v.Elems, proto)
+	case Set, Push:
+		buf = appendLength(buf, v.Kind, len(v.Elems))
+		return appendElems(buf, v.Elems, proto)
+	}
+	return v.appendResp2(buf)
+}
+
+func (v Value) appendResp2(buf []byte) []byte {
+	switch v.Kind {
+	case SimpleString, Error:
+		buf = append(buf, byte(v.Kind))
+		buf = append(buf, v.Str...)
+		buf = append(buf, crlf...)
+	case Integer:
+		buf = append(buf, byte(v.Kind))
+		buf = strconv.AppendInt(buf, v.Int, 10)
+		buf = append(buf, crlf...)
+	case BulkString:
+		if v.Nil {
+			return append(buf, "$-1\r\n"...)
+		}
+		buf = appendLength(buf, v.Kind, len(v.Str))
+		buf = append(buf, v.Str...)
+		buf = append(buf, crlf...)
+	case Array:
+		if v.Nil {
+			return append(buf, "*-1\r\n"...)
+		}
+		buf = appendLength(buf, v.Kind, len(v.Elems))
+		return appendElems(buf, v.Elems, Version2)
+	case Null:
+		return append(buf, "$-1\r\n"...)
+	case Boolean:
+		if v.Bool {
+			return append(buf, ":1\r\n"...)
+		}
+		return append(buf, ":0\r\n"...)
+	case Double:
+		return NewBulkString(formatDouble(v.Float)).appendResp2(buf)
+	case Map, Set, Push:
+		buf = appendLength(buf, Array, len(v.Elems))
+		return appendElems(buf, v.Elems, Version2)
+	}
+	return buf
+}
+
+func appendElems(buf []byte, elems []Value, proto int) []byte {
+	for _, elem := range elems {
+		buf = elem.AppendTo(buf, proto)
+	}
+	return buf
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func appendLength(buf []byte, kind Kind, n int) []byte {
+	buf = append(buf, byte(kind))
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return append(buf, crlf...)
+}
@@ -0,0 +1,62 @@
+package resp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValue_Encode(t *testing.T) {
+	cases := map[string]Value{
+		"+OK\r\n":                       OK(),
+		"-ERR syntax error\r\n":         NewError("ERR syntax error"),
+		":-2\r\n":                       NewInteger(-2),
+		"$5\r\nhello\r\n":               NewBulkString("hello"),
+		"$0\r\n\r\n":                    NewBulkString(""),
+		"$-1\r\n":                       NilBulkString(),
+		"*0\r\n":                        NewArray(),
+		"*2\r\n$1\r\na\r\n:1\r\n":       NewArray(NewBulkString("a"), NewInteger(1)),
+		"*2\r\n$1\r\nk\r\n$2\r\nk2\r\n": NewBulkArray([]string{"k", "k2"}),
+	}
+	for expected, value := range cases {
+		encoded := string(value.Encode(Version2))
+		if encoded != expected {
+			t.Errorf("Expected %q, got %q", expected, encoded)
+		}
+	}
+}
+
+func TestValue_EncodeResp3(t *testing.T) {
+	cases := map[string]Value{
+		"_\r\n":                              NewNull(),
+		"*1\r\n_\r\n":                        NewArray(NilBulkString()),
+		"#t\r\n":                             NewBoolean(true),
+		",1.5\r\n":                           NewDouble(1.5),
+		",-inf\r\n":                          NewDouble(math.Inf(-1)),
+		"%1\r\n+proto\r\n:3\r\n":             NewMap(NewSimpleString("proto"), NewInteger(3)),
+		"~1\r\n$1\r\na\r\n":                  NewSet(NewBulkString("a")),
+		">2\r\n$7\r\nmessage\r\n$1\r\nc\r\n": NewPush(NewBulkString("message"), NewBulkString("c")),
+	}
+	for expected, value := range cases {
+		encoded := string(value.Encode(Version3))
+		if encoded != expected {
+			t.Errorf("Expected %q, got %q", expected, encoded)
+		}
+	}
+}
+
+func TestValue_EncodeResp3Downgrade(t *testing.T) {
+	cases := map[string]Value{
+		"$-1\r\n":                 NewNull(),
+		":1\r\n":                  NewBoolean(true),
+		"$3\r\n1.5\r\n":           NewDouble(1.5),
+		"*2\r\n+proto\r\n:2\r\n":  NewMap(NewSimpleString("proto"), NewInteger(2)),
+		"*1\r\n$1\r\na\r\n":       NewSet(NewBulkString("a")),
+		"*1\r\n$7\r\nmessage\r\n": NewPush(NewBulkString("message")),
+	}
+	for expected, value := range cases {
+		encoded := string(value.Encode(Version2))
+		if encoded != expected {
+			t.Errorf("Expected %q, got %q", expected, encoded)
+		}
+	}
+}
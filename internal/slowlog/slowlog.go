@@ -0,0 +1,124 @@
+package slowlog
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultThreshold = 10 * time.Millisecond
+	DefaultMaxLen    = 128
+	// the arguments are truncated to keep the memory of the log bounded
+	maxArgs   = 32
+	maxArgLen = 128
+)
+
+// Entry is a command that took longer than the threshold
+type Entry struct {
+	ID       int64
+	Time     time.Time
+	Duration time.Duration
+	// Args are the command and its arguments, truncated
+	Args       []string
+	ClientAddr string
+	ClientName string
+}
+
+// Log keeps the latest slow commands in a ring buffer, it's used by the event loop only
+type Log struct {
+	// entries grow up to maxLen, then a new entry replaces the oldest one at next
+	entries []Entry
+	next    int
+	nextID  int64
+	// threshold is the min duration of a logged command, a negative threshold disables the log
+	threshold time.Duration
+	maxLen    int
+}
+
+func New() *Log {
+	return &Log{threshold: DefaultThreshold, maxLen: DefaultMaxLen}
+}
+
+// SetThreshold sets the min duration of the logged commands, zero logs every command and a negative one none
+func (l *Log) SetThreshold(threshold time.Duration) {
+	l.threshold = threshold
+}
+
+// SetMaxLen sets the number of entries kept, the oldest ones are dropped
+func (l *Log) SetMaxLen(maxLen int) {
+	kept := l.Get(maxLen)
+	l.entries = make([]Entry, 0, len(kept))
+	for i := len(kept) - 1; i >= 0; i-- {
+		l.entries = append(l.entries, kept[i])
+	}
+	l.maxLen = maxLen
+	l.next = 0
+	if maxLen > 0 {
+		l.next = len(l.entries) % maxLen
+	}
+}
+
+// Record logs the command when it took longer than the threshold
+func (l *Log) Record(args []string, duration time.Duration, clientAddr string, clientName string) {
+	if l.threshold < 0 || duration < l.threshold || l.maxLen == 0 {
+		return
+	}
+	entry := Entry{
+		ID:         l.nextID,
+		Time:       time.Now(),
+		Duration:   duration,
+		Args:       truncate(args),
+		ClientAddr: clientAddr,
+		ClientName: clientName,
+	}
+	l.nextID++
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.next] = entry
+	}
+	l.next = (l.next + 1) % l.maxLen
+}
+
+// Get returns the count newest entries from the newest to the oldest, a negative count returns all of them
+func (l *Log) Get(count int) []Entry {
+	n := len(l.entries)
+	if count < 0 || count > n {
+		count = n
+	}
+	entries := make([]Entry, count)
+	for i := range entries {
+		entries[i] = l.entries[(l.next-1-i+n)%n]
+	}
+	return entries
+}
+
+func (l *Log) Len() int {
+	return len(l.entries)
+}
+
+// Reset drops every entry, the ids keep increasing
+func (l *Log) Reset() {
+	l.entries = nil
+	l.next = 0
+}
+
+func truncate(args []string) []string {
+	n := len(args)
+	if n > maxArgs {
+		n = maxArgs
+	}
+	truncated := make([]string, n)
+	for i := 0; i < n; i++ {
+		if i == maxArgs-1 && len(args) > maxArgs {
+			truncated[i] = "... (" + strconv.Itoa(len(args)-maxArgs+1) + " more arguments)"
+			break
+		}
+		arg := args[i]
+		if len(arg) > maxArgLen {
+			arg = arg[:maxArgLen] + "... (" + strconv.Itoa(len(arg)-maxArgLen) + " more bytes)"
+		}
+		truncated[i] = arg
+	}
+	return truncated
+}
@@ -0,0 +1,108 @@
+package slowlog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_Record(t *testing.T) {
+	log := New()
+	log.SetThreshold(time.Millisecond)
+	log.SetMaxLen(2)
+
+	log.Record([]string{"get", "fast"}, time.Microsecond, "127.0.0.1:1000", "")
+	log.Record([]string{"keys", "*"}, 2*time.Millisecond, "127.0.0.1:1000", "app")
+	log.Record([]string{"zshow", "a"}, 3*time.Millisecond, "127.0.0.1:1000", "")
+	log.Record([]string{"zshow", "b"}, 4*time.Millisecond, "127.0.0.1:1000", "")
+
+	if log.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", log.Len())
+	}
+	entries := log.Get(-1)
+	if entries[0].ID != 2 || entries[0].Args[1] != "b" || entries[1].ID != 1 {
+		t.Errorf("Expected the newest entries first, got %v", entries)
+	}
+	if len(log.Get(1)) != 1 {
+		t.Errorf("Expected 1 entry, got %d", len(log.Get(1)))
+	}
+
+	log.Reset()
+	log.Record([]string{"keys", "*"}, time.Second, "127.0.0.1:1000", "")
+	if log.Len() != 1 || log.Get(1)[0].ID != 3 {
+		t.Errorf("Expected the ids to keep increasing after a reset, got %v", log.Get(1))
+	}
+}
+
+func TestLog_SetMaxLen(t *testing.T) {
+	log := New()
+	log.SetThreshold(0)
+	log.SetMaxLen(3)
+	for i := 0; i < 5; i++ {
+		log.Record([]string{"get", "k"}, time.Millisecond, "127.0.0.1:1000", "")
+	}
+	if ids := entryIDs(log.Get(-1)); ids != "4 3 2" {
+		t.Errorf("Expected the 3 newest entries after the ring wrapped, got %s", ids)
+	}
+
+	log.SetMaxLen(2)
+	if ids := entryIDs(log.Get(-1)); ids != "4 3" {
+		t.Errorf("Expected the 2 newest entries, got %s", ids)
+	}
+	log.SetMaxLen(4)
+	log.Record([]string{"get", "k"}, time.Millisecond, "127.0.0.1:1000", "")
+	log.Record([]string{"get", "k"}, time.Millisecond, "127.0.0.1:1000", "")
+	log.Record([]string{"get", "k"}, time.Millisecond, "127.0.0.1:1000", "")
+	if ids := entryIDs(log.Get(-1)); ids != "7 6 5 4" {
+		t.Errorf("Expected the 4 newest entries after growing the log, got %s", ids)
+	}
+	if ids := entryIDs(log.Get(2)); ids != "7 6" {
+		t.Errorf("Expected the 2 newest entries, got %s", ids)
+	}
+
+	log.SetMaxLen(0)
+	log.Record([]string{"get", "k"}, time.Millisecond, "127.0.0.1:1000", "")
+	if log.Len() != 0 {
+		t.Errorf("Expected no entry, got %d", log.Len())
+	}
+}
+
+func entryIDs(entries []Entry) string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, strconv.FormatInt(entry.ID, 10))
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestLog_Disabled(t *testing.T) {
+	log := New()
+	log.SetThreshold(-1)
+
+	log.Record([]string{"keys", "*"}, time.Hour, "127.0.0.1:1000", "")
+
+	if log.Len() != 0 {
+		t.Errorf("Expected no entry, got %d", log.Len())
+	}
+}
+
+func TestLog_Truncate(t *testing.T) {
+	args := make([]string, 40)
+	for i := range args {
+		args[i] = "a"
+	}
+	args[1] = strings.Repeat("x", 200)
+
+	truncated := truncate(args)
+
+	if len(truncated) != maxArgs {
+		t.Fatalf("Expected %d arguments, got %d", maxArgs, len(truncated))
+	}
+	if truncated[1] != strings.Repeat("x", 128)+"... (72 more bytes)" {
+		t.Errorf("Expected a truncated argument, got '%s'", truncated[1])
+	}
+	if truncated[maxArgs-1] != "... (9 more arguments)" {
+		t.Errorf("Expected the number of dropped arguments, got '%s'", truncated[maxArgs-1])
+	}
+}
@@ -0,0 +1,93 @@
+package stats
+
+import (
+	"sort"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the command latency histograms, the last bucket has no bound
+var LatencyBuckets = []time.Duration{
+	10 * time.Microsecond, 50 * time.Microsecond, 100 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// Command are the counters of a command
+type Command struct {
+	Name     string
+	Calls    int64
+	Duration time.Duration
+	// Buckets counts the calls per latency bucket, Buckets[i] are the calls up to LatencyBuckets[i]
+	// and over LatencyBuckets[i-1], the last one counts the calls over every bound
+	Buckets []int64
+}
+
+// Commands counts the executed commands, it's used by the event loop only
+type Commands struct {
+	total    int64
+	commands map[string]*Command
+	// second is the unix time counted by current, last is the count of the second before
+	second  int64
+	current int64
+	last    int64
+}
+
+func NewCommands() *Commands {
+	return &Commands{commands: make(map[string]*Command)}
+}
+
+// Record counts a command started at start and run for duration
+func (c *Commands) Record(name string, start time.Time, duration time.Duration) {
+	c.total++
+	sec := start.Unix()
+	if sec != c.second {
+		if sec == c.second+1 {
+			c.last = c.current
+		} else {
+			c.last = 0
+		}
+		c.current = 0
+		c.second = sec
+	}
+	c.current++
+
+	command, ok := c.commands[name]
+	if !ok {
+		command = &Command{Name: name, Buckets: make([]int64, len(LatencyBuckets)+1)}
+		c.commands[name] = command
+	}
+	command.Calls++
+	command.Duration += duration
+	bucket := sort.Search(len(LatencyBuckets), func(i int) bool { return duration <= LatencyBuckets[i] })
+	command.Buckets[bucket]++
+}
+
+// Total returns the number of commands executed since the start
+func (c *Commands) Total() int64 {
+	return c.total
+}
+
+// OpsPerSec returns the number of commands executed during the last full second
+func (c *Commands) OpsPerSec(now time.Time) int64 {
+	switch now.Unix() {
+	case c.second:
+		return c.last
+	case c.second + 1:
+		return c.current
+	}
+	return 0
+}
+
+// PerCommand returns a copy of the counters of every executed command, sorted by name
+func (c *Commands) PerCommand() []Command {
+	commands := make([]Command, 0, len(c.commands))
+	for _, command := range c.commands {
+		copied := *command
+		copied.Buckets = append([]int64(nil), command.Buckets...)
+		commands = append(commands, copied)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommands_OpsPerSec(t *testing.T) {
+	commands := NewCommands()
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 5; i++ {
+		commands.Record("get", start.Add(time.Duration(i)*100*time.Millisecond), time.Microsecond)
+	}
+	commands.Record("get", start.Add(1200*time.Millisecond), time.Microsecond)
+
+	if ops := commands.OpsPerSec(start.Add(1500 * time.Millisecond)); ops != 5 {
+		t.Errorf("Expected 5 ops/sec, got %d", ops)
+	}
+	if ops := commands.OpsPerSec(start.Add(2500 * time.Millisecond)); ops != 1 {
+		t.Errorf("Expected 1 op/sec, got %d", ops)
+	}
+	if ops := commands.OpsPerSec(start.Add(10 * time.Second)); ops != 0 {
+		t.Errorf("Expected 0 op/sec, got %d", ops)
+	}
+	if commands.Total() != 6 {
+		t.Errorf("Expected 6 commands, got %d", commands.Total())
+	}
+}
+
+func TestCommands_PerCommand(t *testing.T) {
+	commands := NewCommands()
+	now := time.Now()
+
+	commands.Record("set", now, 5*time.Microsecond)
+	commands.Record("keys", now, 2*time.Millisecond)
+	commands.Record("keys", now, 2*time.Second)
+
+	perCommand := commands.PerCommand()
+	if len(perCommand) != 2 || perCommand[0].Name != "keys" || perCommand[1].Name != "set" {
+		t.Fatalf("Expected keys and set, got %v", perCommand)
+	}
+	keys := perCommand[0]
+	if keys.Calls != 2 || keys.Duration != 2*time.Second+2*time.Millisecond {
+		t.Errorf("Expected 2 calls for 2.002s, got %d for %v", keys.Calls, keys.Duration)
+	}
+	if keys.Buckets[5] != 1 || keys.Buckets[len(LatencyBuckets)] != 1 {
+		t.Errorf("Expected the 5ms and the unbounded buckets to count a call, got %v", keys.Buckets)
+	}
+	if perCommand[1].Buckets[0] != 1 {
+		t.Errorf("Expected the 10us bucket to count a call, got %v", perCommand[1].Buckets)
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"tls-*", "tls-port", true},
+		{"tls-*", "port", false},
+		{"*-file", "tls-cert-file", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"app:*", "app:users:1", true},
+		{"app:*:1", "app:users:1", true},
+		{"app:*:1", "app:users:2", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b", "xxbxxa", false},
+	}
+	for _, c := range cases {
+		if GlobMatch(c.pattern, c.s) != c.match {
+			t.Errorf("Expected GlobMatch(%q, %q) to be %v", c.pattern, c.s, c.match)
+		}
+	}
+}
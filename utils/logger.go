@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel follows the redis loglevel names, a message is written when its level is >= the current level
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = iota
+	LogVerbose
+	LogNotice
+	LogWarning
+)
+
+var logLevelNames = []string{"debug", "verbose", "notice", "warning"}
+
+var logLevel atomic.Int32
+
+func init() {
+	logLevel.Store(int32(LogNotice))
+}
+
+// ParseLogLevel converts a level name (debug, verbose, notice, warning) to a LogLevel
+func ParseLogLevel(name string) (LogLevel, error) {
+	for i, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return LogLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level '%s', expected one of %s", name, strings.Join(logLevelNames, ", "))
+}
+
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+func SetLogLevel(level LogLevel) {
+	logLevel.Store(int32(level))
+}
+
+func GetLogLevel() LogLevel {
+	return LogLevel(logLevel.Load())
+}
+
+func Debugf(format string, args ...interface{}) {
+	logf(LogDebug, format, args...)
+}
+
+func Verbosef(format string, args ...interface{}) {
+	logf(LogVerbose, format, args...)
+}
+
+func Noticef(format string, args ...interface{}) {
+	logf(LogNotice, format, args...)
+}
+
+func Warningf(format string, args ...interface{}) {
+	logf(LogWarning, format, args...)
+}
+
+func logf(level LogLevel, format string, args ...interface{}) {
+	if level < GetLogLevel() {
+		return
+	}
+	_ = log.Output(3, fmt.Sprintf(format, args...))
+}
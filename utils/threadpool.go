@@ -1,11 +1,12 @@
 package utils
 
 import (
-	"log"
 	"sync"
 )
 
-const numThreads = 5
+const DefaultNumThreads = 5
+
+var numThreads = DefaultNumThreads
 
 type Work struct {
 	f   func(interface{})
@@ -14,9 +15,12 @@ type Work struct {
 
 type ThreadPool struct {
 	threads  []chan Work
-	queue    chan Work
+	queue    []Work
 	mutex    sync.Mutex
 	notEmpty *sync.Cond
+	// busy counts the works queued or running, Drain waits on idle until it's zero
+	busy int
+	idle *sync.Cond
 }
 
 var singleInstance *ThreadPool
@@ -26,12 +30,13 @@ func GetThreadPoolInstance() *ThreadPool {
 	if singleInstance == nil {
 		once.Do(
 			func() {
-				log.Println("Creating Single Thread Pool Instance Now")
+				Verbosef("Creating Single Thread Pool Instance Now")
 				singleInstance = &ThreadPool{}
 				singleInstance.threads = make([]chan Work, numThreads)
-				singleInstance.queue = make(chan Work, 1)
+				singleInstance.queue = make([]Work, 0)
 				singleInstance.mutex = sync.Mutex{}
 				singleInstance.notEmpty = sync.NewCond(&singleInstance.mutex)
+				singleInstance.idle = sync.NewCond(&singleInstance.mutex)
 
 				for i := 0; i < numThreads; i++ {
 					singleInstance.threads[i] = make(chan Work)
@@ -39,11 +44,16 @@ func GetThreadPoolInstance() *ThreadPool {
 				}
 			})
 	} else {
-		log.Println("Single Instance already created")
+		Debugf("Single Instance already created")
 	}
 	return singleInstance
 }
 
+// SetNumThreads sets the size of the pool, it has no effect once the pool is created
+func SetNumThreads(n int) {
+	numThreads = n
+}
+
 func worker(tp *ThreadPool) {
 	for {
 		tp.mutex.Lock()
@@ -51,10 +61,19 @@ func worker(tp *ThreadPool) {
 			tp.notEmpty.Wait()
 		}
 
-		w := <-tp.queue
+		w := tp.queue[0]
+		tp.queue[0] = Work{}
+		tp.queue = tp.queue[1:]
 		tp.mutex.Unlock()
 
 		w.f(w.arg)
+
+		tp.mutex.Lock()
+		tp.busy--
+		if tp.busy == 0 {
+			tp.idle.Broadcast()
+		}
+		tp.mutex.Unlock()
 	}
 }
 
@@ -64,7 +83,24 @@ func (tp *ThreadPool) ThreadPoolQueue(f func(interface{}), arg interface{}) {
 		arg: arg,
 	}
 	tp.mutex.Lock()
-	tp.queue <- w
+	tp.queue = append(tp.queue, w)
+	tp.busy++
 	tp.notEmpty.Signal()
 	tp.mutex.Unlock()
 }
+
+// Drain blocks until every queued work is done
+func (tp *ThreadPool) Drain() {
+	tp.mutex.Lock()
+	for tp.busy > 0 {
+		tp.idle.Wait()
+	}
+	tp.mutex.Unlock()
+}
+
+// Pending returns the number of works queued or running
+func (tp *ThreadPool) Pending() int {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	return tp.busy
+}
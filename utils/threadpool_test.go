@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThreadPool_Drain(t *testing.T) {
+	tp := GetThreadPoolInstance()
+	var done atomic.Int32
+	for i := 0; i < 20; i++ {
+		tp.ThreadPoolQueue(func(interface{}) {
+			time.Sleep(time.Millisecond)
+			done.Add(1)
+		}, nil)
+	}
+	tp.Drain()
+	if done.Load() != 20 {
+		t.Errorf("Expected 20 works done, got %d", done.Load())
+	}
+}